@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const nonTransactionSeqNo uint64 = 0
@@ -46,6 +47,27 @@ func (wb *WriteBatch) Put(key []byte, value []byte) error {
 	return nil
 }
 
+// PutWithTTL 批量写入带有过期时间的数据
+func (wb *WriteBatch) PutWithTTL(key []byte, value []byte, ttl time.Duration) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	// 暂存 LogRecord
+	logRecord := &data.LogRecord{
+		Key:    key,
+		Value:  value,
+		Expire: time.Now().Add(ttl).UnixNano(),
+	}
+	wb.pendingWrites[string(key)] = logRecord
+	return nil
+}
+
 // Delete 删除数据
 func (wb *WriteBatch) Delete(key []byte) error {
 	if len(key) == 0 {
@@ -81,6 +103,10 @@ func (wb *WriteBatch) Commit() error {
 		return nil
 	}
 
+	if wb.db.option.ReadOnly {
+		return ErrReadOnly
+	}
+
 	if uint(len(wb.pendingWrites)) > wb.options.MaxBatchNum {
 		return ErrExceedMaxBatchNum
 	}
@@ -95,10 +121,11 @@ func (wb *WriteBatch) Commit() error {
 	// 开始写数据到数据文件当中
 	positions := make(map[string]*data.LogRecordPos)
 	for _, logRecord := range wb.pendingWrites {
-		logRecordPos, err := wb.db.appendLogRecord(&data.LogRecord{
-			Key:   logRecordKeyWithSeq(logRecord.Key, seqNo),
-			Value: logRecord.Value,
-			Type:  logRecord.Type,
+		logRecordPos, err := wb.db.writeLogRecord(&data.LogRecord{
+			Key:    logRecordKeyWithSeq(logRecord.Key, seqNo),
+			Value:  logRecord.Value,
+			Type:   logRecord.Type,
+			Expire: logRecord.Expire,
 		})
 		if err != nil {
 			return err
@@ -110,26 +137,44 @@ func (wb *WriteBatch) Commit() error {
 		Key:  logRecordKeyWithSeq(txnFinKey, seqNo),
 		Type: data.LogRecordTxnFinished,
 	}
-	if _, err := wb.db.appendLogRecord(finishedRecord); err != nil {
+	finishedPos, err := wb.db.writeLogRecord(finishedRecord)
+	if err != nil {
 		return err
 	}
+	atomic.AddInt64(&wb.db.reclaimSize, int64(finishedPos.Size))
 
-	// 根据配置决定是否持久化
-	if wb.options.SyncWrites && wb.db.activeFile != nil {
+	// 根据配置决定是否持久化，整个批次只持久化一次
+	if (wb.options.SyncWrites || wb.db.option.SyncWrites) && wb.db.activeFile != nil {
 		if err := wb.db.activeFile.Sync(); err != nil {
 			return err
 		}
 	}
 
-	// 更新对应的内存索引
+	// 更新对应的索引，整个批次在一次原子操作中更新
+	records := make([]*data.LogRecord, 0, len(wb.pendingWrites))
+	keys := make([][]byte, 0, len(wb.pendingWrites))
+	indexPositions := make([]*data.LogRecordPos, 0, len(wb.pendingWrites))
 	for _, record := range wb.pendingWrites {
-		pos := positions[string(record.Key)]
-		if record.Type == data.LogRecordNormal {
-			wb.db.index.Put(record.Key, pos)
+		records = append(records, record)
+		keys = append(keys, record.Key)
+		if record.Type == data.LogRecordDeleted {
+			indexPositions = append(indexPositions, nil)
+		} else {
+			indexPositions = append(indexPositions, positions[string(record.Key)])
 		}
+	}
+	oldPositions, err := wb.db.updateIndexBatch(keys, indexPositions)
+	if err != nil {
+		return err
+	}
+	for i, record := range records {
 		if record.Type == data.LogRecordDeleted {
-			wb.db.index.Delete(record.Key)
+			atomic.AddInt64(&wb.db.reclaimSize, int64(positions[string(record.Key)].Size))
+		}
+		if oldPos := oldPositions[i]; oldPos != nil {
+			atomic.AddInt64(&wb.db.reclaimSize, int64(oldPos.Size))
 		}
+		wb.db.recordWrite(record.Key, seqNo, oldPositions[i])
 	}
 
 	// 清空暂存数据
@@ -0,0 +1,111 @@
+package kv_go
+
+import (
+	"KV-go/data"
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	valueCacheShards = 16
+
+	// 每个缓存项除了 value 之外的大致内存占用，包括链表节点和 map 中的数据
+	valueCacheEntryOverhead = 96
+)
+
+// valueCacheKey 数据在数据文件中的位置，覆盖写入或者删除之后位置会发生变化，缓存不需要主动失效
+type valueCacheKey struct {
+	fid    uint32
+	offset int64
+}
+
+type valueCacheEntry struct {
+	key   valueCacheKey
+	value []byte
+}
+
+// valueCache 分片的 LRU 缓存，缓存根据位置从数据文件中读取的 value
+type valueCache struct {
+	shards [valueCacheShards]valueCacheShard
+	hits   uint64
+	misses uint64
+}
+
+type valueCacheShard struct {
+	mu       sync.Mutex
+	capacity int64 // 分片的容量，字节为单位
+	size     int64
+	items    map[valueCacheKey]*list.Element
+	lru      *list.List // 最近访问的在链表头部
+}
+
+// newValueCache 创建容量为 capacity 字节的缓存，capacity 不大于 0 时返回 nil，表示不使用缓存
+func newValueCache(capacity int64) *valueCache {
+	if capacity <= 0 {
+		return nil
+	}
+	c := &valueCache{}
+	for i := range c.shards {
+		c.shards[i].capacity = capacity / valueCacheShards
+		c.shards[i].items = make(map[valueCacheKey]*list.Element)
+		c.shards[i].lru = list.New()
+	}
+	return c
+}
+
+func (c *valueCache) shard(key valueCacheKey) *valueCacheShard {
+	h := uint64(key.fid)*0x9E3779B97F4A7C15 ^ uint64(key.offset)*0xC2B2AE3D27D4EB4F
+	return &c.shards[(h>>32)%valueCacheShards]
+}
+
+func (c *valueCache) get(pos *data.LogRecordPos) ([]byte, bool) {
+	key := valueCacheKey{fid: pos.Fid, offset: pos.Offset}
+	s := c.shard(key)
+	s.mu.Lock()
+	elem, ok := s.items[key]
+	if ok {
+		s.lru.MoveToFront(elem)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	return elem.Value.(*valueCacheEntry).value, true
+}
+
+// put 缓存 value，value 不能再被修改
+func (c *valueCache) put(pos *data.LogRecordPos, value []byte) {
+	key := valueCacheKey{fid: pos.Fid, offset: pos.Offset}
+	entrySize := int64(len(value)) + valueCacheEntryOverhead
+	s := c.shard(key)
+	// 超过分片容量的 value 不缓存
+	if entrySize > s.capacity {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.items[key]; ok {
+		s.lru.MoveToFront(elem)
+		return
+	}
+	s.items[key] = s.lru.PushFront(&valueCacheEntry{key: key, value: value})
+	s.size += entrySize
+
+	// 淘汰最久没有访问的数据
+	for s.size > s.capacity {
+		elem := s.lru.Back()
+		entry := elem.Value.(*valueCacheEntry)
+		s.lru.Remove(elem)
+		delete(s.items, entry.key)
+		s.size -= int64(len(entry.value)) + valueCacheEntryOverhead
+	}
+}
+
+func (c *valueCache) stats() (hits, misses uint64) {
+	return atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.misses)
+}
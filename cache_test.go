@@ -0,0 +1,112 @@
+package kv_go
+
+import (
+	"KV-go/data"
+	"KV-go/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestValueCache(t *testing.T) {
+	assert.Nil(t, newValueCache(0))
+
+	// 每个分片可以容纳两个缓存项
+	c := newValueCache(valueCacheShards * 2 * (valueCacheEntryOverhead + 10))
+	var positions []*data.LogRecordPos
+	for i := 0; i < 1000; i++ {
+		pos := &data.LogRecordPos{Fid: uint32(i % 3), Offset: int64(i * 100)}
+		positions = append(positions, pos)
+		c.put(pos, make([]byte, 10))
+	}
+	var size int64
+	var count int
+	for i := range c.shards {
+		assert.True(t, c.shards[i].size <= c.shards[i].capacity)
+		assert.Equal(t, c.shards[i].lru.Len(), len(c.shards[i].items))
+		size += c.shards[i].size
+		count += len(c.shards[i].items)
+	}
+	assert.Equal(t, int64(count)*(valueCacheEntryOverhead+10), size)
+
+	// 最近写入的数据还在缓存中
+	_, ok := c.get(positions[999])
+	assert.True(t, ok)
+	_, ok = c.get(positions[0])
+	assert.False(t, ok)
+	hits, misses := c.stats()
+	assert.Equal(t, uint64(1), hits)
+	assert.Equal(t, uint64(1), misses)
+
+	// 超过分片容量的 value 不缓存
+	big := &data.LogRecordPos{Fid: 10, Offset: 0}
+	c.put(big, make([]byte, 1024))
+	_, ok = c.get(big)
+	assert.False(t, ok)
+}
+
+func TestValueCache_LRU(t *testing.T) {
+	c := newValueCache(valueCacheShards * 2 * (valueCacheEntryOverhead + 1))
+	// 找到落在同一个分片中的三个位置
+	var same []*data.LogRecordPos
+	first := valueCacheKey{fid: 1, offset: 0}
+	for offset := int64(0); len(same) < 3; offset++ {
+		if c.shard(valueCacheKey{fid: 1, offset: offset}) == c.shard(first) {
+			same = append(same, &data.LogRecordPos{Fid: 1, Offset: offset})
+		}
+	}
+	c.put(same[0], []byte("a"))
+	c.put(same[1], []byte("b"))
+	// 访问之后 same[0] 成为最近使用的数据，淘汰 same[1]
+	_, ok := c.get(same[0])
+	assert.True(t, ok)
+	c.put(same[2], []byte("c"))
+	_, ok = c.get(same[1])
+	assert.False(t, ok)
+	value, ok := c.get(same[0])
+	assert.True(t, ok)
+	assert.Equal(t, []byte("a"), value)
+}
+
+func TestDB_ValueCache(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-value-cache")
+	opts.DirPath = dir
+	opts.ValueCacheSize = 1024 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.Put(utils.GetTestKey(1), []byte("v1")))
+	for i := 0; i < 3; i++ {
+		value, err := db.Get(utils.GetTestKey(1))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("v1"), value)
+		// 修改返回的 value 不影响缓存
+		value[0] = 'x'
+	}
+	stat, err := db.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), stat.CacheHits)
+	assert.Equal(t, uint64(1), stat.CacheMisses)
+
+	// 覆盖写入和删除之后位置发生变化，不会读到旧的数据
+	assert.Nil(t, db.Put(utils.GetTestKey(1), []byte("v2")))
+	value, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), value)
+	assert.Nil(t, db.Delete(utils.GetTestKey(1)))
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// 缓存中的数据过期之后不可见
+	assert.Nil(t, db.PutWithTTL(utils.GetTestKey(2), []byte("v3"), 20*time.Millisecond))
+	value, err = db.Get(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v3"), value)
+	pos := db.index.Get(utils.GetTestKey(2))
+	time.Sleep(40 * time.Millisecond)
+	_, err = db.getValueByPosition(pos)
+	assert.Equal(t, ErrKeyNotFound, err)
+}
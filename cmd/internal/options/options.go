@@ -0,0 +1,79 @@
+// Package options 命令行工具共用的打开数据库的参数
+package options
+
+import (
+	kv "KV-go"
+	"KV-go/data"
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// EncryptionKeyEnv 没有指定密钥文件时，从这个环境变量中读取十六进制编码的密钥
+// 密钥不通过命令行参数传递，避免出现在 ps 和 shell 的历史记录中
+const EncryptionKeyEnv = "KV_ENCRYPTION_KEY"
+
+// Flags 打开数据库相关的命令行参数
+type Flags struct {
+	Dir         string
+	IndexType   string
+	KeyFile     string
+	Compression string
+}
+
+// Register 在 FlagSet 中注册打开数据库相关的参数
+func Register(fs *flag.FlagSet) *Flags {
+	f := &Flags{}
+	fs.StringVar(&f.Dir, "dir", "", "the database directory")
+	fs.StringVar(&f.IndexType, "index", "btree", "the index type of the database: btree, art or bptree")
+	fs.StringVar(&f.KeyFile, "key-file", "", "the file containing the hex encoded encryption key of the database, defaults to $"+EncryptionKeyEnv)
+	fs.StringVar(&f.Compression, "compression", "none", "the compressor of the database: none, flate or gzip")
+	return f
+}
+
+// Options 根据命令行参数生成打开数据库的配置项
+func (f *Flags) Options() (kv.Options, error) {
+	opts := kv.DefaultOptions
+	opts.DirPath = f.Dir
+
+	switch f.IndexType {
+	case "btree":
+		opts.IndexType = kv.Btree
+	case "art":
+		opts.IndexType = kv.ART
+	case "bptree":
+		opts.IndexType = kv.BPTree
+	default:
+		return opts, fmt.Errorf("unsupported index type %q", f.IndexType)
+	}
+
+	key := []byte(os.Getenv(EncryptionKeyEnv))
+	if f.KeyFile != "" {
+		b, err := os.ReadFile(f.KeyFile)
+		if err != nil {
+			return opts, fmt.Errorf("read encryption key: %w", err)
+		}
+		key = bytes.TrimSpace(b)
+	}
+	if len(key) > 0 {
+		encryptionKey := make([]byte, hex.DecodedLen(len(key)))
+		if _, err := hex.Decode(encryptionKey, key); err != nil {
+			return opts, fmt.Errorf("invalid encryption key: %w", err)
+		}
+		opts.EncryptionKey = encryptionKey
+	}
+
+	var err error
+	switch f.Compression {
+	case "none":
+	case "flate":
+		opts.Compressor, err = data.NewFlateCompressor(-1)
+	case "gzip":
+		opts.Compressor, err = data.NewGzipCompressor(-1)
+	default:
+		err = fmt.Errorf("unsupported compression %q", f.Compression)
+	}
+	return opts, err
+}
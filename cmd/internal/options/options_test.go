@@ -0,0 +1,49 @@
+package options
+
+import (
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFlags_EncryptionKey(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := Register(fs)
+	assert.Nil(t, fs.Parse([]string{"-dir", "/tmp/kv"}))
+
+	// 没有配置密钥时不加密
+	t.Setenv(EncryptionKeyEnv, "")
+	opts, err := f.Options()
+	assert.Nil(t, err)
+	assert.Nil(t, opts.EncryptionKey)
+
+	// 从环境变量中读取密钥
+	t.Setenv(EncryptionKeyEnv, "00112233445566778899aabbccddeeff")
+	opts, err = f.Options()
+	assert.Nil(t, err)
+	assert.Equal(t, 16, len(opts.EncryptionKey))
+	assert.Equal(t, byte(0xff), opts.EncryptionKey[15])
+
+	// 密钥文件优先于环境变量，忽略末尾的换行
+	keyFile := filepath.Join(t.TempDir(), "key")
+	assert.Nil(t, os.WriteFile(keyFile, []byte("ffeeddccbbaa99887766554433221100\n"), 0600))
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	f = Register(fs)
+	assert.Nil(t, fs.Parse([]string{"-dir", "/tmp/kv", "-key-file", keyFile}))
+	opts, err = f.Options()
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0xff), opts.EncryptionKey[0])
+
+	assert.Nil(t, os.WriteFile(keyFile, []byte("not hex"), 0600))
+	_, err = f.Options()
+	assert.NotNil(t, err)
+
+	// 不再支持通过命令行参数传递密钥
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	Register(fs)
+	assert.NotNil(t, fs.Parse([]string{"-key", "00112233445566778899aabbccddeeff"}))
+}
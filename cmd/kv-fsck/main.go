@@ -0,0 +1,78 @@
+// kv-fsck 离线检查 bitcask 数据目录，并可以将有效的数据修复到一个新的目录中
+//
+//	kv-fsck -dir /tmp/kv
+//	kv-fsck -dir /tmp/kv -repair -out /tmp/kv-repaired
+package main
+
+import (
+	kv "KV-go"
+	"KV-go/cmd/internal/options"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	flags := options.Register(flag.CommandLine)
+	repair := flag.Bool("repair", false, "rewrite the valid data into the directory given by -out")
+	out := flag.String("out", "", "the directory to write the repaired data to")
+	flag.Parse()
+
+	if flags.Dir == "" || (*repair && *out == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts, err := flags.Options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "kv-fsck:", err)
+		os.Exit(2)
+	}
+
+	var report *kv.CheckReport
+	if *repair {
+		report, err = kv.Repair(opts, *out)
+	} else {
+		report, err = kv.Check(opts)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "kv-fsck:", err)
+		os.Exit(2)
+	}
+
+	printReport(report)
+	if *repair {
+		fmt.Printf("repaired %d keys into %s\n", report.Keys, *out)
+		return
+	}
+	if !report.Healthy() {
+		os.Exit(1)
+	}
+}
+
+func printReport(report *kv.CheckReport) {
+	fmt.Printf("data files:        %d\n", report.DataFiles)
+	fmt.Printf("records:           %d\n", report.Records)
+	fmt.Printf("keys:              %d\n", report.Keys)
+	fmt.Printf("hint records:      %d (invalid: %d)\n", report.HintRecords, report.InvalidHintRecords)
+	fmt.Printf("unfinished txns:   %d (records: %d)\n", report.UnfinishedTxns, report.UnfinishedTxnRecords)
+	if report.MergeFinished {
+		fmt.Printf("merged before:     file %d\n", report.NonMergeFileId)
+	}
+	if report.MergeDir != "" {
+		state := "unfinished, will be removed on next open"
+		if report.MergeDirFinished {
+			state = "finished, will be applied on next open"
+		}
+		fmt.Printf("merge directory:   %s (%s)\n", report.MergeDir, state)
+	}
+	fmt.Printf("corrupt records:   %d\n", len(report.CorruptRecords))
+	for _, record := range report.CorruptRecords {
+		fmt.Printf("  %s offset %d size %d: %v\n", record.FileName, record.Offset, record.Size, record.Err)
+	}
+	if report.Healthy() {
+		fmt.Println("status:            ok")
+	} else {
+		fmt.Println("status:            corrupted")
+	}
+}
@@ -0,0 +1,75 @@
+// kv-http 通过 HTTP/JSON 接口对外提供 bitcask 存储引擎的访问
+//
+//	kv-http -dir /tmp/kv -addr :8080
+//	curl -X PUT --data-binary bitcask 'localhost:8080/keys/name?ttl=10m'
+//	curl 'localhost:8080/keys?prefix=user:&limit=10'
+package main
+
+import (
+	kv "KV-go"
+	"KV-go/cmd/internal/options"
+	kvhttp "KV-go/http"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	flags := options.Register(flag.CommandLine)
+	addr := flag.String("addr", ":8080", "the address to listen on")
+	flag.Parse()
+
+	if flags.Dir == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts, err := flags.Options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "kv-http:", err)
+		os.Exit(2)
+	}
+	db, err := kv.Open(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "kv-http:", err)
+		os.Exit(1)
+	}
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           kvhttp.NewHandler(db),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// 收到退出信号后等待正在处理的请求结束，再关闭数据库
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-sigCh
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	var code int
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, "kv-http:", err)
+		code = 1
+	} else {
+		<-shutdownDone
+	}
+
+	if err := db.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, "kv-http:", err)
+		code = 1
+	}
+	os.Exit(code)
+}
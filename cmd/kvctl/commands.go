@@ -0,0 +1,301 @@
+package main
+
+import (
+	kv "KV-go"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var errUsage = errors.New("invalid arguments")
+
+// command kvctl 支持的命令
+type command struct {
+	usage string
+	help  string
+	run   func(db *kv.DB, args []string, out io.Writer) error
+}
+
+var commands = map[string]command{
+	"get":    {"get <key>", "print the value of a key", runGet},
+	"put":    {"put <key> <value> [ttl]", "set the value of a key, ttl is a duration like 10s", runPut},
+	"delete": {"delete <key>", "delete a key", runDelete},
+	"ttl":    {"ttl <key>", "print the remaining time to live of a key", runTTL},
+	"scan":   {"scan [-prefix p] [-start s] [-end e] [-reverse] [-limit n] [-keys]", "list keys in [start, end) in order", runScan},
+	"merge":  {"merge", "merge the data files to reclaim disk space", runMerge},
+	"stat":   {"stat", "print statistics of the database", runStat},
+	"backup": {"backup <dir>", "copy the database into a directory", runBackup},
+	"export": {"export [-prefix p] [file]", "write keys and values as json lines to a file or stdout", runExport},
+}
+
+func init() {
+	// help 需要列出所有的命令，单独注册避免初始化循环
+	commands["help"] = command{"help", "print this help", runHelp}
+}
+
+// execute 执行一条命令，args[0] 为命令的名称
+func execute(db *kv.DB, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return nil
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, run \"help\" to list the commands", args[0])
+	}
+	if err := cmd.run(db, args[1:], out); err != nil {
+		if err == errUsage {
+			return fmt.Errorf("usage: %s", cmd.usage)
+		}
+		return err
+	}
+	return nil
+}
+
+func printHelp(out io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(out, "commands:")
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-70s %s\n", commands[name].usage, commands[name].help)
+	}
+}
+
+func runHelp(_ *kv.DB, _ []string, out io.Writer) error {
+	printHelp(out)
+	return nil
+}
+
+func runGet(db *kv.DB, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	value, err := db.Get([]byte(args[0]))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(value))
+	return err
+}
+
+func runPut(db *kv.DB, args []string, out io.Writer) error {
+	if len(args) != 2 && len(args) != 3 {
+		return errUsage
+	}
+	if len(args) == 2 {
+		return db.Put([]byte(args[0]), []byte(args[1]))
+	}
+	ttl, err := time.ParseDuration(args[2])
+	if err != nil {
+		return err
+	}
+	return db.PutWithTTL([]byte(args[0]), []byte(args[1]), ttl)
+}
+
+func runDelete(db *kv.DB, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	return db.Delete([]byte(args[0]))
+}
+
+func runTTL(db *kv.DB, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	ttl, err := db.TTL([]byte(args[0]))
+	if err != nil {
+		return err
+	}
+	if ttl == kv.NoExpiration {
+		_, err = fmt.Fprintln(out, "no expiration")
+	} else {
+		_, err = fmt.Fprintln(out, ttl.Round(time.Millisecond))
+	}
+	return err
+}
+
+// scan 和 export 共用的遍历参数
+type scanOptions struct {
+	prefix  string
+	start   string
+	end     string
+	reverse bool
+	limit   int
+}
+
+// 遍历 [start, end) 范围内的 key，反向遍历时从 end 之前的 key 开始
+func scan(db *kv.DB, opts scanOptions, fn func(key []byte, value []byte) error) error {
+	iterator := db.NewIterator(kv.IteratorOptions{
+		Prefix:     []byte(opts.prefix),
+		Reverse:    opts.reverse,
+		LowerBound: []byte(opts.start),
+		UpperBound: []byte(opts.end),
+		Limit:      opts.limit,
+	})
+	defer iterator.Close()
+
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		value, err := iterator.Value()
+		if err == kv.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(iterator.Key(), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runScan(db *kv.DB, args []string, out io.Writer) error {
+	var opts scanOptions
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.prefix, "prefix", "", "")
+	fs.StringVar(&opts.start, "start", "", "")
+	fs.StringVar(&opts.end, "end", "", "")
+	fs.BoolVar(&opts.reverse, "reverse", false, "")
+	fs.IntVar(&opts.limit, "limit", 0, "")
+	keysOnly := fs.Bool("keys", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return errUsage
+	}
+
+	return scan(db, opts, func(key []byte, value []byte) error {
+		var err error
+		if *keysOnly {
+			_, err = fmt.Fprintln(out, string(key))
+		} else {
+			_, err = fmt.Fprintf(out, "%s\t%s\n", key, value)
+		}
+		return err
+	})
+}
+
+func runMerge(db *kv.DB, args []string, out io.Writer) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	if err := db.Merge(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(out, "merge finished, it takes effect after the database is reopened")
+	return err
+}
+
+func runStat(db *kv.DB, args []string, out io.Writer) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	stat, err := db.Stat()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "keys:             %d\ndata files:       %d\ndisk size:        %d\nreclaimable size: %d\n",
+		stat.KeyNum, stat.DataFileNum, stat.DiskSize, stat.ReclaimableSize)
+	return err
+}
+
+func runBackup(db *kv.DB, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	return db.Backup(args[0])
+}
+
+// exportRecord 导出的一条数据，key 和 value 使用 base64 编码
+type exportRecord struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+	TTL   int64  `json:"ttl_ms,omitempty"`
+}
+
+func runExport(db *kv.DB, args []string, out io.Writer) error {
+	var opts scanOptions
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.prefix, "prefix", "", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 {
+		return errUsage
+	}
+
+	w := out
+	var f *os.File
+	if fs.NArg() == 1 {
+		var err error
+		f, err = os.OpenFile(fs.Arg(0), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		w = f
+	}
+
+	encoder := json.NewEncoder(w)
+	var count int
+	err := scan(db, opts, func(key []byte, value []byte) error {
+		record := exportRecord{Key: key, Value: value}
+		if ttl, err := db.TTL(key); err == nil && ttl != kv.NoExpiration {
+			record.TTL = ttl.Milliseconds()
+		}
+		count++
+		return encoder.Encode(&record)
+	})
+	// 关闭文件时才会暴露出部分写入错误，需要检查
+	if f != nil {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		_, err = fmt.Fprintf(out, "exported %d keys to %s\n", count, fs.Arg(0))
+	}
+	return err
+}
+
+// splitArgs 按照空白字符切分一行命令，支持使用双引号包含空白字符，以及反斜杠转义
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var inQuote, escaped, hasArg bool
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped, hasArg = true, true
+		case r == '"':
+			inQuote, hasArg = !inQuote, true
+		case !inQuote && (r == ' ' || r == '\t'):
+			if hasArg {
+				args = append(args, current.String())
+				current.Reset()
+				hasArg = false
+			}
+		default:
+			current.WriteRune(r)
+			hasArg = true
+		}
+	}
+	if inQuote || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if hasArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	kv "KV-go"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	args, err := splitArgs(`put  "a b"   c\ d ""`)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"put", "a b", "c d", ""}, args)
+
+	args, err = splitArgs("   ")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(args))
+
+	_, err = splitArgs(`get "name`)
+	assert.NotNil(t, err)
+}
+
+func TestExecute(t *testing.T) {
+	opts := kv.DefaultOptions
+	dir, _ := os.MkdirTemp("", "kvctl")
+	defer os.RemoveAll(dir)
+	opts.DirPath = filepath.Join(dir, "db")
+	db, err := kv.Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	var out bytes.Buffer
+	for _, key := range []string{"a", "b", "c", "d"} {
+		assert.Nil(t, execute(db, []string{"put", key, "value-" + key}, &out))
+	}
+	assert.Nil(t, execute(db, []string{"get", "b"}, &out))
+	assert.Equal(t, "value-b\n", out.String())
+
+	out.Reset()
+	assert.Nil(t, execute(db, []string{"scan", "-start", "b", "-end", "d", "-keys"}, &out))
+	assert.Equal(t, "b\nc\n", out.String())
+	out.Reset()
+	assert.Nil(t, execute(db, []string{"scan", "-start", "b", "-end", "d", "-reverse"}, &out))
+	assert.Equal(t, "c\tvalue-c\nb\tvalue-b\n", out.String())
+	out.Reset()
+	assert.Nil(t, execute(db, []string{"scan", "-limit", "1", "-reverse", "-keys"}, &out))
+	assert.Equal(t, "d\n", out.String())
+
+	assert.Nil(t, execute(db, []string{"delete", "a"}, &out))
+	assert.Equal(t, kv.ErrKeyNotFound, execute(db, []string{"get", "a"}, &out))
+	assert.Nil(t, execute(db, []string{"put", "e", "value-e", "1h"}, &out))
+
+	exportFile := filepath.Join(dir, "export.json")
+	assert.Nil(t, execute(db, []string{"export", exportFile}, &out))
+	exported, err := os.ReadFile(exportFile)
+	assert.Nil(t, err)
+	// 导出的文件包含明文数据，只有所有者可以读写
+	stat, err := os.Stat(exportFile)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+	assert.Equal(t, 4, bytes.Count(exported, []byte("\n")))
+	assert.Contains(t, string(exported), "ttl_ms")
+
+	assert.Nil(t, execute(db, []string{"backup", filepath.Join(dir, "backup")}, &out))
+	assert.NotNil(t, execute(db, []string{"get"}, &out))
+	assert.NotNil(t, execute(db, []string{"unknown"}, &out))
+}
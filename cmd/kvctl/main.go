@@ -0,0 +1,59 @@
+// kvctl 打开一个 bitcask 数据目录，执行单条命令，或者进入交互式的命令行
+//
+//	kvctl -dir /tmp/kv get name
+//	kvctl -dir /tmp/kv scan -prefix user: -limit 10
+//	kvctl -dir /tmp/kv
+package main
+
+import (
+	kv "KV-go"
+	"KV-go/cmd/internal/options"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	flags := options.Register(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: kvctl -dir <dir> [flags] [command [args]]\n\n")
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output())
+		printHelp(flag.CommandLine.Output())
+	}
+	flag.Parse()
+
+	if flags.Dir == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts, err := flags.Options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "kvctl:", err)
+		os.Exit(2)
+	}
+	// 交互式工具不修改损坏的数据文件，遇到损坏的数据直接报错，由 kv-fsck 处理
+	opts.RecoveryPolicy = kv.RecoveryFail
+	db, err := kv.Open(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "kvctl:", err)
+		os.Exit(1)
+	}
+
+	var code int
+	if flag.NArg() > 0 {
+		if err := execute(db, flag.Args(), os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "kvctl:", err)
+			code = 1
+		}
+	} else {
+		runShell(db, flags.Dir)
+	}
+
+	if err := db.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, "kvctl:", err)
+		code = 1
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	kv "KV-go"
+	"fmt"
+	"github.com/peterh/liner"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const historyFileName = ".kvctl_history"
+
+// runShell 交互式的命令行，支持历史记录和命令补全，历史记录保存在用户的 home 目录中
+func runShell(db *kv.DB, dir string) {
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+	line.SetCompleter(func(input string) []string {
+		var candidates []string
+		for name := range commands {
+			if strings.HasPrefix(name, input) {
+				candidates = append(candidates, name)
+			}
+		}
+		return candidates
+	})
+
+	historyFile := historyFilePath()
+	if f, err := os.Open(historyFile); err == nil {
+		_, _ = line.ReadHistory(f)
+		_ = f.Close()
+	}
+	defer func() {
+		if f, err := os.OpenFile(historyFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600); err == nil {
+			_, _ = line.WriteHistory(f)
+			_ = f.Close()
+		}
+	}()
+
+	prompt := filepath.Base(dir) + "> "
+	for {
+		input, err := line.Prompt(prompt)
+		if err == liner.ErrPromptAborted || err == io.EOF {
+			fmt.Println()
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "kvctl:", err)
+			return
+		}
+
+		args, err := splitArgs(input)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		line.AppendHistory(input)
+		if args[0] == "exit" || args[0] == "quit" {
+			return
+		}
+		if err := execute(db, args, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+	}
+}
+
+func historyFilePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return historyFileName
+	}
+	return filepath.Join(home, historyFileName)
+}
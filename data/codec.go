@@ -0,0 +1,133 @@
+package data
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"hash/crc32"
+)
+
+var (
+	ErrCompressorNotSet     = errors.New("log record is compressed but no compressor is set")
+	ErrEncryptionKeyNotSet  = errors.New("log record is encrypted but no encryption key is set")
+	ErrInvalidEncryptionKey = errors.New("failed to decrypt log record, the encryption key may be wrong")
+)
+
+// Codec 写入数据文件之前对 LogRecord 进行的转换，读取时进行反向的转换
+// 为 nil 时不做任何处理
+type Codec struct {
+	Compressor        Compressor  // 压缩 value 的算法，为 nil 表示不压缩
+	CompressThreshold int         // value 的大小达到该阈值时才进行压缩
+	aead              cipher.AEAD // 对 key 和 value 进行加密，为 nil 表示不加密
+}
+
+// NewCodec 初始化 Codec，encryptionKey 为 AES 密钥，长度需要是 16、24 或 32 字节，为空表示不加密
+// 没有配置任何转换时返回 nil
+func NewCodec(compressor Compressor, compressThreshold int, encryptionKey []byte) (*Codec, error) {
+	if compressor == nil && len(encryptionKey) == 0 {
+		return nil, nil
+	}
+	codec := &Codec{
+		Compressor:        compressor,
+		CompressThreshold: compressThreshold,
+	}
+	if len(encryptionKey) > 0 {
+		block, err := aes.NewCipher(encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		if codec.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return codec, nil
+}
+
+// EncodeLogRecord 对 LogRecord 进行编码，并在 header 中打上对应的标识
+// value 达到阈值时先进行压缩，压缩之后没有变小的 value 按照原样写入
+// 配置了密钥时，使用 AES-GCM 对 key 和 value 一起进行加密，密文的格式为 nonce | 加密后的 key+value | tag
+// 密文的前 keySize 个字节作为 key 部分，剩下的作为 value 部分写入，header 中记录的 key size 仍然是原始 key 的长度
+// 除 crc 之外的 header 作为附加数据参与认证，类型、过期时间等被篡改之后同样无法解密
+func (c *Codec) EncodeLogRecord(logRecord *LogRecord) ([]byte, int64, error) {
+	if c == nil {
+		encRecord, size := EncodeLogRecord(logRecord)
+		return encRecord, size, nil
+	}
+
+	var flags byte
+	record := &LogRecord{
+		Key:    logRecord.Key,
+		Value:  logRecord.Value,
+		Type:   logRecord.Type,
+		Expire: logRecord.Expire,
+	}
+
+	if c.Compressor != nil && len(record.Value) > 0 && len(record.Value) >= c.CompressThreshold {
+		compressed, err := c.Compressor.Compress(record.Value)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(compressed) < len(record.Value) {
+			record.Value = compressed
+			flags |= logRecordCompressFlag
+		}
+	}
+
+	if c.aead != nil {
+		nonce := make([]byte, c.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, 0, err
+		}
+		plaintext := make([]byte, len(record.Key)+len(record.Value))
+		copy(plaintext, record.Key)
+		copy(plaintext[len(record.Key):], record.Value)
+		flags |= logRecordEncryptFlag
+		// 加密之后 key 的长度不变，value 部分多出 nonce 和 tag 的长度
+		valueSize := len(record.Value) + len(nonce) + c.aead.Overhead()
+		header := encodeLogRecordHeader(record.Type|flags, len(record.Key), valueSize, record.Expire)
+		ciphertext := c.aead.Seal(nonce, nonce, plaintext, header[crc32.Size:])
+		record.Key = ciphertext[:len(record.Key)]
+		record.Value = ciphertext[len(record.Key):]
+	}
+
+	encRecord, size := encodeLogRecord(record, flags)
+	return encRecord, size, nil
+}
+
+// 根据 header 中的标识对读取到的 LogRecord 进行还原，先解密，再解压
+// headerBuf 为 crc 之外的 header 原始数据，解密时用于认证
+func (c *Codec) decodeLogRecord(logRecord *LogRecord, header *logRecordHeader, headerBuf []byte) error {
+	if header.encrypted {
+		if c == nil || c.aead == nil {
+			return ErrEncryptionKeyNotSet
+		}
+		keySize := len(logRecord.Key)
+		ciphertext := make([]byte, keySize+len(logRecord.Value))
+		copy(ciphertext, logRecord.Key)
+		copy(ciphertext[keySize:], logRecord.Value)
+
+		nonceSize := c.aead.NonceSize()
+		if len(ciphertext) < nonceSize+keySize {
+			return ErrInvalidEncryptionKey
+		}
+		plaintext, err := c.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], headerBuf)
+		if err != nil || len(plaintext) < keySize {
+			return ErrInvalidEncryptionKey
+		}
+		logRecord.Key = plaintext[:keySize]
+		logRecord.Value = plaintext[keySize:]
+	}
+
+	if header.compressed {
+		if c == nil || c.Compressor == nil {
+			return ErrCompressorNotSet
+		}
+		value, err := c.Compressor.Decompress(logRecord.Value)
+		if err != nil {
+			return err
+		}
+		logRecord.Value = value
+	}
+	return nil
+}
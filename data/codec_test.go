@@ -0,0 +1,163 @@
+package data
+
+import (
+	"KV-go/fio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"hash/crc32"
+	"os"
+	"testing"
+)
+
+func TestCompressor(t *testing.T) {
+	flateCompressor, err := NewFlateCompressor(flate.BestSpeed)
+	assert.Nil(t, err)
+	gzipCompressor, err := NewGzipCompressor(gzip.DefaultCompression)
+	assert.Nil(t, err)
+
+	_, err = NewFlateCompressor(100)
+	assert.NotNil(t, err)
+	_, err = NewGzipCompressor(100)
+	assert.NotNil(t, err)
+
+	src := bytes.Repeat([]byte(`{"name":"bitcask","value":"kv-go"}`), 100)
+	for _, compressor := range []Compressor{flateCompressor, gzipCompressor} {
+		for i := 0; i < 3; i++ {
+			compressed, err := compressor.Compress(src)
+			assert.Nil(t, err)
+			assert.Less(t, len(compressed), len(src))
+			decompressed, err := compressor.Decompress(compressed)
+			assert.Nil(t, err)
+			assert.Equal(t, src, decompressed)
+		}
+	}
+}
+
+func TestCodec_EncodeLogRecord(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-codec")
+	defer os.RemoveAll(dir)
+	compressor, err := NewFlateCompressor(flate.DefaultCompression)
+	assert.Nil(t, err)
+	codec := &Codec{Compressor: compressor, CompressThreshold: 64}
+
+	dataFile, err := OpenDataFile(dir, 0, fio.StandardFIO)
+	assert.Nil(t, err)
+	dataFile.Codec = codec
+
+	// 超过阈值的 value 被压缩
+	rec1 := &LogRecord{Key: []byte("name"), Value: bytes.Repeat([]byte("bitcask"), 100)}
+	enc1, size1, err := codec.EncodeLogRecord(rec1)
+	assert.Nil(t, err)
+	_, plainSize1 := EncodeLogRecord(rec1)
+	assert.Less(t, size1, plainSize1)
+	assert.Nil(t, dataFile.Write(enc1))
+
+	// 没有达到阈值的 value 不压缩
+	rec2 := &LogRecord{Key: []byte("age"), Value: []byte("small value")}
+	enc2, size2, err := codec.EncodeLogRecord(rec2)
+	assert.Nil(t, err)
+	_, plainSize2 := EncodeLogRecord(rec2)
+	assert.Equal(t, plainSize2, size2)
+	assert.Nil(t, dataFile.Write(enc2))
+
+	// nil 的 Codec 不做任何处理
+	var nilCodec *Codec
+	_, size3, err := nilCodec.EncodeLogRecord(rec1)
+	assert.Nil(t, err)
+	assert.Equal(t, plainSize1, size3)
+
+	readRec1, readSize1, err := dataFile.ReadLogRecord(0)
+	assert.Nil(t, err)
+	assert.Equal(t, rec1, readRec1)
+	assert.Equal(t, size1, readSize1)
+	readRec2, readSize2, err := dataFile.ReadLogRecord(size1)
+	assert.Nil(t, err)
+	assert.Equal(t, rec2, readRec2)
+	assert.Equal(t, size2, readSize2)
+
+	// 没有设置压缩算法时无法读取压缩的数据
+	dataFile.Codec = nil
+	_, _, err = dataFile.ReadLogRecord(0)
+	assert.Equal(t, ErrCompressorNotSet, err)
+	assert.Nil(t, dataFile.Close())
+}
+
+func TestCodec_Encryption(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-codec-encrypt")
+	defer os.RemoveAll(dir)
+
+	_, err := NewCodec(nil, 0, []byte("invalid key"))
+	assert.NotNil(t, err)
+	nilCodec, err := NewCodec(nil, 0, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, nilCodec)
+
+	compressor, err := NewFlateCompressor(flate.DefaultCompression)
+	assert.Nil(t, err)
+	codec, err := NewCodec(compressor, 64, bytes.Repeat([]byte("k"), 32))
+	assert.Nil(t, err)
+
+	dataFile, err := OpenDataFile(dir, 0, fio.StandardFIO)
+	assert.Nil(t, err)
+	dataFile.Codec = codec
+
+	rec1 := &LogRecord{Key: []byte("name"), Value: bytes.Repeat([]byte("bitcask"), 100)}
+	enc1, size1, err := codec.EncodeLogRecord(rec1)
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(enc1, []byte("name")))
+	assert.Nil(t, dataFile.Write(enc1))
+
+	rec2 := &LogRecord{Key: []byte("age"), Type: LogRecordDeleted}
+	enc2, size2, err := codec.EncodeLogRecord(rec2)
+	assert.Nil(t, err)
+	assert.Nil(t, dataFile.Write(enc2))
+
+	readRec1, readSize1, err := dataFile.ReadLogRecord(0)
+	assert.Nil(t, err)
+	assert.Equal(t, rec1, readRec1)
+	assert.Equal(t, size1, readSize1)
+	readRec2, readSize2, err := dataFile.ReadLogRecord(size1)
+	assert.Nil(t, err)
+	assert.Equal(t, rec2.Key, readRec2.Key)
+	assert.Equal(t, 0, len(readRec2.Value))
+	assert.Equal(t, LogRecordDeleted, readRec2.Type)
+	assert.Equal(t, size2, readSize2)
+
+	// 使用错误的密钥读取
+	wrongCodec, err := NewCodec(compressor, 64, bytes.Repeat([]byte("w"), 32))
+	assert.Nil(t, err)
+	dataFile.Codec = wrongCodec
+	_, _, err = dataFile.ReadLogRecord(0)
+	assert.Equal(t, ErrInvalidEncryptionKey, err)
+
+	// 没有设置密钥时读取
+	dataFile.Codec = nil
+	_, _, err = dataFile.ReadLogRecord(0)
+	assert.Equal(t, ErrEncryptionKeyNotSet, err)
+	assert.Nil(t, dataFile.Close())
+}
+
+func TestCodec_Encryption_Header(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-codec-encrypt-header")
+	defer os.RemoveAll(dir)
+
+	codec, err := NewCodec(nil, 0, bytes.Repeat([]byte("k"), 16))
+	assert.Nil(t, err)
+	dataFile, err := OpenDataFile(dir, 0, fio.StandardFIO)
+	assert.Nil(t, err)
+	dataFile.Codec = codec
+
+	// 将记录的类型改为删除，并重新计算 crc，header 参与了认证，无法解密
+	enc, _, err := codec.EncodeLogRecord(&LogRecord{Key: []byte("name"), Value: []byte("bitcask")})
+	assert.Nil(t, err)
+	enc[4] = enc[4]&^logRecordTypeMask | LogRecordDeleted
+	binary.LittleEndian.PutUint32(enc[:4], crc32.ChecksumIEEE(enc[4:]))
+	assert.Nil(t, dataFile.Write(enc))
+
+	_, _, err = dataFile.ReadLogRecord(0)
+	assert.Equal(t, ErrInvalidEncryptionKey, err)
+	assert.Nil(t, dataFile.Close())
+}
@@ -0,0 +1,101 @@
+package data
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// Compressor value 的压缩算法，可以接入自定义的实现
+// 已经写入的数据只能使用相同的算法进行解压，更换算法之后旧的数据将无法读取
+type Compressor interface {
+	// Compress 压缩数据
+	Compress(src []byte) ([]byte, error)
+
+	// Decompress 解压数据
+	Decompress(src []byte) ([]byte, error)
+}
+
+// flateCompressor 使用标准库 compress/flate 进行压缩
+type flateCompressor struct {
+	level   int
+	writers sync.Pool
+}
+
+// NewFlateCompressor 初始化 flate 压缩算法，level 取值参考 compress/flate
+func NewFlateCompressor(level int) (Compressor, error) {
+	// 提前校验压缩级别
+	if _, err := flate.NewWriter(io.Discard, level); err != nil {
+		return nil, err
+	}
+	return &flateCompressor{level: level}, nil
+}
+
+func (fc *flateCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, ok := fc.writers.Get().(*flate.Writer)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		w, _ = flate.NewWriter(&buf, fc.level)
+	}
+	defer fc.writers.Put(w)
+
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (fc *flateCompressor) Decompress(src []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// gzipCompressor 使用标准库 compress/gzip 进行压缩
+type gzipCompressor struct {
+	level   int
+	writers sync.Pool
+}
+
+// NewGzipCompressor 初始化 gzip 压缩算法，level 取值参考 compress/gzip
+func NewGzipCompressor(level int) (Compressor, error) {
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		return nil, err
+	}
+	return &gzipCompressor{level: level}, nil
+}
+
+func (gc *gzipCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, ok := gc.writers.Get().(*gzip.Writer)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		w, _ = gzip.NewWriterLevel(&buf, gc.level)
+	}
+	defer gc.writers.Put(w)
+
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gc *gzipCompressor) Decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
@@ -6,17 +6,23 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
+	"os"
 	"path/filepath"
+	"sync/atomic"
 )
 
 var (
-	ErrInvalidCRC = errors.New("invalid crc value, log record maybe corrupted")
+	ErrInvalidCRC          = errors.New("invalid crc value, log record maybe corrupted")
+	ErrIncompleteLogRecord = errors.New("incomplete log record, the file maybe truncated")
 )
 
 const (
 	DataFileNameSuffix    = ".data"
 	HintFileName          = "hint-index"
 	MergeFinishedFileName = "merge-finished"
+	SeqNoFileName         = "seq-no"
+	EpochFileName         = "replication-epoch"
+	ReclaimSizeFileName   = "reclaim-size"
 )
 
 // DataFile 数据文件
@@ -24,30 +30,56 @@ type DataFile struct {
 	FileId    uint32        // 文件id
 	WriteOff  int64         // 文件写到了哪个位置
 	IoManager fio.IOManager // io读写管理
+	Codec     *Codec        // 读取数据时对 LogRecord 进行还原，为 nil 表示数据没有经过转换
+	ioType    fio.FileIOType
+	syncedOff int64 // 已经持久化的位置，原子地读写
 }
 
 // OpenDataFile 打开新的数据文件
-func OpenDataFile(dirPath string, fileId uint32) (*DataFile, error) {
+func OpenDataFile(dirPath string, fileId uint32, ioType fio.FileIOType) (*DataFile, error) {
 	// 根据 path 和 id 生成完整的文件名称
-	fileName := filepath.Join(dirPath, fmt.Sprintf("%09d", fileId)+DataFileNameSuffix)
-	return newDataFile(fileName, fileId)
+	fileName := GetDataFileName(dirPath, fileId)
+	return newDataFile(fileName, fileId, ioType)
+}
+
+// GetDataFileName 根据目录和文件 id 获取数据文件的完整路径
+func GetDataFileName(dirPath string, fileId uint32) string {
+	return filepath.Join(dirPath, fmt.Sprintf("%09d", fileId)+DataFileNameSuffix)
 }
 
 // OpenHintFile 打开 hint 索引文件
 func OpenHintFile(dirPath string) (*DataFile, error) {
 	fileName := filepath.Join(dirPath, HintFileName)
-	return newDataFile(fileName, 0)
+	return newDataFile(fileName, 0, fio.StandardFIO)
 }
 
 // OpenMergeFinishedFile 打开标识 merge 完成的文件
 func OpenMergeFinishedFile(dirPath string) (*DataFile, error) {
 	fileName := filepath.Join(dirPath, MergeFinishedFileName)
-	return newDataFile(fileName, 0)
+	return newDataFile(fileName, 0, fio.StandardFIO)
+}
+
+// OpenSeqNoFile 打开存储事务序列号的文件
+func OpenSeqNoFile(dirPath string) (*DataFile, error) {
+	fileName := filepath.Join(dirPath, SeqNoFileName)
+	return newDataFile(fileName, 0, fio.StandardFIO)
+}
+
+// OpenReclaimSizeFile 打开存储可回收数据量的文件
+func OpenReclaimSizeFile(dirPath string) (*DataFile, error) {
+	fileName := filepath.Join(dirPath, ReclaimSizeFileName)
+	return newDataFile(fileName, 0, fio.StandardFIO)
 }
 
-func newDataFile(fileName string, fileId uint32) (*DataFile, error) {
+// OpenEpochFile 打开存储复制 epoch 的文件
+func OpenEpochFile(dirPath string) (*DataFile, error) {
+	fileName := filepath.Join(dirPath, EpochFileName)
+	return newDataFile(fileName, 0, fio.StandardFIO)
+}
+
+func newDataFile(fileName string, fileId uint32, ioType fio.FileIOType) (*DataFile, error) {
 	// 初始化 IOManager 管理器接口
-	ioManager, err := fio.NewIOManager(fileName)
+	ioManager, err := fio.NewIOManager(fileName, ioType)
 	if err != nil {
 		return nil, err
 	}
@@ -55,51 +87,31 @@ func newDataFile(fileName string, fileId uint32) (*DataFile, error) {
 		FileId:    fileId,
 		WriteOff:  0,
 		IoManager: ioManager,
+		ioType:    ioType,
 	}, nil
 }
 
 // ReadLogRecord 根据 offset 从数据文件中读取 LogRecord
+// 记录只写入了一部分（例如写入过程中崩溃）时返回 ErrIncompleteLogRecord
+// 校验值不正确时返回 ErrInvalidCRC，以及 header 中记录的长度，便于跳过这条记录
 func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
-	// 拿到当前文件的大小
-	size, err := df.IoManager.Size()
-	if err != nil {
-		return nil, 0, err
-	}
-
-	// 如果读取的最大 header 长度已经超过了文件的长度，则只需读取到文件的末尾即可
-	var headerBytes int64 = maxLongRecordHeaderSize
-	if offset+maxLongRecordHeaderSize > size {
-		headerBytes = size - offset
-	}
-
-	// 读取 Header 信息
-	headerBuf, err := df.readNBytes(headerBytes, offset)
+	header, headerBuf, headerSize, err := df.readLogRecordHeader(offset)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	// 对 Header 信息进行解码
-	header, headerSize := decodeLogRecordHeader(headerBuf)
-
-	// 读取到了文件的末尾，直接返回EOF
-	if header == nil {
-		return nil, 0, io.EOF
-	}
-
-	// 如果读取到的文件的校验值为0，也认为读到了末尾，直接进行返回
-	if header.crc == 0 && header.keySize == 0 && header.valueSize == 0 {
-		return nil, 0, io.EOF
-	}
-
 	// 取出对应的 key 和 value 的长度
 	keySize, valueSize := int64(header.keySize), int64(header.valueSize)
 	var recordSize = headerSize + keySize + valueSize
 
 	// 定义 logRecord 结构体
-	logRecord := &LogRecord{Type: header.recordType}
+	logRecord := &LogRecord{Type: header.recordType, Expire: header.expire}
 	// 开始读取用户实际存储的 key/value 数据
 	if keySize > 0 || valueSize > 0 {
 		KVBuf, err := df.readNBytes(keySize+valueSize, offset+headerSize)
+		if err == io.EOF {
+			return nil, 0, ErrIncompleteLogRecord
+		}
 		if err != nil {
 			return nil, 0, err
 		}
@@ -113,12 +125,67 @@ func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 	// 校验对应的数据的 crc 是否正确
 	crc := getLogRecordCRC(logRecord, headerBuf[crc32.Size:headerSize])
 	if crc != header.crc {
-		return nil, 0, ErrInvalidCRC
+		return nil, recordSize, ErrInvalidCRC
+	}
+
+	// 对加密和压缩的数据进行还原
+	if err := df.Codec.decodeLogRecord(logRecord, header, headerBuf[crc32.Size:headerSize]); err != nil {
+		return nil, 0, err
 	}
 
 	return logRecord, recordSize, nil
 }
 
+// ReadLogRecordSize 只解析 offset 处记录的 header，返回记录的长度，不读取 key/value，也不校验 crc 和解码
+// 读取到文件末尾时返回 io.EOF，header 不完整或者损坏时返回的错误和 ReadLogRecord 一致
+func (df *DataFile) ReadLogRecordSize(offset int64) (int64, error) {
+	header, _, headerSize, err := df.readLogRecordHeader(offset)
+	if err != nil {
+		return 0, err
+	}
+	return headerSize + int64(header.keySize) + int64(header.valueSize), nil
+}
+
+// 读取并解码 offset 处的 header，返回 header、读取到的原始数据以及 header 的长度
+func (df *DataFile) readLogRecordHeader(offset int64) (*logRecordHeader, []byte, int64, error) {
+	// 读取 Header 信息
+	// 如果读取的最大 header 长度已经超过了文件的长度，则只会读取到文件的末尾，不需要事先获取文件的大小
+	headerBuf, err := df.readNBytes(maxLongRecordHeaderSize, offset)
+	if err != nil && err != io.EOF {
+		return nil, nil, 0, err
+	}
+
+	// 对 Header 信息进行解码
+	header, headerSize := decodeLogRecordHeader(headerBuf)
+
+	// 读取到了文件的末尾，直接返回EOF
+	if header == nil {
+		if len(headerBuf) == 0 {
+			return nil, nil, 0, io.EOF
+		}
+		// header 没有完整地写入
+		if len(headerBuf) < maxLongRecordHeaderSize {
+			return nil, nil, 0, ErrIncompleteLogRecord
+		}
+		return nil, nil, 0, ErrInvalidCRC
+	}
+
+	// 如果读取到的文件的校验值为0，也认为读到了末尾，直接进行返回
+	if header.crc == 0 && header.keySize == 0 && header.valueSize == 0 {
+		return nil, nil, 0, io.EOF
+	}
+	return header, headerBuf, headerSize, nil
+}
+
+// ReadRaw 从 offset 处读取 n 个字节的原始数据，不做解码，用于复制数据文件中的记录
+func (df *DataFile) ReadRaw(offset int64, n int64) ([]byte, error) {
+	b, err := df.readNBytes(n, offset)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
 func (df *DataFile) Write(buf []byte) error {
 	n, err := df.IoManager.Write(buf)
 	if err != nil {
@@ -128,20 +195,89 @@ func (df *DataFile) Write(buf []byte) error {
 	return nil
 }
 
+// WriteHintRecord 写入索引信息到 hint 文件中
+// 复用 LogRecord 的编码格式，key 为实际的 key，value 为编码后的位置信息，每条记录都带有 crc 校验值
+// 设置了 Codec 时，hint 记录同样会被加密
 func (df *DataFile) WriteHintRecord(key []byte, pos *LogRecordPos) error {
-	return nil
+	record := &LogRecord{
+		Key:   key,
+		Value: EncodeLogRecordPos(pos),
+	}
+	encRecord, _, err := df.Codec.EncodeLogRecord(record)
+	if err != nil {
+		return err
+	}
+	return df.Write(encRecord)
 }
 
+// Sync 持久化数据文件，调用方需要保证这期间没有并发的写入
 func (df *DataFile) Sync() error {
-	return df.IoManager.Sync()
+	return df.SyncUntil(df.WriteOff)
+}
+
+// SyncUntil 持久化数据文件，并将 off 记录为已经持久化的位置
+// off 为持久化之前读取到的 WriteOff，用于持久化期间可能有并发写入的场景
+func (df *DataFile) SyncUntil(off int64) error {
+	if err := df.IoManager.Sync(); err != nil {
+		return err
+	}
+	for {
+		synced := atomic.LoadInt64(&df.syncedOff)
+		if off <= synced || atomic.CompareAndSwapInt64(&df.syncedOff, synced, off) {
+			return nil
+		}
+	}
+}
+
+// SyncedOff 已经持久化的位置，宕机之后这个位置之前的数据不会丢失
+func (df *DataFile) SyncedOff() int64 {
+	return atomic.LoadInt64(&df.syncedOff)
 }
 
 func (df *DataFile) Close() error {
 	return df.IoManager.Close()
 }
 
+// Truncate 将数据文件截断到指定的大小，用于丢弃文件末尾损坏的数据
+// 截断之前先关闭文件，避免访问内存映射中已经被截掉的部分（SIGBUS），截断之后使用相同的 IO 类型重新打开
+func (df *DataFile) Truncate(dirPath string, size int64) error {
+	if err := df.IoManager.Close(); err != nil {
+		return err
+	}
+	fileName := GetDataFileName(dirPath, df.FileId)
+	truncateErr := os.Truncate(fileName, size)
+	ioManager, err := fio.NewIOManager(fileName, df.ioType)
+	if err != nil {
+		return err
+	}
+	df.IoManager = ioManager
+	if truncateErr != nil {
+		return truncateErr
+	}
+	df.WriteOff = size
+	if df.SyncedOff() > size {
+		atomic.StoreInt64(&df.syncedOff, size)
+	}
+	return nil
+}
+
+// SetIOManager 切换数据文件的 IO 类型
+func (df *DataFile) SetIOManager(dirPath string, ioType fio.FileIOType) error {
+	if err := df.IoManager.Close(); err != nil {
+		return err
+	}
+	ioManager, err := fio.NewIOManager(GetDataFileName(dirPath, df.FileId), ioType)
+	if err != nil {
+		return err
+	}
+	df.IoManager = ioManager
+	df.ioType = ioType
+	return nil
+}
+
+// readNBytes 从 offset 处读取 n 个字节，如果读到了文件末尾，返回实际读到的数据和 io.EOF
 func (df *DataFile) readNBytes(n int64, offset int64) (b []byte, err error) {
 	b = make([]byte, n)
-	_, err = df.IoManager.Read(b, offset)
-	return
+	m, err := df.IoManager.Read(b, offset)
+	return b[:m], err
 }
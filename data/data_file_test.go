@@ -1,29 +1,31 @@
 package data
 
 import (
+	"KV-go/fio"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"os"
 	"testing"
 )
 
 func TestOpenDataFile(t *testing.T) {
-	dataFile, err := OpenDataFile(os.TempDir(), 0)
+	dataFile, err := OpenDataFile(os.TempDir(), 0, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile)
 
 	//t.Log(os.TempDir())
 
-	dataFile2, err := OpenDataFile(os.TempDir(), 111)
+	dataFile2, err := OpenDataFile(os.TempDir(), 111, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile2)
 
-	dataFile3, err := OpenDataFile(os.TempDir(), 111)
+	dataFile3, err := OpenDataFile(os.TempDir(), 111, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile3)
 }
 
 func TestDataFile_Write(t *testing.T) {
-	dataFile, err := OpenDataFile(os.TempDir(), 0)
+	dataFile, err := OpenDataFile(os.TempDir(), 0, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile)
 
@@ -38,7 +40,7 @@ func TestDataFile_Write(t *testing.T) {
 }
 
 func TestDataFile_Close(t *testing.T) {
-	dataFile, err := OpenDataFile(os.TempDir(), 0)
+	dataFile, err := OpenDataFile(os.TempDir(), 0, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile)
 
@@ -50,7 +52,7 @@ func TestDataFile_Close(t *testing.T) {
 }
 
 func TestDataFile_Sync(t *testing.T) {
-	dataFile, err := OpenDataFile(os.TempDir(), 456)
+	dataFile, err := OpenDataFile(os.TempDir(), 456, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile)
 
@@ -62,7 +64,7 @@ func TestDataFile_Sync(t *testing.T) {
 }
 
 func TestDataFile_ReadLogRecord(t *testing.T) {
-	dataFile, err := OpenDataFile(os.TempDir(), 233)
+	dataFile, err := OpenDataFile(os.TempDir(), 233, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile)
 
@@ -110,3 +112,122 @@ func TestDataFile_ReadLogRecord(t *testing.T) {
 	assert.Equal(t, rec3, readRec3)
 	assert.Equal(t, size3, readSize3)
 }
+
+func TestDataFile_WriteHintRecord(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-hint")
+	defer os.RemoveAll(dir)
+	hintFile, err := OpenHintFile(dir)
+	assert.Nil(t, err)
+	assert.NotNil(t, hintFile)
+
+	pos1 := &LogRecordPos{Fid: 1, Offset: 100}
+	err = hintFile.WriteHintRecord([]byte("name"), pos1)
+	assert.Nil(t, err)
+	pos2 := &LogRecordPos{Fid: 3, Offset: 4096}
+	err = hintFile.WriteHintRecord([]byte("age"), pos2)
+	assert.Nil(t, err)
+
+	rec1, size1, err := hintFile.ReadLogRecord(0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("name"), rec1.Key)
+	assert.Equal(t, pos1, DecodeLogRecordPos(rec1.Value))
+
+	rec2, _, err := hintFile.ReadLogRecord(size1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("age"), rec2.Key)
+	assert.Equal(t, pos2, DecodeLogRecordPos(rec2.Value))
+
+	err = hintFile.Close()
+	assert.Nil(t, err)
+}
+
+func TestDataFile_SetIOManager(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-mmap")
+	defer os.RemoveAll(dir)
+	dataFile, err := OpenDataFile(dir, 0, fio.StandardFIO)
+	assert.Nil(t, err)
+
+	rec1 := &LogRecord{Key: []byte("name"), Value: []byte("bitcask kv go")}
+	res1, size1 := EncodeLogRecord(rec1)
+	err = dataFile.Write(res1)
+	assert.Nil(t, err)
+
+	// 切换为内存映射之后读取
+	err = dataFile.SetIOManager(dir, fio.MemoryMap)
+	assert.Nil(t, err)
+	readRec1, readSize1, err := dataFile.ReadLogRecord(0)
+	assert.Nil(t, err)
+	assert.Equal(t, rec1, readRec1)
+	assert.Equal(t, size1, readSize1)
+	_, _, err = dataFile.ReadLogRecord(size1)
+	assert.Equal(t, io.EOF, err)
+
+	// 切换回标准文件 IO 之后可以继续写入
+	err = dataFile.SetIOManager(dir, fio.StandardFIO)
+	assert.Nil(t, err)
+	err = dataFile.Write(res1)
+	assert.Nil(t, err)
+	_, readSize2, err := dataFile.ReadLogRecord(size1)
+	assert.Nil(t, err)
+	assert.Equal(t, size1, readSize2)
+	assert.Nil(t, dataFile.Close())
+}
+
+func TestDataFile_ReadLogRecord_Incomplete(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-incomplete")
+	defer os.RemoveAll(dir)
+	dataFile, err := OpenDataFile(dir, 0, fio.StandardFIO)
+	assert.Nil(t, err)
+
+	rec := &LogRecord{Key: []byte("name"), Value: []byte("bitcask kv go")}
+	res, size := EncodeLogRecord(rec)
+	assert.Nil(t, dataFile.Write(res))
+
+	// header 只写入了一部分
+	assert.Nil(t, dataFile.Write(res[:3]))
+	_, _, err = dataFile.ReadLogRecord(size)
+	assert.Equal(t, ErrIncompleteLogRecord, err)
+
+	// value 只写入了一部分
+	assert.Nil(t, dataFile.Truncate(dir, size))
+	assert.Equal(t, size, dataFile.WriteOff)
+	assert.Nil(t, dataFile.Write(res[:len(res)-2]))
+	_, _, err = dataFile.ReadLogRecord(size)
+	assert.Equal(t, ErrIncompleteLogRecord, err)
+
+	// 校验值错误时返回记录的长度
+	assert.Nil(t, dataFile.Truncate(dir, size))
+	corrupted := append([]byte{}, res...)
+	corrupted[len(corrupted)-1] ^= 0xFF
+	assert.Nil(t, dataFile.Write(corrupted))
+	_, readSize, err := dataFile.ReadLogRecord(size)
+	assert.Equal(t, ErrInvalidCRC, err)
+	assert.Equal(t, size, readSize)
+	assert.Nil(t, dataFile.Close())
+}
+
+func TestDataFile_Truncate_MMap(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-truncate-mmap")
+	defer os.RemoveAll(dir)
+	dataFile, err := OpenDataFile(dir, 0, fio.StandardFIO)
+	assert.Nil(t, err)
+
+	rec := &LogRecord{Key: []byte("name"), Value: []byte("bitcask kv go")}
+	res, size := EncodeLogRecord(rec)
+	assert.Nil(t, dataFile.Write(res))
+	assert.Nil(t, dataFile.Write(res))
+
+	// 使用内存映射打开时截断，之后读取截掉的部分不会访问失效的映射
+	assert.Nil(t, dataFile.SetIOManager(dir, fio.MemoryMap))
+	assert.Nil(t, dataFile.Truncate(dir, size))
+	assert.Equal(t, size, dataFile.WriteOff)
+	readRec, _, err := dataFile.ReadLogRecord(0)
+	assert.Nil(t, err)
+	assert.Equal(t, rec, readRec)
+	_, _, err = dataFile.ReadLogRecord(size)
+	assert.Equal(t, io.EOF, err)
+	ioSize, err := dataFile.IoManager.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, size, ioSize)
+	assert.Nil(t, dataFile.Close())
+}
@@ -3,6 +3,7 @@ package data
 import (
 	"encoding/binary"
 	"hash/crc32"
+	"time"
 )
 
 type LogRecordType = byte
@@ -13,17 +14,26 @@ const (
 	LogRecordTxnFinished
 )
 
-// crc type keySize valueSize
+// type 字节的低四位存储 LogRecord 的类型，高位用作标识位
+const (
+	logRecordTypeMask     byte = 0x0F
+	logRecordExpireFlag   byte = 1 << 7 // header 中带有过期时间
+	logRecordCompressFlag byte = 1 << 6 // value 经过了压缩
+	logRecordEncryptFlag  byte = 1 << 5 // key 和 value 经过了加密
+)
+
+// crc type keySize valueSize expire
 //
-//	4 +  1  +  5   +   5   =   15
-const maxLongRecordHeaderSize = binary.MaxVarintLen32*2 + 5
+//	4 +  1  +  5   +   5   +  10   =   25
+const maxLongRecordHeaderSize = binary.MaxVarintLen32*2 + binary.MaxVarintLen64 + 5
 
 // LogRecord 写入到数据文件的记录
 // 之所以叫日志，是因为数据文件中数据是追加写入的，类似日志的格式
 type LogRecord struct {
-	Key   []byte
-	Value []byte
-	Type  LogRecordType
+	Key    []byte
+	Value  []byte
+	Type   LogRecordType
+	Expire int64 // 过期时间，UnixNano 时间戳，为 0 表示永不过期
 }
 
 type logRecordHeader struct {
@@ -31,12 +41,27 @@ type logRecordHeader struct {
 	recordType LogRecordType // 标识 LogRecord 的类型
 	keySize    uint32        // key 的长度
 	valueSize  uint32        // value 的长度
+	expire     int64         // 过期时间
+	compressed bool          // value 是否经过了压缩
+	encrypted  bool          // key 和 value 是否经过了加密
 }
 
 // LogRecordPos 数据内存索引，主要是描述数据在硬盘上的位置
 type LogRecordPos struct {
 	Fid    uint32 // 文件id，表示将数据存到了哪个文件当中
 	Offset int64  // 偏移，表示将数据存储到文件的哪个位置
+	Size   uint32 // 标识数据在磁盘上的大小
+	Expire int64  // 过期时间，为 0 表示永不过期
+}
+
+// IsExpired 数据是否已经过期
+func (pos *LogRecordPos) IsExpired() bool {
+	return IsExpired(pos.Expire)
+}
+
+// IsExpired 判断过期时间是否已经到达，为 0 表示永不过期
+func IsExpired(expire int64) bool {
+	return expire > 0 && expire <= time.Now().UnixNano()
 }
 
 // TransactionRecord 暂存的事务相关的数据
@@ -46,21 +71,22 @@ type TransactionRecord struct {
 }
 
 // EncodeLogRecord 对 LogRecord 进行编码、返回字节数组及长度
-// +--------+--------+--------+----------+--------+--------+
-// | crc    | type   | key sz | value sz | key    | value  |
-// +--------+--------+--------+----------+--------+--------+
+// +--------+--------+--------+----------+----------+--------+--------+
+// | crc    | type   | key sz | value sz | expire   | key    | value  |
+// +--------+--------+--------+----------+----------+--------+--------+
+//
+//	4字节    1字节     变长（最大是5）  变长（最大是10，可选）   变长      变长
 //
-//	4字节    1字节     变长（最大是5）        变长      变长
+// 只有设置了过期时间的记录才会写入 expire，并在 type 中打上标识，value 经过压缩或者加密时同样会打上标识
 func EncodeLogRecord(logRecord *LogRecord) ([]byte, int64) {
-	// 初始化一个 header 部分的字节切片
-	header := make([]byte, maxLongRecordHeaderSize)
+	return encodeLogRecord(logRecord, 0)
+}
 
-	// 第五个字节存储 Type
-	header[4] = logRecord.Type
-	var index = 5
-	// 五字节之后存储的是 key 和 value 的长度信息
-	index += binary.PutVarint(header[index:], int64(len(logRecord.Key)))
-	index += binary.PutVarint(header[index:], int64(len(logRecord.Value)))
+// flags 为额外需要在 type 中打上的标识
+func encodeLogRecord(logRecord *LogRecord, flags byte) ([]byte, int64) {
+	// 初始化 header 部分的字节切片，前四个字节留给 crc
+	header := encodeLogRecordHeader(logRecord.Type|flags, len(logRecord.Key), len(logRecord.Value), logRecord.Expire)
+	var index = len(header)
 
 	var size = index + len(logRecord.Key) + len(logRecord.Value)
 	encBytes := make([]byte, size)
@@ -81,7 +107,27 @@ func EncodeLogRecord(logRecord *LogRecord) ([]byte, int64) {
 	return encBytes, int64(size)
 }
 
+// 对 crc 之外的 Header 信息进行编码，返回的字节数组中前四个字节留给 crc
+func encodeLogRecordHeader(recordType byte, keySize, valueSize int, expire int64) []byte {
+	header := make([]byte, maxLongRecordHeaderSize)
+
+	// 第五个字节存储 Type
+	header[4] = recordType
+	if expire > 0 {
+		header[4] |= logRecordExpireFlag
+	}
+	var index = 5
+	// 五字节之后存储的是 key 和 value 的长度信息
+	index += binary.PutVarint(header[index:], int64(keySize))
+	index += binary.PutVarint(header[index:], int64(valueSize))
+	if expire > 0 {
+		index += binary.PutVarint(header[index:], expire)
+	}
+	return header[:index]
+}
+
 // 对字节数组中的 Header 信息进行解码，返回 Header 信息和 Header 的长度信息（CRC 加上变长的 Size）
+// 数据不足以解析出完整的 Header 时返回 nil
 func decodeLogRecordHeader(buf []byte) (*logRecordHeader, int64) {
 	if len(buf) <= 4 {
 		return nil, 0
@@ -89,23 +135,75 @@ func decodeLogRecordHeader(buf []byte) (*logRecordHeader, int64) {
 
 	header := &logRecordHeader{
 		crc:        binary.LittleEndian.Uint32(buf[:4]),
-		recordType: buf[4],
+		recordType: buf[4] & logRecordTypeMask,
+		compressed: buf[4]&logRecordCompressFlag != 0,
+		encrypted:  buf[4]&logRecordEncryptFlag != 0,
 	}
 
 	var index = 5
 	// 取出实际的 key size
 	keySize, n := binary.Varint(buf[index:])
+	if n <= 0 {
+		return nil, 0
+	}
 	header.keySize = uint32(keySize)
 	index += n
 
 	// 取出实际的 value size
 	valueSize, n := binary.Varint(buf[index:])
+	if n <= 0 {
+		return nil, 0
+	}
 	header.valueSize = uint32(valueSize)
 	index += n
 
+	// 取出过期时间
+	if buf[4]&logRecordExpireFlag != 0 {
+		expire, n := binary.Varint(buf[index:])
+		if n <= 0 {
+			return nil, 0
+		}
+		header.expire = expire
+		index += n
+	}
+
 	return header, int64(index)
 }
 
+// EncodeLogRecordPos 对位置信息进行编码
+// +--------+----------+--------+----------+
+// | fid    | offset   | size   | expire   |
+// +--------+----------+--------+----------+
+//
+//	变长（最大是5）  变长（最大是10）  变长（最大是5）  变长（最大是10）
+func EncodeLogRecordPos(pos *LogRecordPos) []byte {
+	buf := make([]byte, binary.MaxVarintLen32*2+binary.MaxVarintLen64*2)
+	var index = 0
+	index += binary.PutVarint(buf[index:], int64(pos.Fid))
+	index += binary.PutVarint(buf[index:], pos.Offset)
+	index += binary.PutVarint(buf[index:], int64(pos.Size))
+	index += binary.PutVarint(buf[index:], pos.Expire)
+	return buf[:index]
+}
+
+// DecodeLogRecordPos 解码 LogRecordPos
+func DecodeLogRecordPos(buf []byte) *LogRecordPos {
+	var index = 0
+	fileId, n := binary.Varint(buf[index:])
+	index += n
+	offset, n := binary.Varint(buf[index:])
+	index += n
+	size, n := binary.Varint(buf[index:])
+	index += n
+	expire, _ := binary.Varint(buf[index:])
+	return &LogRecordPos{
+		Fid:    uint32(fileId),
+		Offset: offset,
+		Size:   uint32(size),
+		Expire: expire,
+	}
+}
+
 func getLogRecordCRC(lr *LogRecord, header []byte) uint32 {
 	if lr == nil {
 		return 0
@@ -4,6 +4,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"hash/crc32"
 	"testing"
+	"time"
 )
 
 func TestEncodeLogRecord(t *testing.T) {
@@ -83,3 +84,46 @@ func TestGetLogRecordCRC(t *testing.T) {
 	crc2 := getLogRecordCRC(rec2, headerBuf2[crc32.Size:])
 	assert.Equal(t, crc2, uint32(240712713))
 }
+
+func TestEncodeLogRecordPos(t *testing.T) {
+	pos1 := &LogRecordPos{Fid: 1, Offset: 100}
+	buf1 := EncodeLogRecordPos(pos1)
+	assert.NotNil(t, buf1)
+	assert.Equal(t, pos1, DecodeLogRecordPos(buf1))
+
+	pos2 := &LogRecordPos{Fid: 123456, Offset: 256 * 1024 * 1024, Size: 4096}
+	buf2 := EncodeLogRecordPos(pos2)
+	assert.Equal(t, pos2, DecodeLogRecordPos(buf2))
+
+	pos3 := &LogRecordPos{Fid: 0, Offset: 0}
+	buf3 := EncodeLogRecordPos(pos3)
+	assert.Equal(t, pos3, DecodeLogRecordPos(buf3))
+}
+
+func TestEncodeLogRecord_Expire(t *testing.T) {
+	expire := time.Now().Add(time.Hour).UnixNano()
+	rec := &LogRecord{
+		Key:    []byte("name"),
+		Value:  []byte("bitcask-go"),
+		Type:   LogRecordNormal,
+		Expire: expire,
+	}
+	buf, n := EncodeLogRecord(rec)
+	header, headerSize := decodeLogRecordHeader(buf)
+	assert.NotNil(t, header)
+	assert.Equal(t, LogRecordNormal, header.recordType)
+	assert.Equal(t, expire, header.expire)
+	assert.Equal(t, n, headerSize+int64(len(rec.Key)+len(rec.Value)))
+	assert.Equal(t, header.crc, getLogRecordCRC(rec, buf[crc32.Size:headerSize]))
+
+	// 没有过期时间的记录不写入 expire
+	rec.Expire = 0
+	_, n2 := EncodeLogRecord(rec)
+	assert.Less(t, n2, n)
+
+	assert.False(t, IsExpired(0))
+	assert.False(t, IsExpired(expire))
+	assert.True(t, IsExpired(time.Now().Add(-time.Second).UnixNano()))
+	pos := &LogRecordPos{Fid: 1, Offset: 10, Size: 20, Expire: expire}
+	assert.Equal(t, pos, DecodeLogRecordPos(EncodeLogRecordPos(pos)))
+}
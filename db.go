@@ -2,26 +2,64 @@ package kv_go
 
 import (
 	"KV-go/data"
+	"KV-go/fio"
 	"KV-go/index"
+	"KV-go/utils"
 	"errors"
+	"github.com/gofrs/flock"
 	"io"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+)
+
+const (
+	seqNoKey            = "seq.no"
+	reclaimSizeKey      = "reclaim.size"
+	recordFileTmpSuffix = ".tmp"
+	fileLockName        = "flock"
 )
 
 // DB bitcask 存储引擎实例
 type DB struct {
-	option     Options
-	mu         *sync.RWMutex
-	fileIds    []int                     // 只用于在加载内存索引时使用
-	activeFile *data.DataFile            // 当前的活跃文件
-	olderFiles map[uint32]*data.DataFile // 旧的数据文件，只能用来读
-	index      index.Indexer
-	seqNo      uint64 // 事务序列号，全局递增
-	isMerging  bool   // 是否正在 Merge
+	option            Options
+	mu                *sync.RWMutex
+	fileIds           []int                     // 只用于在加载内存索引时使用
+	activeFile        *data.DataFile            // 当前的活跃文件
+	olderFiles        map[uint32]*data.DataFile // 旧的数据文件，只能用来读
+	index             index.Indexer
+	seqNo             uint64                               // 事务序列号，全局递增
+	isMerging         bool                                 // 是否正在 Merge
+	fileLock          *flock.Flock                         // 文件锁，保证多进程之间的互斥
+	reclaimSize       int64                                // 表示有多少数据是无效的，可以被 merge 回收
+	mergedReclaimSize int64                                // 已经 merge 完成，等待下次启动时清理的无效数据量
+	closeCh           chan struct{}                        // 关闭数据库时通知后台任务退出
+	bgWg              *sync.WaitGroup                      // 等待后台任务退出
+	persistentIndex   bool                                 // 索引是否持久化在磁盘上，启动时只需要重放最后应用的位置之后的数据
+	codec             *data.Codec                          // 数据文件中 LogRecord 的编解码，为 nil 表示不做转换
+	recovery          RecoveryReport                       // 启动时对损坏数据的处理结果
+	oracle            *oracle                              // 事务的快照读和冲突检测
+	committer         *groupCommitter                      // 合并并发的写入，开启 SyncWrites 时一批写入只持久化一次
+	unsyncedBytes     int64                                // 上一次后台持久化之后写入的数据量
+	syncCh            chan struct{}                        // 通知后台任务持久化活跃文件，没有开启后台持久化时为 nil
+	cache             *valueCache                          // value 的读缓存，为 nil 表示不使用缓存
+	appendCh          chan struct{}                        // 活跃文件写入新的数据时关闭，通知等待复制的 follower
+	pendingTxnRecords map[uint64][]*data.TransactionRecord // follower 上已经复制过来但还没有完成的事务数据
+	replicationEpoch  uint64                               // 数据文件的 epoch，merge 重写数据文件之后加一，follower 和 primary 保持一致
+}
+
+// Stat 存储引擎统计信息
+type Stat struct {
+	KeyNum          uint   // key 的总数量
+	DataFileNum     uint   // 数据文件的数量
+	ReclaimableSize int64  // 可以进行 merge 回收的数据量，字节为单位
+	DiskSize        int64  // 数据目录所占磁盘空间大小
+	CacheHits       uint64 // 读缓存命中的次数
+	CacheMisses     uint64 // 读缓存没有命中的次数
 }
 
 // Open 打开 bitcask 存储引擎实例
@@ -31,6 +69,12 @@ func Open(options Options) (*DB, error) {
 		return nil, err
 	}
 
+	// 初始化数据的压缩和加密
+	codec, err := data.NewCodec(options.Compressor, options.CompressThreshold, options.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
 	// 对用传进来的目录进行校验，不存在则创建该目录
 	if _, err := os.Stat(options.DirPath); os.IsNotExist(err) {
 		// os.ModePerm: 权限777
@@ -39,35 +83,213 @@ func Open(options Options) (*DB, error) {
 		}
 	}
 
+	// 判断当前数据目录是否正在被其他进程使用
+	fileLock := flock.New(filepath.Join(options.DirPath, fileLockName))
+	hold, err := fileLock.TryLock()
+	if err != nil {
+		return nil, err
+	}
+	if !hold {
+		return nil, ErrDatabaseIsUsing
+	}
+
+	// B+ 树索引文件已经存在时，索引不需要从数据文件中重建
+	var persistentIndex bool
+	if options.IndexType == BPTree {
+		if _, err := os.Stat(filepath.Join(options.DirPath, index.BptreeIndexFileName)); err == nil {
+			persistentIndex = true
+		}
+	}
+
+	// 初始化索引，失败时释放文件锁
+	indexer, err := index.NewIndexer(options.IndexType, options.DirPath, options.SyncWrites)
+	if err != nil {
+		_ = fileLock.Unlock()
+		return nil, err
+	}
+
 	// 初始化数据结构，DB实例
 	db := &DB{
 		option:     options,
 		mu:         new(sync.RWMutex),
 		olderFiles: make(map[uint32]*data.DataFile),
-		index:      index.NewIndexer(options.IndexType),
+		index:      indexer,
+		fileLock:   fileLock,
+		closeCh:    make(chan struct{}),
+		bgWg:       new(sync.WaitGroup),
+		oracle:     newOracle(),
+		committer:  new(groupCommitter),
+		cache:      newValueCache(options.ValueCacheSize),
+
+		persistentIndex: persistentIndex,
+		codec:           codec,
 	}
 
-	// 加载对应的数据文件
-	if err := db.loadDataFiles(); err != nil {
+	// 加载数据文件和索引，失败时释放已经打开的资源，避免数据目录无法被再次打开
+	if err := db.load(); err != nil {
+		db.releaseResources()
 		return nil, err
 	}
 
-	// 从数据文件中加载索引
-	if err := db.loadIndexFromDataFiles(); err != nil {
-		return nil, err
+	// 启动后台自动 merge 的任务，只读的数据库不会进行 merge
+	if db.option.MergeRatio > 0 && !db.option.ReadOnly {
+		db.bgWg.Add(1)
+		go db.autoMerge()
+	}
+
+	// 启动后台清理过期 key 的任务
+	if db.option.ExpireCheckInterval > 0 {
+		db.bgWg.Add(1)
+		go db.removeExpiredKeysPeriodically()
+	}
+
+	// 启动后台持久化活跃文件的任务
+	if !db.option.SyncWrites && (db.option.BytesPerSync > 0 || db.option.SyncInterval > 0) {
+		db.syncCh = make(chan struct{}, 1)
+		db.bgWg.Add(1)
+		go db.syncPeriodically()
 	}
 
 	return db, nil
 }
 
+// 启动时加载 merge 的结果、数据文件以及内存索引
+func (db *DB) load() error {
+	// 加载 merge 数据目录
+	if err := db.loadMergeFiles(); err != nil {
+		return err
+	}
+
+	// 加载复制的 epoch，需要在 merge 的结果安装之后加载
+	if err := db.loadReplicationEpoch(); err != nil {
+		return err
+	}
+
+	// 加载对应的数据文件
+	if err := db.loadDataFiles(); err != nil {
+		return err
+	}
+
+	// B+ 树索引保存在磁盘上，只需要从上次应用到索引中的位置开始重放数据文件
+	// 索引文件不存在（例如从备份中恢复）或者和数据文件不一致时，从数据文件中重建索引
+	if db.persistentIndex {
+		if err := db.checkCodec(); err != nil {
+			return err
+		}
+		if err := db.loadSeqNo(); err != nil {
+			return err
+		}
+		if err := db.loadReclaimSize(); err != nil {
+			return err
+		}
+		ok, err := db.loadPersistentIndex()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if err := db.resetPersistentIndex(); err != nil {
+				return err
+			}
+		}
+	}
+	if !db.persistentIndex {
+		// 从 hint 索引文件中加载索引
+		if err := db.loadIndexFromHintFile(); err != nil {
+			return err
+		}
+		// 从数据文件中加载索引
+		if err := db.loadIndexFromDataFiles(); err != nil {
+			return err
+		}
+	}
+
+	// 记录已经应用到持久化索引中的位置
+	if batchIndex, ok := db.index.(index.BatchIndexer); ok {
+		if err := db.saveAppliedPosition(); err != nil {
+			return err
+		}
+		if err := batchIndex.Sync(); err != nil {
+			return err
+		}
+	}
+
+	// 启动时截断或者跳过了损坏的数据，primary 上的数据文件和已经复制出去的数据可能不一致，follower 需要重新复制
+	if !db.option.ReadOnly && (db.recovery.TruncatedFiles > 0 || db.recovery.SkippedRecords > 0) {
+		if err := saveReplicationEpoch(db.option.DirPath, db.replicationEpoch+1); err != nil {
+			return err
+		}
+		db.replicationEpoch++
+	}
+
+	// 上一次运行时没有持久化的数据可能还在操作系统的缓存中，先持久化，之后才能被复制
+	if db.activeFile != nil {
+		if err := db.activeFile.Sync(); err != nil {
+			return err
+		}
+	}
+
+	// 活跃文件需要写入数据，重置为标准文件 IO
+	if db.option.MMapAtStartup {
+		if err := db.resetIoType(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 打开数据库失败时关闭索引和数据文件，并释放文件锁
+func (db *DB) releaseResources() {
+	_ = db.index.Close()
+	if db.activeFile != nil {
+		_ = db.activeFile.Close()
+	}
+	for _, dataFile := range db.olderFiles {
+		_ = dataFile.Close()
+	}
+	_ = db.fileLock.Unlock()
+}
+
 // Close 关闭数据库
 func (db *DB) Close() error {
+	defer func() {
+		// 释放文件锁
+		_ = db.fileLock.Unlock()
+	}()
+	// 通知后台任务退出，并等待其结束
+	select {
+	case <-db.closeCh:
+	default:
+		close(db.closeCh)
+	}
+	db.bgWg.Wait()
+
 	if db.activeFile == nil {
-		return nil
+		return db.index.Close()
 	}
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
+	// B+ 树索引在启动时只重放数据文件的末尾，需要保存当前的事务序列号和可回收的数据量
+	if db.option.IndexType == BPTree {
+		if err := db.saveSeqNo(); err != nil {
+			return err
+		}
+		if err := db.saveReclaimSize(); err != nil {
+			return err
+		}
+	}
+
+	// 持久化活跃文件中还没有持久化的数据，之后再持久化并关闭索引
+	if err := db.activeFile.Sync(); err != nil {
+		return err
+	}
+	if err := db.syncIndex(); err != nil {
+		return err
+	}
+	if err := db.index.Close(); err != nil {
+		return err
+	}
+
 	// 关闭所有的数据文件
 	if err := db.activeFile.Close(); err != nil {
 		return err
@@ -81,6 +303,87 @@ func (db *DB) Close() error {
 	return nil
 }
 
+// Stat 返回数据库的相关统计信息
+func (db *DB) Stat() (*Stat, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var dataFiles = uint(len(db.olderFiles))
+	if db.activeFile != nil {
+		dataFiles += 1
+	}
+
+	dirSize, err := utils.DirSize(db.option.DirPath)
+	if err != nil {
+		return nil, err
+	}
+	stat := &Stat{
+		KeyNum:          uint(db.index.Size()),
+		DataFileNum:     dataFiles,
+		ReclaimableSize: atomic.LoadInt64(&db.reclaimSize),
+		DiskSize:        dirSize,
+	}
+	if db.cache != nil {
+		stat.CacheHits, stat.CacheMisses = db.cache.stats()
+	}
+	return stat, nil
+}
+
+// Backup 备份数据库，将数据文件、hint 文件、merge 完成的标识文件和复制的 epoch 文件拷贝到新的目录中
+// 只在持锁期间记录需要备份的文件和活跃文件写入的位置，拷贝时不会阻塞写入，活跃文件只拷贝到记录的位置
+func (db *DB) Backup(dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	db.mu.RLock()
+	// 持久化当前活跃文件，再进行拷贝
+	var activeFileName string
+	var activeFileSize int64
+	if db.activeFile != nil {
+		if err := db.activeFile.Sync(); err != nil {
+			db.mu.RUnlock()
+			return err
+		}
+		activeFileName = filepath.Base(data.GetDataFileName(db.option.DirPath, db.activeFile.FileId))
+		activeFileSize = db.activeFile.WriteOff
+	}
+	dirEntries, err := os.ReadDir(db.option.DirPath)
+	db.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range dirEntries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, data.DataFileNameSuffix) &&
+			name != data.HintFileName && name != data.MergeFinishedFileName && name != data.EpochFileName {
+			continue
+		}
+		src := filepath.Join(db.option.DirPath, name)
+		dest := filepath.Join(dir, name)
+		if err := os.RemoveAll(dest); err != nil {
+			return err
+		}
+
+		// 备份开始之后活跃文件仍然会被写入，只拷贝到记录的位置
+		if name == activeFileName {
+			if err := utils.CopyFileN(src, dest, activeFileSize); err != nil {
+				return err
+			}
+			continue
+		}
+		// 旧的数据文件不会再被修改，优先使用硬链接，失败时（例如跨文件系统）再进行拷贝
+		if err := os.Link(src, dest); err == nil {
+			continue
+		}
+		if err := utils.CopyFile(src, dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Sync 方法用于将内存中的数据持久化到磁盘中
 func (db *DB) Sync() error {
 	if db.activeFile == nil {
@@ -88,11 +391,27 @@ func (db *DB) Sync() error {
 	}
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	return db.activeFile.Sync()
+	if err := db.activeFile.Sync(); err != nil {
+		return err
+	}
+	return db.syncIndex()
+}
+
+// 持久化索引，需要在持久化数据文件之后调用，避免索引中记录的位置超过已经持久化的数据
+func (db *DB) syncIndex() error {
+	if batchIndex, ok := db.index.(index.BatchIndexer); ok {
+		return batchIndex.Sync()
+	}
+	return nil
 }
 
 // Put 写入Key/Value 数据，Key不能为空
 func (db *DB) Put(key []byte, value []byte) error {
+	return db.put(key, value, 0)
+}
+
+// put 写入数据，expire 为过期时间，为 0 表示永不过期
+func (db *DB) put(key []byte, value []byte, expire int64) error {
 	// 判断key是否有效
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
@@ -100,23 +419,13 @@ func (db *DB) Put(key []byte, value []byte) error {
 
 	// 构造 LogRecord 结构体
 	log_record := &data.LogRecord{
-		Key:   logRecordKeyWithSeq(key, nonTransactionSeqNo),
-		Value: value,
-		Type:  data.LogRecordNormal,
-	}
-
-	// 追加写入到当前活跃的文件当中
-	pos, err := db.appendLogRecordWithLock(log_record)
-	if err != nil {
-		return err
+		Key:    logRecordKeyWithSeq(key, nonTransactionSeqNo),
+		Value:  value,
+		Type:   data.LogRecordNormal,
+		Expire: expire,
 	}
-
-	// 更新内存索引信息
-	if ok := db.index.Put(key, pos); !ok {
-		return ErrIndexUpdateFailed
-	}
-
-	return nil
+	_, err := db.write(&writeRequest{key: key, record: log_record})
+	return err
 }
 
 func (db *DB) Delete(key []byte) error {
@@ -124,27 +433,14 @@ func (db *DB) Delete(key []byte) error {
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
 	}
-	// 先检查 key 是否存在
-	if pos := db.index.Get(key); pos == nil {
-		return nil
-	}
+
 	// 构造 LogRecord, 标识被删除
 	logRecord := &data.LogRecord{
 		Key:  logRecordKeyWithSeq(key, nonTransactionSeqNo),
 		Type: data.LogRecordDeleted,
 	}
-	// 写入到数据文件
-	_, err := db.appendLogRecordWithLock(logRecord)
-	if err != nil {
-		return nil
-	}
-	// 将其从内存索引中删除
-	ok := db.index.Delete(key)
-	if !ok {
-		return ErrIndexUpdateFailed
-	}
-
-	return nil
+	_, err := db.write(&writeRequest{key: key, record: logRecord})
+	return err
 }
 
 // Get 根据 Key 读取数据
@@ -160,8 +456,8 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 	// 从内存数据结构中取出 key 对应的索引信息
 	logRecordPos := db.index.Get(key)
 
-	// 如果 key 不存在内存索引中，说明 key 不存在
-	if logRecordPos == nil {
+	// 如果 key 不存在内存索引中，或者已经过期，说明 key 不存在
+	if logRecordPos == nil || logRecordPos.IsExpired() {
 		return nil, ErrKeyNotFound
 	}
 
@@ -171,12 +467,18 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 
 // ListKeys 获取数据库中所有的 Key
 func (db *DB) ListKeys() [][]byte {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
 	iterator := db.index.Iterator(false)
-	keys := make([][]byte, db.index.Size())
-	var idx int
+	defer iterator.Close()
+	keys := make([][]byte, 0, db.index.Size())
 	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
-		keys[idx] = iterator.Key()
-		idx++
+		// 跳过已经过期的 key
+		if iterator.Value().IsExpired() {
+			continue
+		}
+		keys = append(keys, iterator.Key())
 	}
 	return keys
 }
@@ -187,7 +489,11 @@ func (db *DB) Fold(fn func(key []byte, value []byte) bool) error {
 	defer db.mu.RUnlock()
 
 	iterator := db.index.Iterator(false)
+	defer iterator.Close()
 	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		if iterator.Value().IsExpired() {
+			continue
+		}
 		key := iterator.Key()
 		value, err := db.getValueByPosition(iterator.Value())
 		if err != nil {
@@ -200,8 +506,39 @@ func (db *DB) Fold(fn func(key []byte, value []byte) bool) error {
 	return nil
 }
 
+// Scan 按照 key 的顺序遍历 [start, end) 范围内的数据，end 为空表示遍历到最后，函数返回 false 时终止遍历
+// 和 Fold 不同，遍历期间不会持有数据库的锁，fn 中可以写入数据，B+ 树索引分批读取，可能会看到 fn 中写入的范围内的 key
+func (db *DB) Scan(start, end []byte, fn func(key []byte, value []byte) bool) error {
+	iterator := db.NewIterator(IteratorOptions{LowerBound: start, UpperBound: end})
+	defer iterator.Close()
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		value, err := iterator.Value()
+		// 遍历期间过期的 key
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !fn(iterator.Key(), value) {
+			break
+		}
+	}
+	return nil
+}
+
 // 根据索引信息获取对应的Value
 func (db *DB) getValueByPosition(logRecordPos *data.LogRecordPos) ([]byte, error) {
+	// 先从读缓存中查找，缓存中只有没有被删除的数据
+	if db.cache != nil {
+		if value, ok := db.cache.get(logRecordPos); ok {
+			if data.IsExpired(logRecordPos.Expire) {
+				return nil, ErrKeyNotFound
+			}
+			return copyValue(value), nil
+		}
+	}
+
 	// 根据文件的 id 找到对应的数据文件
 	var dataFile *data.DataFile
 
@@ -221,14 +558,24 @@ func (db *DB) getValueByPosition(logRecordPos *data.LogRecordPos) ([]byte, error
 		return nil, err
 	}
 
-	// 判断logRecord的类型，是否是被删除
-	if logRecord.Type == data.LogRecordDeleted {
+	// 判断logRecord的类型，是否是被删除，或者已经过期
+	if logRecord.Type == data.LogRecordDeleted || data.IsExpired(logRecord.Expire) {
 		return nil, ErrKeyNotFound
 	}
 
+	// 缓存中保存一份拷贝，避免调用方修改返回的 value
+	if db.cache != nil {
+		db.cache.put(logRecordPos, copyValue(logRecord.Value))
+	}
 	return logRecord.Value, nil
 }
 
+func copyValue(value []byte) []byte {
+	dst := make([]byte, len(value))
+	copy(dst, value)
+	return dst
+}
+
 // appendLogRecord 追加写数据到活跃文件中
 func (db *DB) appendLogRecordWithLock(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
 	db.mu.Lock()
@@ -236,8 +583,24 @@ func (db *DB) appendLogRecordWithLock(logRecord *data.LogRecord) (*data.LogRecor
 	return db.appendLogRecord(logRecord)
 }
 
-// appendLogRecord 追加写数据到活跃文件中
+// appendLogRecord 追加写数据到活跃文件中，根据配置决定是否持久化
 func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
+	pos, err := db.writeLogRecord(logRecord)
+	if err != nil {
+		return nil, err
+	}
+
+	// 根据用户配置决定是否需要对数据进行持久化的操作
+	if db.option.SyncWrites {
+		if err := db.activeFile.Sync(); err != nil {
+			return nil, err
+		}
+	}
+	return pos, nil
+}
+
+// writeLogRecord 追加写数据到活跃文件中，不进行持久化，由调用方在写完一批数据之后统一持久化
+func (db *DB) writeLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
 
 	// 判断当前活跃的数据文件是否存在
 	// 如果为空则初始化数据文件
@@ -248,7 +611,10 @@ func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, er
 	}
 
 	// 写入数据编码
-	encRecord, size := data.EncodeLogRecord(logRecord)
+	encRecord, size, err := db.codec.EncodeLogRecord(logRecord)
+	if err != nil {
+		return nil, err
+	}
 	// 如果写入的数据已经到达额活跃文件的阈值，则关闭活跃文件，并打开新的文件
 	if db.activeFile.WriteOff+size > db.option.DataFileSize {
 		// 将当前活跃的文件持久化
@@ -269,18 +635,15 @@ func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, er
 	if err := db.activeFile.Write(encRecord); err != nil {
 		return nil, err
 	}
-
-	// 根据用户配置决定是否需要对数据进行持久化的操作
-	if db.option.SyncWrites {
-		if err := db.activeFile.Sync(); err != nil {
-			return nil, err
-		}
-	}
+	db.addUnsyncedBytes(size)
+	db.notifyAppend()
 
 	// 构造内存索引信息
 	pos := &data.LogRecordPos{
 		Fid:    db.activeFile.FileId,
 		Offset: writeOff,
+		Size:   uint32(size),
+		Expire: logRecord.Expire,
 	}
 
 	return pos, nil
@@ -294,10 +657,11 @@ func (db *DB) setActiveDataFile() error {
 		initialFiled = db.activeFile.FileId + 1
 	}
 	// 打开新的数据文件
-	dataFile, err := data.OpenDataFile(db.option.DirPath, initialFiled)
+	dataFile, err := data.OpenDataFile(db.option.DirPath, initialFiled, fio.StandardFIO)
 	if err != nil {
 		return err
 	}
+	dataFile.Codec = db.codec
 	db.activeFile = dataFile
 	return nil
 }
@@ -327,12 +691,19 @@ func (db *DB) loadDataFiles() error {
 	sort.Ints(fileIds)
 	db.fileIds = fileIds
 
+	// 启动时使用内存映射可以加快索引的加载
+	ioType := fio.StandardFIO
+	if db.option.MMapAtStartup {
+		ioType = fio.MemoryMap
+	}
+
 	// 遍历每个文件 id ，打开对应的数据文件
 	for i, fid := range fileIds {
-		dataFile, err := data.OpenDataFile(db.option.DirPath, uint32(fid))
+		dataFile, err := data.OpenDataFile(db.option.DirPath, uint32(fid), ioType)
 		if err != nil {
 			return err
 		}
+		dataFile.Codec = db.codec
 		if i == len(fileIds)-1 { // 最后一个，id是最大的，说明书当前活跃文件
 			db.activeFile = dataFile
 		} else { // 旧的数据
@@ -349,18 +720,21 @@ func (db *DB) loadIndexFromDataFiles() error {
 		return nil
 	}
 
-	updateIndex := func(key []byte, typ data.LogRecordType, pos *data.LogRecordPos) {
-		var ok bool
-		if typ == data.LogRecordDeleted {
-			ok = db.index.Delete(key)
-		} else {
-			ok = db.index.Put(key, pos)
-		}
-		if !ok {
-			panic("failed to update index at startup")
+	// 查看是否发生过 merge，比 nonMergeFileId 小的文件已经从 hint 文件中加载过索引了
+	start := &data.LogRecordPos{}
+	mergeFinFileName := filepath.Join(db.option.DirPath, data.MergeFinishedFileName)
+	if _, err := os.Stat(mergeFinFileName); err == nil {
+		fid, err := db.getNonMergeFileId(db.option.DirPath)
+		if err != nil {
+			return err
 		}
+		start.Fid = fid
 	}
+	return db.replayDataFiles(start)
+}
 
+// replayDataFiles 从 start 开始按顺序重放数据文件中的记录，更新索引和事务序列号
+func (db *DB) replayDataFiles(start *data.LogRecordPos) error {
 	// 暂存事务数据
 	transactionRecords := make(map[uint64][]*data.TransactionRecord)
 	var currentSeqNo uint64 = nonTransactionSeqNo
@@ -368,69 +742,443 @@ func (db *DB) loadIndexFromDataFiles() error {
 	// 遍历所有的文件 id，处理文件中的记录
 	for i, fid := range db.fileIds {
 		var fileId = uint32(fid)
+		// 比 start 更小的文件已经加载过索引了
+		if fileId < start.Fid {
+			continue
+		}
 		var dataFile *data.DataFile
 		if fileId == db.activeFile.FileId {
 			dataFile = db.activeFile
 		} else {
 			dataFile = db.olderFiles[fileId]
 		}
+		var startOffset int64
+		if fileId == start.Fid {
+			startOffset = start.Offset
+		}
 
 		// 循环处理文件的内容
-		var offset int64 = 0
-		for {
-			logRecord, size, err := dataFile.ReadLogRecord(offset)
+		isActive := i == len(db.fileIds)-1
+		offset, err := db.iterateDataFile(dataFile, startOffset, isActive, func(logRecord *data.LogRecord, offset int64, size int64) error {
+			// 构造内存索引并保存
+			logRecordPos := &data.LogRecordPos{Fid: fileId, Offset: offset, Size: uint32(size), Expire: logRecord.Expire}
+
+			seqNo, err := db.replayLogRecord(logRecord, logRecordPos, transactionRecords)
 			if err != nil {
-				if err == io.EOF {
-					break
-				}
 				return err
 			}
 
-			// 构造内存索引并保存
-			logRecordPos := &data.LogRecordPos{Fid: fileId, Offset: offset}
-
-			// 解析 key，拿到事务序列号
-			realKey, seqNo := parseLogRecordKey(logRecord.Key)
-			if seqNo == nonTransactionSeqNo {
-				// 非事务操作，直接更新内存索引
-				updateIndex(realKey, logRecord.Type, logRecordPos)
-			} else {
-				// 事务完成，直接更新内存索引
-				if logRecord.Type == data.LogRecordTxnFinished {
-					for _, txnRecord := range transactionRecords[seqNo] {
-						updateIndex(txnRecord.Record.Key, txnRecord.Record.Type, txnRecord.Pos)
-					}
-					delete(transactionRecords, seqNo)
-				} else {
-					logRecord.Key = realKey
-					transactionRecords[seqNo] = append(transactionRecords[seqNo], &data.TransactionRecord{
-						Record: logRecord,
-						Pos:    logRecordPos,
-					})
-				}
-			}
-
 			// 更新事务序列号
 			if seqNo > currentSeqNo {
 				currentSeqNo = seqNo
 			}
-
-			// 递增 offset，下一次从新位置开始读取
-			offset += size
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 
 		// 如果是当前活跃文件，更新这个文件的 writeOff
-		if i == len(db.fileIds)-1 {
+		if isActive {
 			db.activeFile.WriteOff = offset
 		}
 	}
 
 	// 更新事务序列号
-	db.seqNo = currentSeqNo
+	if currentSeqNo > db.seqNo {
+		db.seqNo = currentSeqNo
+	}
+
+	// follower 上没有完成的事务可能会在之后复制过来的数据中完成
+	if db.option.ReadOnly {
+		db.pendingTxnRecords = transactionRecords
+	}
+
+	return nil
+}
+
+// replayLogRecord 将数据文件中的一条记录更新到索引中，返回记录的事务序列号
+// 事务中的记录先暂存在 txnRecords 中，读到事务完成的标记之后再一起更新
+func (db *DB) replayLogRecord(logRecord *data.LogRecord, pos *data.LogRecordPos,
+	txnRecords map[uint64][]*data.TransactionRecord) (uint64, error) {
+	// 解析 key，拿到事务序列号
+	realKey, seqNo := parseLogRecordKey(logRecord.Key)
+	if seqNo == nonTransactionSeqNo {
+		// 非事务操作，直接更新内存索引
+		if err := db.updateIndex(realKey, logRecord.Type, pos); err != nil {
+			return 0, err
+		}
+	} else if logRecord.Type == data.LogRecordTxnFinished {
+		// 事务完成，直接更新内存索引
+		for _, txnRecord := range txnRecords[seqNo] {
+			if err := db.updateIndex(txnRecord.Record.Key, txnRecord.Record.Type, txnRecord.Pos); err != nil {
+				return 0, err
+			}
+		}
+		delete(txnRecords, seqNo)
+		// 事务完成的标记在加载完之后就没有用了
+		atomic.AddInt64(&db.reclaimSize, int64(pos.Size))
+	} else {
+		logRecord.Key = realKey
+		txnRecords[seqNo] = append(txnRecords[seqNo], &data.TransactionRecord{
+			Record: logRecord,
+			Pos:    pos,
+		})
+	}
+	return seqNo, nil
+}
+
+// updateIndex 根据数据文件中的记录更新索引，已经过期的数据和被删除的数据一样处理
+func (db *DB) updateIndex(key []byte, typ data.LogRecordType, pos *data.LogRecordPos) error {
+	var oldPos *data.LogRecordPos
+	var err error
+	if typ == data.LogRecordDeleted || pos.IsExpired() {
+		oldPos, _, err = db.index.Delete(key)
+		atomic.AddInt64(&db.reclaimSize, int64(pos.Size))
+	} else {
+		oldPos, err = db.index.Put(key, pos)
+	}
+	if err != nil {
+		return err
+	}
+	if oldPos != nil {
+		atomic.AddInt64(&db.reclaimSize, int64(oldPos.Size))
+	}
+	db.recordWrite(key, nonTransactionSeqNo, oldPos)
+	return nil
+}
+
+// updateIndexBatch 更新一批 key 的索引，pos 为 nil 表示删除，返回每个 key 旧的位置信息，调用方需要持有互斥锁
+// 持久化的索引在一次原子操作中更新，并记录活跃文件当前写入的位置，启动时从这个位置开始重放数据文件
+func (db *DB) updateIndexBatch(keys [][]byte, positions []*data.LogRecordPos) ([]*data.LogRecordPos, error) {
+	if batchIndex, ok := db.index.(index.BatchIndexer); ok {
+		return batchIndex.ApplyBatch(keys, positions, db.appliedPosition())
+	}
+	oldPositions := make([]*data.LogRecordPos, len(keys))
+	for i, key := range keys {
+		var err error
+		if positions[i] == nil {
+			oldPositions[i], _, err = db.index.Delete(key)
+		} else {
+			oldPositions[i], err = db.index.Put(key, positions[i])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return oldPositions, nil
+}
+
+// appliedPosition 已经应用到索引中的位置，之前写入的数据都已经更新到了索引中，调用方需要持有互斥锁
+// follower 上还没有完成的事务需要从第一条记录开始重新读取
+func (db *DB) appliedPosition() *data.LogRecordPos {
+	if db.activeFile == nil {
+		return &data.LogRecordPos{}
+	}
+	applied := &data.LogRecordPos{Fid: db.activeFile.FileId, Offset: db.activeFile.WriteOff}
+	for _, records := range db.pendingTxnRecords {
+		pos := records[0].Pos
+		if pos.Fid < applied.Fid || (pos.Fid == applied.Fid && pos.Offset < applied.Offset) {
+			applied = &data.LogRecordPos{Fid: pos.Fid, Offset: pos.Offset}
+		}
+	}
+	return applied
+}
+
+// 记录已经应用到持久化索引中的位置，调用方需要持有互斥锁
+func (db *DB) saveAppliedPosition() error {
+	batchIndex, ok := db.index.(index.BatchIndexer)
+	if !ok {
+		return nil
+	}
+	_, err := batchIndex.ApplyBatch(nil, nil, db.appliedPosition())
+	return err
+}
+
+// loadPersistentIndex 将持久化的索引更新到和数据文件一致
+// 先应用 merge 生成的 hint 文件，再从上次应用到索引中的位置开始重放数据文件，索引和数据文件不一致时返回 false
+func (db *DB) loadPersistentIndex() (bool, error) {
+	applied := db.index.(index.BatchIndexer).AppliedPosition()
+	if applied == nil || len(db.fileIds) == 0 || db.dataFile(applied.Fid) == nil {
+		return false, nil
+	}
+	// 数据文件没有持久化时，索引中记录的位置可能超过了文件的末尾
+	if size, err := db.dataFile(applied.Fid).IoManager.Size(); err != nil || size < applied.Offset {
+		return false, err
+	}
+
+	hintFileName := filepath.Join(db.option.DirPath, data.HintFileName)
+	if _, err := os.Stat(hintFileName); err == nil {
+		// merge 之后被重写过的数据文件中的位置已经失效，需要重建索引
+		mergeFinFileName := filepath.Join(db.option.DirPath, data.MergeFinishedFileName)
+		if _, err := os.Stat(mergeFinFileName); err == nil {
+			nonMergeFileId, err := db.getNonMergeFileId(db.option.DirPath)
+			if err != nil {
+				return false, err
+			}
+			if applied.Fid < nonMergeFileId {
+				return false, nil
+			}
+		}
+		if err := db.loadIndexFromHintFile(); err != nil {
+			return false, err
+		}
+	}
+
+	return true, db.replayDataFiles(applied)
+}
+
+// resetPersistentIndex 删除和数据文件不一致的 B+ 树索引文件，之后从数据文件中重建索引
+func (db *DB) resetPersistentIndex() error {
+	if err := db.index.Close(); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(db.option.DirPath, index.BptreeIndexFileName)); err != nil {
+		return err
+	}
+	indexer, err := index.NewIndexer(db.option.IndexType, db.option.DirPath, db.option.SyncWrites)
+	if err != nil {
+		return err
+	}
+	db.index = indexer
+	db.persistentIndex = false
+	db.pendingTxnRecords = nil
+	atomic.StoreInt64(&db.reclaimSize, 0)
+	return nil
+}
+
+// 将活跃文件的 IO 类型重置为标准文件 IO，旧的数据文件只读，继续使用内存映射
+func (db *DB) resetIoType() error {
+	if db.activeFile == nil {
+		return nil
+	}
+	return db.activeFile.SetIOManager(db.option.DirPath, fio.StandardFIO)
+}
+
+// hintBatchSize 向持久化的索引中应用 hint 文件时，每次原子地更新的索引数量
+const hintBatchSize = 4096
+
+// 从 hint 文件中加载索引
+// hint 文件中存储的是 merge 之后的数据文件中所有有效数据的位置信息
+// B+ 树索引是持久化的，hint 文件应用到索引中之后就会被删除，之后启动时不需要再次加载
+func (db *DB) loadIndexFromHintFile() error {
+	// 查看 hint 索引文件是否存在
+	hintFileName := filepath.Join(db.option.DirPath, data.HintFileName)
+	if _, err := os.Stat(hintFileName); os.IsNotExist(err) {
+		return nil
+	}
+	// merge 完成的标识文件先于 hint 文件被删除，标识文件不存在时 hint 文件已经应用过了
+	mergeFinFileName := filepath.Join(db.option.DirPath, data.MergeFinishedFileName)
+	if _, err := os.Stat(mergeFinFileName); os.IsNotExist(err) {
+		return os.Remove(hintFileName)
+	}
+
+	// 打开 hint 索引文件
+	hintFile, err := data.OpenHintFile(db.option.DirPath)
+	if err != nil {
+		return err
+	}
+	hintFile.Codec = db.codec
+	defer func() {
+		_ = hintFile.Close()
+	}()
+
+	// B+ 树索引是持久化的，merge 之后只需要更新仍然指向被 merge 过的数据文件的索引
+	var nonMergeFileId uint32
+	if db.persistentIndex {
+		fid, err := db.getNonMergeFileId(db.option.DirPath)
+		if err != nil {
+			return err
+		}
+		nonMergeFileId = fid
+	}
+
+	// 持久化的索引分批更新，中途崩溃时重新应用 hint 文件的结果是一样的
+	var keys [][]byte
+	var positions []*data.LogRecordPos
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		_, err := db.index.(index.BatchIndexer).ApplyBatch(keys, positions, db.index.(index.BatchIndexer).AppliedPosition())
+		keys, positions = keys[:0], positions[:0]
+		return err
+	}
+
+	// 读取文件中的索引
+	var offset int64 = 0
+	for {
+		logRecord, size, err := hintFile.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		offset += size
+
+		// 解码拿到实际的位置索引，已经过期的数据不需要加载
+		pos := data.DecodeLogRecordPos(logRecord.Value)
+		if pos.IsExpired() {
+			atomic.AddInt64(&db.reclaimSize, int64(pos.Size))
+		}
+		if !db.persistentIndex {
+			if !pos.IsExpired() {
+				if _, err := db.index.Put(logRecord.Key, pos); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		// merge 之后被重新写入或者删除过的 key，保留当前的索引
+		if oldPos := db.index.Get(logRecord.Key); oldPos == nil || oldPos.Fid >= nonMergeFileId {
+			continue
+		}
+		keys = append(keys, logRecord.Key)
+		if pos.IsExpired() {
+			positions = append(positions, nil)
+		} else {
+			positions = append(positions, pos)
+		}
+		if len(keys) == hintBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if !db.persistentIndex {
+		return nil
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	// 索引持久化之后删除标识文件和 hint 文件，此后所有的数据文件都和普通的数据文件一样重放
+	if err := db.index.(index.BatchIndexer).Sync(); err != nil {
+		return err
+	}
+	if err := os.Remove(mergeFinFileName); err != nil {
+		return err
+	}
+	return os.Remove(hintFileName)
+}
+
+// 读取最旧的数据文件中的第一条数据，校验数据是否能够被正确地解密和解压
+// 索引不从数据文件中加载时，在启动时发现密钥错误，而不是等到读取数据时才报错
+func (db *DB) checkCodec() error {
+	if len(db.fileIds) == 0 {
+		return nil
+	}
+	dataFile := db.activeFile
+	if len(db.fileIds) > 1 {
+		dataFile = db.olderFiles[uint32(db.fileIds[0])]
+	}
+	_, _, err := dataFile.ReadLogRecord(0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// 从文件中加载事务序列号
+func (db *DB) loadSeqNo() error {
+	fileName := filepath.Join(db.option.DirPath, data.SeqNoFileName)
+	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+		return nil
+	}
 
+	seqNoFile, err := data.OpenSeqNoFile(db.option.DirPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = seqNoFile.Close()
+	}()
+	record, _, err := seqNoFile.ReadLogRecord(0)
+	if err != nil {
+		return err
+	}
+	seqNo, err := strconv.ParseUint(string(record.Value), 10, 64)
+	if err != nil {
+		return err
+	}
+	db.seqNo = seqNo
+	return nil
+}
+
+// 将当前的事务序列号保存到文件中
+func (db *DB) saveSeqNo() error {
+	record := &data.LogRecord{
+		Key:   []byte(seqNoKey),
+		Value: []byte(strconv.FormatUint(db.seqNo, 10)),
+	}
+	return saveRecordFile(filepath.Join(db.option.DirPath, data.SeqNoFileName), record)
+}
+
+// 从文件中加载可回收的数据量，没有正常关闭时只包含上一次关闭之前的数据，之后的部分在重放时累加
+func (db *DB) loadReclaimSize() error {
+	fileName := filepath.Join(db.option.DirPath, data.ReclaimSizeFileName)
+	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+		return nil
+	}
+
+	reclaimSizeFile, err := data.OpenReclaimSizeFile(db.option.DirPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = reclaimSizeFile.Close()
+	}()
+	record, _, err := reclaimSizeFile.ReadLogRecord(0)
+	if err != nil {
+		return err
+	}
+	reclaimSize, err := strconv.ParseInt(string(record.Value), 10, 64)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&db.reclaimSize, reclaimSize)
 	return nil
 }
 
+// 将可回收的数据量保存到文件中，已经完成的 merge 会在下次启动时回收的部分不计算在内
+func (db *DB) saveReclaimSize() error {
+	reclaimSize := atomic.LoadInt64(&db.reclaimSize) - atomic.LoadInt64(&db.mergedReclaimSize)
+	if reclaimSize < 0 {
+		reclaimSize = 0
+	}
+	record := &data.LogRecord{
+		Key:   []byte(reclaimSizeKey),
+		Value: []byte(strconv.FormatInt(reclaimSize, 10)),
+	}
+	return saveRecordFile(filepath.Join(db.option.DirPath, data.ReclaimSizeFileName), record)
+}
+
+// 将只有一条记录的文件写入磁盘
+// 先写入临时文件再重命名，替换上一次保存的文件，写入过程中崩溃不会丢失已经保存的数据
+func saveRecordFile(fileName string, record *data.LogRecord) error {
+	encRecord, _ := data.EncodeLogRecord(record)
+
+	tmpFileName := fileName + recordFileTmpSuffix
+	tmpFile, err := os.OpenFile(tmpFileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := tmpFile.Write(encRecord); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFileName, fileName)
+}
+
 func checkOptions(options Options) error {
 	if options.DirPath == "" {
 		return errors.New("database dir path is empty")
@@ -438,5 +1186,33 @@ func checkOptions(options Options) error {
 	if options.DataFileSize <= 0 {
 		return errors.New("database data file must be greater than 0")
 	}
+	if options.MergeRatio < 0 || options.MergeRatio > 1 {
+		return errors.New("invalid merge ratio, must between 0 and 1")
+	}
+	if options.MergeRatio > 0 && options.MergeCheckInterval <= 0 {
+		return errors.New("merge check interval must be greater than 0")
+	}
+	if options.ExpireCheckInterval < 0 {
+		return errors.New("expire check interval must not be negative")
+	}
+	if options.RecoveryPolicy < RecoveryFail || options.RecoveryPolicy > RecoverySkipCorrupt {
+		return errors.New("invalid recovery policy")
+	}
+	if options.CompressThreshold < 0 {
+		return errors.New("compress threshold must not be negative")
+	}
+	if options.BytesPerSync < 0 {
+		return errors.New("bytes per sync must not be negative")
+	}
+	if options.SyncInterval < 0 {
+		return errors.New("sync interval must not be negative")
+	}
+	if options.ValueCacheSize < 0 {
+		return errors.New("value cache size must not be negative")
+	}
+	// B+ 树索引文件中的 key 是明文，不能和加密一起使用
+	if options.IndexType == BPTree && len(options.EncryptionKey) > 0 {
+		return errors.New("encryption is not supported with the bptree index")
+	}
 	return nil
 }
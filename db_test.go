@@ -1,10 +1,18 @@
 package kv_go
 
 import (
+	"KV-go/data"
+	"KV-go/fio"
+	"KV-go/index"
 	"KV-go/utils"
+	"bytes"
+	"compress/gzip"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 // 测试完成之后销毁 DB 数据目录
@@ -30,6 +38,232 @@ func TestOpen(t *testing.T) {
 	assert.NotNil(t, db)
 }
 
+func TestOpen_ART(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-art")
+	opts.DirPath = dir
+	opts.IndexType = ART
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	err = db.Delete(utils.GetTestKey(1))
+	assert.Nil(t, err)
+
+	// 重启之后从数据文件中重建索引
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 999, len(db2.ListKeys()))
+	_, err = db2.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err := db2.Get(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.NotNil(t, val)
+}
+
+func TestOpen_BPTree(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-bptree")
+	opts.DirPath = dir
+	opts.IndexType = BPTree
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	err = db.Delete(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	_ = wb.Put(utils.GetTestKey(2000), utils.RandomValue(24))
+	err = wb.Commit()
+	assert.Nil(t, err)
+	seqNo := db.seqNo
+
+	// 重启之后索引直接从 B+ 树文件中读取
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, seqNo, db2.seqNo)
+	// 序列号文件在启动之后仍然保留，没有正常关闭时也不会从 0 开始
+	_, err = os.Stat(filepath.Join(dir, data.SeqNoFileName))
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, len(db2.ListKeys()))
+	_, err = db2.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err := db2.Get(utils.GetTestKey(2000))
+	assert.Nil(t, err)
+	assert.NotNil(t, val)
+
+	// 重启之后继续写入
+	err = db2.Put(utils.GetTestKey(3000), []byte("value after reopen"))
+	assert.Nil(t, err)
+	val, err = db2.Get(utils.GetTestKey(3000))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value after reopen"), val)
+}
+
+// B+ 树索引记录已经应用的位置，启动时从这个位置开始重放数据文件，索引和数据文件不一致时重建索引
+func TestOpen_BPTree_Replay(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-bptree-replay")
+	opts.DirPath = dir
+	opts.IndexType = BPTree
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.GetTestKey(i)))
+	}
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	for i := 100; i < 110; i++ {
+		assert.Nil(t, wb.Put(utils.GetTestKey(i), utils.GetTestKey(i)))
+	}
+	assert.Nil(t, wb.Commit())
+	assert.Nil(t, db.Close())
+
+	// 模拟崩溃时索引丢失了最后的更新，包括写了一半的批次：删除之后的 key，并把已经应用的位置回退
+	tree, err := index.NewBPlusTree(dir, true)
+	assert.Nil(t, err)
+	applied := tree.Get(utils.GetTestKey(50))
+	var keys [][]byte
+	for i := 50; i < 105; i++ {
+		keys = append(keys, utils.GetTestKey(i))
+	}
+	positions := make([]*data.LogRecordPos, len(keys))
+	// 只存在于索引中的 key，用于区分重放和重建索引
+	keys = append(keys, []byte("canary"))
+	positions = append(positions, applied)
+	_, err = tree.ApplyBatch(keys, positions, &data.LogRecordPos{Fid: applied.Fid, Offset: applied.Offset})
+	assert.Nil(t, err)
+	assert.Nil(t, tree.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	// 只重放了数据文件的末尾，索引没有被重建
+	assert.NotNil(t, db.index.Get([]byte("canary")))
+	_, _, err = db.index.Delete([]byte("canary"))
+	assert.Nil(t, err)
+	assert.Equal(t, 110, len(db.ListKeys()))
+	for _, i := range []int{0, 50, 99, 100, 109} {
+		val, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, utils.GetTestKey(i), val)
+	}
+	assert.Nil(t, db.Close())
+
+	// 索引中记录的位置超过了数据文件的末尾（数据没有持久化），从数据文件中重建索引
+	tree, err = index.NewBPlusTree(dir, true)
+	assert.Nil(t, err)
+	_, err = tree.ApplyBatch([][]byte{utils.GetTestKey(0), []byte("canary")},
+		[]*data.LogRecordPos{nil, applied}, &data.LogRecordPos{Offset: 1 << 30})
+	assert.Nil(t, err)
+	assert.Nil(t, tree.Close())
+
+	db, err = Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.Nil(t, db.index.Get([]byte("canary")))
+	assert.Equal(t, 110, len(db.ListKeys()))
+	val, err := db.Get(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	assert.Equal(t, utils.GetTestKey(0), val)
+}
+
+// 索引文件损坏时打开失败，并释放文件锁
+func TestOpen_BPTreeIndexCorrupted(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-bptree-corrupted")
+	opts.DirPath = dir
+	opts.IndexType = BPTree
+	err := os.WriteFile(filepath.Join(dir, index.BptreeIndexFileName), []byte("not a bbolt file"), 0644)
+	assert.Nil(t, err)
+
+	db, err := Open(opts)
+	assert.Nil(t, db)
+	assert.NotNil(t, err)
+
+	// 删除损坏的索引文件之后可以重新打开，索引从数据文件中重建
+	assert.Nil(t, os.Remove(filepath.Join(dir, index.BptreeIndexFileName)))
+	db, err = Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+}
+
+func TestOpen_FileLock(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-flock")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	// 数据目录正在被使用，不能再次打开
+	db2, err := Open(opts)
+	assert.Nil(t, db2)
+	assert.Equal(t, ErrDatabaseIsUsing, err)
+
+	// 关闭之后可以重新打开
+	err = db.Close()
+	assert.Nil(t, err)
+	db3, err := Open(opts)
+	defer destroyDB(db3)
+	assert.Nil(t, err)
+	assert.NotNil(t, db3)
+}
+
+func TestOpen_MMapAtStartup(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-mmap")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.MMapAtStartup = true
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(64))
+		assert.Nil(t, err)
+	}
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2000, len(db2.ListKeys()))
+
+	// 旧的数据文件使用内存映射读取，活跃文件切换回标准文件 IO
+	assert.IsType(t, &fio.FileIO{}, db2.activeFile.IoManager)
+	for _, dataFile := range db2.olderFiles {
+		assert.IsType(t, &fio.MMap{}, dataFile.IoManager)
+	}
+	val, err := db2.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.NotNil(t, val)
+
+	err = db2.Put(utils.GetTestKey(3000), utils.RandomValue(64))
+	assert.Nil(t, err)
+	val, err = db2.Get(utils.GetTestKey(3000))
+	assert.Nil(t, err)
+	assert.NotNil(t, val)
+}
+
 func TestDB_Put(t *testing.T) {
 	opts := DefaultOptions
 	dir, _ := os.MkdirTemp("", "bitcask-go-put")
@@ -274,6 +508,94 @@ func TestDB_Fold(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestDB_Scan(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-scan")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	err = db.PutWithTTL(utils.GetTestKey(100), utils.RandomValue(10), time.Millisecond)
+	assert.Nil(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	var keys [][]byte
+	err = db.Scan(utils.GetTestKey(10), utils.GetTestKey(20), func(key []byte, value []byte) bool {
+		assert.Equal(t, key, value)
+		keys = append(keys, key)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(keys))
+	assert.Equal(t, utils.GetTestKey(10), keys[0])
+	assert.Equal(t, utils.GetTestKey(19), keys[9])
+
+	// 没有上界，并且在遍历期间写入数据
+	keys = nil
+	err = db.Scan(utils.GetTestKey(95), nil, func(key []byte, value []byte) bool {
+		keys = append(keys, key)
+		assert.Nil(t, db.Put(key, []byte("updated")))
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(keys))
+
+	keys = nil
+	err = db.Scan(nil, nil, func(key []byte, value []byte) bool {
+		keys = append(keys, key)
+		return len(keys) < 3
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(keys))
+}
+
+// 遍历期间不持有数据库的锁，每种索引类型都可以在 fn 中写入数据
+func TestDB_Scan_WriteInFn(t *testing.T) {
+	for _, indexType := range []IndexerType{Btree, ART, BPTree} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-scan-write")
+		opts.DirPath = dir
+		opts.IndexType = indexType
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		for i := 0; i < 300; i++ {
+			assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(10)))
+		}
+
+		done := make(chan struct{})
+		var count int
+		go func() {
+			defer close(done)
+			err = db.Scan(nil, utils.GetTestKey(300), func(key []byte, value []byte) bool {
+				// 每个 key 都写入一批新的数据，B+ 树索引文件会在遍历期间扩容
+				for i := 0; i < 20; i++ {
+					newKey := []byte(fmt.Sprintf("scan-write-%s-%d", key, i))
+					assert.Nil(t, db.Put(newKey, utils.RandomValue(10)))
+				}
+				assert.Nil(t, db.Delete(key))
+				count++
+				return true
+			})
+		}()
+		select {
+		case <-done:
+		case <-time.After(30 * time.Second):
+			t.Fatalf("scan with writes deadlocked, index type %d", indexType)
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, 300, count)
+		assert.Equal(t, 300*20, len(db.ListKeys()))
+		destroyDB(db)
+	}
+}
+
 func TestDB_Close(t *testing.T) {
 	opts := DefaultOptions
 	dir, _ := os.MkdirTemp("", "bitcask-go-close")
@@ -302,3 +624,334 @@ func TestDB_Sync(t *testing.T) {
 	err = db.Sync()
 	assert.Nil(t, err)
 }
+
+func TestDB_Stat(t *testing.T) {
+	// B+ 树索引不会重放所有的数据文件，可回收的数据量在关闭时保存
+	for _, indexType := range []IndexerType{Btree, BPTree} {
+		testDBStat(t, indexType)
+	}
+}
+
+func testDBStat(t *testing.T, indexType IndexerType) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-stat")
+	opts.DirPath = dir
+	opts.IndexType = indexType
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	stat, err := db.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, uint(0), stat.KeyNum)
+	assert.Equal(t, uint(0), stat.DataFileNum)
+	assert.Equal(t, int64(0), stat.ReclaimableSize)
+
+	for i := 100; i < 10000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	for i := 100; i < 1000; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	for i := 2000; i < 5000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+
+	stat, err = db.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, uint(9000), stat.KeyNum)
+	assert.Equal(t, uint(1), stat.DataFileNum)
+	assert.Greater(t, stat.ReclaimableSize, int64(0))
+	assert.Greater(t, stat.DiskSize, stat.ReclaimableSize)
+
+	// 重启之后可回收的数据量保持不变
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	stat2, err := db2.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, stat.KeyNum, stat2.KeyNum)
+	assert.Equal(t, stat.ReclaimableSize, stat2.ReclaimableSize)
+
+	// merge 之后没有可回收的数据
+	err = db2.Merge()
+	assert.Nil(t, err)
+	err = db2.Close()
+	assert.Nil(t, err)
+	db3, err := Open(opts)
+	defer destroyDB(db3)
+	assert.Nil(t, err)
+	stat3, err := db3.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, uint(9000), stat3.KeyNum)
+	assert.Equal(t, int64(0), stat3.ReclaimableSize)
+}
+
+func TestDB_Backup(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-backup")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 2000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(64))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 100; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+
+	backupDir, _ := os.MkdirTemp("", "bitcask-go-backup-test")
+	err = db.Backup(backupDir)
+	assert.Nil(t, err)
+
+	// 备份之后继续写入的数据不会影响备份
+	err = db.Put(utils.GetTestKey(5000), utils.RandomValue(64))
+	assert.Nil(t, err)
+
+	// 文件锁不会被备份
+	_, err = os.Stat(filepath.Join(backupDir, fileLockName))
+	assert.True(t, os.IsNotExist(err))
+
+	opts2 := opts
+	opts2.DirPath = backupDir
+	db2, err := Open(opts2)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1900, len(db2.ListKeys()))
+	_, err = db2.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db2.Get(utils.GetTestKey(5000))
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err := db2.Get(utils.GetTestKey(1999))
+	assert.Nil(t, err)
+	assert.NotNil(t, val)
+}
+
+// 备份期间不会阻塞写入，活跃文件只拷贝到备份开始时写入的位置
+func TestDB_Backup_ConcurrentWrites(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-backup-concurrent")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(64)))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 2000; i < 4000; i++ {
+			assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(64)))
+		}
+	}()
+	backupDir, _ := os.MkdirTemp("", "bitcask-go-backup-concurrent-test")
+	assert.Nil(t, db.Backup(backupDir))
+	<-done
+
+	// 备份中的活跃文件末尾没有不完整的记录，使用默认的恢复策略可以打开
+	opts2 := opts
+	opts2.DirPath = backupDir
+	db2, err := Open(opts2)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	keys := len(db2.ListKeys())
+	assert.True(t, keys >= 2000 && keys <= 4000)
+}
+
+func TestDB_Backup_BPTree(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-backup-bptree")
+	opts.DirPath = dir
+	opts.IndexType = BPTree
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(64))
+		assert.Nil(t, err)
+	}
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	err = db.Delete(utils.GetTestKey(1))
+	assert.Nil(t, err)
+
+	// 备份中不包含 B+ 树索引文件，打开时从 hint 文件和数据文件中重建索引
+	backupDir, _ := os.MkdirTemp("", "bitcask-go-backup-bptree-test")
+	err = db.Backup(backupDir)
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(backupDir, index.BptreeIndexFileName))
+	assert.True(t, os.IsNotExist(err))
+
+	opts2 := opts
+	opts2.DirPath = backupDir
+	db2, err := Open(opts2)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 999, len(db2.ListKeys()))
+	_, err = db2.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err := db2.Get(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.NotNil(t, val)
+}
+
+func TestDB_Compression(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-compression")
+	opts.DirPath = dir
+	compressor, err := data.NewGzipCompressor(gzip.DefaultCompression)
+	assert.Nil(t, err)
+	opts.Compressor = compressor
+	opts.CompressThreshold = 128
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	value := bytes.Repeat([]byte(`{"name":"bitcask","value":"kv-go"}`), 32)
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), value)
+		assert.Nil(t, err)
+	}
+	err = db.Put(utils.GetTestKey(1000), []byte("small value"))
+	assert.Nil(t, err)
+
+	// 压缩之后占用的磁盘空间变小
+	stat, err := db.Stat()
+	assert.Nil(t, err)
+	assert.Less(t, stat.DiskSize, int64(1000*len(value)/2))
+
+	val, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, value, val)
+
+	// 重启并且 merge 之后数据仍然能正确读取
+	for i := 0; i < 500; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 501, len(db2.ListKeys()))
+	for i := 500; i < 1000; i++ {
+		val, err := db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, value, val)
+	}
+	val, err = db2.Get(utils.GetTestKey(1000))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("small value"), val)
+	err = db2.Close()
+	assert.Nil(t, err)
+
+	// 没有设置压缩算法时无法读取压缩的数据
+	opts.Compressor = nil
+	db3, err := Open(opts)
+	defer destroyDB(db3)
+	assert.Nil(t, err)
+	_, err = db3.Get(utils.GetTestKey(600))
+	assert.Equal(t, data.ErrCompressorNotSet, err)
+}
+
+func TestDB_Encryption(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-encryption")
+	opts.DirPath = dir
+	opts.EncryptionKey = bytes.Repeat([]byte("k"), 16)
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), []byte("customer-pii"))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 100; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 900, len(db2.ListKeys()))
+	val, err := db2.Get(utils.GetTestKey(500))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("customer-pii"), val)
+	err = db2.Close()
+	assert.Nil(t, err)
+
+	// 数据文件和 hint 文件中都没有明文
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		assert.Nil(t, err)
+		assert.False(t, bytes.Contains(content, []byte("customer-pii")), entry.Name())
+		assert.False(t, bytes.Contains(content, utils.GetTestKey(500)), entry.Name())
+	}
+
+	// 使用错误的密钥打开
+	opts.EncryptionKey = bytes.Repeat([]byte("w"), 16)
+	db3, err := Open(opts)
+	assert.Nil(t, db3)
+	assert.Equal(t, ErrInvalidEncryptionKey, err)
+
+	// 没有设置密钥
+	opts.EncryptionKey = nil
+	db4, err := Open(opts)
+	assert.Nil(t, db4)
+	assert.Equal(t, ErrEncryptionKeyNotSet, err)
+
+	// 密钥长度不合法
+	opts.EncryptionKey = []byte("short")
+	db5, err := Open(opts)
+	assert.Nil(t, db5)
+	assert.NotNil(t, err)
+}
+
+func TestDB_Encryption_BPTree(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-encryption-bptree")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	opts.IndexType = BPTree
+	opts.EncryptionKey = bytes.Repeat([]byte("k"), 32)
+
+	// B+ 树索引文件中保存的是明文的 key，不能开启加密
+	db, err := Open(opts)
+	assert.Nil(t, db)
+	assert.NotNil(t, err)
+}
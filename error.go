@@ -1,6 +1,9 @@
 package kv_go
 
-import "errors"
+import (
+	"KV-go/data"
+	"errors"
+)
 
 var (
 	ErrKeyIsEmpty             = errors.New("the key is empty")
@@ -10,4 +13,22 @@ var (
 	ErrDataDirectoryCorrupted = errors.New("the data directory maybe corrupted")
 	ErrExceedMaxBatchNum      = errors.New("exceed max batch num")
 	ErrMergeInProgress        = errors.New("merge in progress, try again later")
+	ErrDatabaseIsUsing        = errors.New("the database directory is used by another process")
+	ErrNoEnoughSpaceForMerge  = errors.New("no enough disk space for merge")
+	ErrInvalidTTL             = errors.New("the ttl must be greater than 0")
+	ErrTxnConflict            = errors.New("transaction conflict, retry the transaction")
+	ErrTxnFinished            = errors.New("the transaction has been committed or discarded")
+	ErrReadOnly               = errors.New("the database is read only")
+
+	// ErrReplicationPositionLost 复制的位置在数据文件中已经不存在，例如数据文件被 merge 重写或者 follower 的数据比 primary 更新
+	ErrReplicationPositionLost = errors.New("the replication position is lost")
+	// ErrReplicaNotReadOnly 写入复制数据的数据库没有以只读的方式打开
+	ErrReplicaNotReadOnly = errors.New("the replica database must be opened read only")
+	// ErrReplicationPositionMismatch 复制过来的数据和本地数据文件的位置不连续
+	ErrReplicationPositionMismatch = errors.New("the replication position does not match the local data files")
+
+	// ErrInvalidEncryptionKey 使用错误的密钥打开了加密的数据
+	ErrInvalidEncryptionKey = data.ErrInvalidEncryptionKey
+	// ErrEncryptionKeyNotSet 没有设置密钥打开了加密的数据
+	ErrEncryptionKeyNotSet = data.ErrEncryptionKeyNotSet
 )
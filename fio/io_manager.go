@@ -1,8 +1,25 @@
 package fio
 
+import "errors"
+
+var (
+	ErrMMapWriteNotSupported = errors.New("memory map io does not support write")
+	ErrUnsupportedIOType     = errors.New("unsupported io type")
+)
+
 const DataFilePerm = 0644
 
-// IOManager 抽象 IO 管理接口，可以接入不同的IO类型，目前支持标准文件IO
+type FileIOType = byte
+
+const (
+	// StandardFIO 标准文件 IO
+	StandardFIO FileIOType = iota
+
+	// MemoryMap 内存文件映射
+	MemoryMap
+)
+
+// IOManager 抽象 IO 管理接口，可以接入不同的IO类型，目前支持标准文件IO和内存文件映射
 type IOManager interface {
 
 	// Read 从文件给定位置读取数据
@@ -21,7 +38,14 @@ type IOManager interface {
 	Size() (int64, error)
 }
 
-// NewIOManager 初始化 IOManager， 目前只支持标准 FileIO
-func NewIOManager(filename string) (IOManager, error) {
-	return NewFileIOManager(filename)
+// NewIOManager 根据类型初始化 IOManager
+func NewIOManager(filename string, ioType FileIOType) (IOManager, error) {
+	switch ioType {
+	case StandardFIO:
+		return NewFileIOManager(filename)
+	case MemoryMap:
+		return NewMMapIOManager(filename)
+	default:
+		return nil, ErrUnsupportedIOType
+	}
 }
@@ -0,0 +1,78 @@
+//go:build unix
+
+package fio
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// MMap 内存文件映射，只用于读取数据
+// 读取时直接从映射的内存中拷贝，不需要每次都进行系统调用
+type MMap struct {
+	fd   *os.File // 系统文件描述符
+	data []byte   // 映射的内存区域
+}
+
+// NewMMapIOManager 初始化 MMap IO
+func NewMMapIOManager(fileName string) (*MMap, error) {
+	fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDONLY, DataFilePerm)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+
+	mmap := &MMap{fd: fd}
+	// 空文件无法进行映射
+	if stat.Size() > 0 {
+		data, err := syscall.Mmap(int(fd.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+		if err != nil {
+			_ = fd.Close()
+			return nil, err
+		}
+		mmap.data = data
+	}
+	return mmap, nil
+}
+
+func (mmap *MMap) Read(b []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, errors.New("mmap: invalid offset")
+	}
+	if offset >= int64(len(mmap.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, mmap.data[offset:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (mmap *MMap) Write([]byte) (int, error) {
+	return 0, ErrMMapWriteNotSupported
+}
+
+func (mmap *MMap) Sync() error {
+	return nil
+}
+
+func (mmap *MMap) Close() error {
+	if mmap.data != nil {
+		if err := syscall.Munmap(mmap.data); err != nil {
+			return err
+		}
+		mmap.data = nil
+	}
+	return mmap.fd.Close()
+}
+
+func (mmap *MMap) Size() (int64, error) {
+	return int64(len(mmap.data)), nil
+}
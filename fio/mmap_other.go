@@ -0,0 +1,21 @@
+//go:build !unix
+
+package fio
+
+// MMap 不支持内存映射的平台上退化为标准文件 IO，同样只用于读取数据
+type MMap struct {
+	*FileIO
+}
+
+// NewMMapIOManager 初始化 MMap IO
+func NewMMapIOManager(fileName string) (*MMap, error) {
+	fileIO, err := NewFileIOManager(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &MMap{FileIO: fileIO}, nil
+}
+
+func (mmap *MMap) Write([]byte) (int, error) {
+	return 0, ErrMMapWriteNotSupported
+}
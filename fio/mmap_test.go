@@ -0,0 +1,80 @@
+package fio
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestMMap_Read(t *testing.T) {
+	path := filepath.Join("/tmp", "mmap-a.data")
+	defer destroyFile(path)
+
+	// 文件为空
+	mmapIO, err := NewMMapIOManager(path)
+	assert.Nil(t, err)
+	b1 := make([]byte, 10)
+	n1, err := mmapIO.Read(b1, 0)
+	assert.Equal(t, 0, n1)
+	assert.Equal(t, io.EOF, err)
+	err = mmapIO.Close()
+	assert.Nil(t, err)
+
+	// 有数据的情况
+	fio, err := NewFileIOManager(path)
+	assert.Nil(t, err)
+	_, err = fio.Write([]byte("aa"))
+	assert.Nil(t, err)
+	_, err = fio.Write([]byte("bb"))
+	assert.Nil(t, err)
+	_, err = fio.Write([]byte("cc"))
+	assert.Nil(t, err)
+	err = fio.Close()
+	assert.Nil(t, err)
+
+	mmapIO2, err := NewMMapIOManager(path)
+	assert.Nil(t, err)
+	defer func() {
+		err = mmapIO2.Close()
+		assert.Nil(t, err)
+	}()
+	size, err := mmapIO2.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), size)
+
+	b2 := make([]byte, 2)
+	n2, err := mmapIO2.Read(b2, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n2)
+	assert.Equal(t, []byte("bb"), b2)
+
+	// 读取的长度超过文件末尾
+	b3 := make([]byte, 4)
+	n3, err := mmapIO2.Read(b3, 4)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 2, n3)
+	assert.Equal(t, []byte("cc"), b3[:n3])
+
+	// 不支持写入
+	_, err = mmapIO2.Write([]byte("dd"))
+	assert.Equal(t, ErrMMapWriteNotSupported, err)
+}
+
+func TestNewIOManager(t *testing.T) {
+	path := filepath.Join("/tmp", "io-manager.data")
+	defer destroyFile(path)
+
+	fio, err := NewIOManager(path, StandardFIO)
+	assert.Nil(t, err)
+	assert.IsType(t, &FileIO{}, fio)
+	assert.Nil(t, fio.Close())
+
+	mmapIO, err := NewIOManager(path, MemoryMap)
+	assert.Nil(t, err)
+	assert.IsType(t, &MMap{}, mmapIO)
+	assert.Nil(t, mmapIO.Close())
+
+	_, err = NewIOManager(path, FileIOType(100))
+	assert.Equal(t, ErrUnsupportedIOType, err)
+}
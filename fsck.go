@@ -0,0 +1,384 @@
+package kv_go
+
+import (
+	"KV-go/data"
+	"KV-go/fio"
+	"KV-go/index"
+	"errors"
+	"github.com/gofrs/flock"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrRepairDirNotEmpty = errors.New("the repair directory is not empty")
+)
+
+// CorruptRecord 校验失败或者没有完整写入的记录
+type CorruptRecord struct {
+	FileName string // 记录所在的文件
+	Offset   int64  // 记录在文件中的位置
+	Size     int64  // 记录的长度，无法确定长度时为文件中剩余数据的长度
+	Err      error  // data.ErrInvalidCRC 或 data.ErrIncompleteLogRecord
+}
+
+// CheckReport 离线检查数据目录的结果
+type CheckReport struct {
+	DataFiles            uint            // 数据文件的数量
+	Records              uint            // 数据文件中完好的记录数量
+	Keys                 uint            // 有效的 key 的数量
+	CorruptRecords       []CorruptRecord // 损坏的记录
+	UnfinishedTxns       uint            // 没有提交完成的事务数量
+	UnfinishedTxnRecords uint            // 没有提交完成的事务中的记录数量
+	HintRecords          uint            // hint 文件中的记录数量
+	InvalidHintRecords   uint            // hint 文件中指向了不存在的数据的记录数量
+	MergeFinished        bool            // 数据目录中是否有 merge 完成的标识文件
+	NonMergeFileId       uint32          // merge 完成的标识文件中记录的最近没有参与 merge 的文件 id
+	MergeDir             string          // 残留的 merge 目录，为空表示不存在
+	MergeDirFinished     bool            // 残留的 merge 目录中的 merge 是否已经完成，完成的 merge 会在下次启动时生效
+}
+
+// Healthy 数据目录是否没有任何问题
+func (r *CheckReport) Healthy() bool {
+	return len(r.CorruptRecords) == 0 && r.UnfinishedTxns == 0 && r.InvalidHintRecords == 0 &&
+		(r.MergeDir == "" || r.MergeDirFinished)
+}
+
+// Check 离线检查数据目录中所有的数据文件、hint 文件以及 merge 完成的标识文件
+// 数据目录不能被其他进程打开，options 中压缩和加密的配置需要和写入数据时保持一致
+func Check(options Options) (*CheckReport, error) {
+	c, err := newChecker(options)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return c.report, nil
+}
+
+// Repair 检查数据目录，并将其中有效的数据重新写入到一个新的目录中
+// 损坏的记录以及没有提交完成的事务都会被丢弃，原来的数据目录不会被修改
+func Repair(options Options, dstDir string) (*CheckReport, error) {
+	if entries, err := os.ReadDir(dstDir); err == nil && len(entries) > 0 {
+		return nil, ErrRepairDirNotEmpty
+	}
+
+	c, err := newChecker(options)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	if err := c.rewrite(dstDir); err != nil {
+		return nil, err
+	}
+	return c.report, nil
+}
+
+// 离线检查数据目录
+type checker struct {
+	options   Options
+	codec     *data.Codec
+	fileLock  *flock.Flock
+	dataFiles map[uint32]*data.DataFile
+	fileIds   []int
+	index     index.Indexer // 扫描数据文件得到的有效数据的位置
+	report    *CheckReport
+}
+
+func newChecker(options Options) (*checker, error) {
+	if _, err := os.Stat(options.DirPath); err != nil {
+		return nil, err
+	}
+	codec, err := data.NewCodec(options.Compressor, options.CompressThreshold, options.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// 数据目录不能正在被其他进程使用
+	fileLock := flock.New(filepath.Join(options.DirPath, fileLockName))
+	hold, err := fileLock.TryLock()
+	if err != nil {
+		return nil, err
+	}
+	if !hold {
+		return nil, ErrDatabaseIsUsing
+	}
+
+	c := &checker{
+		options:   options,
+		codec:     codec,
+		fileLock:  fileLock,
+		dataFiles: make(map[uint32]*data.DataFile),
+		index:     index.NewBTree(),
+		report:    &CheckReport{},
+	}
+
+	dirEntries, err := os.ReadDir(options.DirPath)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	for _, entry := range dirEntries {
+		if strings.HasSuffix(entry.Name(), data.DataFileNameSuffix) {
+			fileId, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), data.DataFileNameSuffix))
+			if err != nil {
+				c.close()
+				return nil, ErrDataDirectoryCorrupted
+			}
+			c.fileIds = append(c.fileIds, fileId)
+		}
+	}
+	sort.Ints(c.fileIds)
+
+	for _, fid := range c.fileIds {
+		dataFile, err := data.OpenDataFile(options.DirPath, uint32(fid), fio.StandardFIO)
+		if err != nil {
+			c.close()
+			return nil, err
+		}
+		dataFile.Codec = c.codec
+		c.dataFiles[uint32(fid)] = dataFile
+	}
+	return c, nil
+}
+
+func (c *checker) close() {
+	for _, dataFile := range c.dataFiles {
+		_ = dataFile.Close()
+	}
+	_ = c.index.Close()
+	_ = c.fileLock.Unlock()
+}
+
+func (c *checker) check() error {
+	// 按照写入的顺序扫描所有的数据文件
+	transactionRecords := make(map[uint64][]*data.TransactionRecord)
+	for _, fid := range c.fileIds {
+		if err := c.checkDataFile(c.dataFiles[uint32(fid)], transactionRecords); err != nil {
+			return err
+		}
+	}
+	c.report.DataFiles = uint(len(c.fileIds))
+	c.report.Keys = uint(c.index.Size())
+	c.report.UnfinishedTxns = uint(len(transactionRecords))
+	for _, records := range transactionRecords {
+		c.report.UnfinishedTxnRecords += uint(len(records))
+	}
+
+	if err := c.checkHintFile(); err != nil {
+		return err
+	}
+	if err := c.checkMergeFinishedFile(); err != nil {
+		return err
+	}
+
+	// 检查是否有残留的 merge 目录
+	mergePath := getMergePath(c.options.DirPath)
+	if _, err := os.Stat(mergePath); err == nil {
+		c.report.MergeDir = mergePath
+		if _, err := os.Stat(filepath.Join(mergePath, data.MergeFinishedFileName)); err == nil {
+			c.report.MergeDirFinished = true
+		}
+	}
+	return nil
+}
+
+// 扫描数据文件，按照启动时加载索引的方式更新有效数据的位置
+func (c *checker) checkDataFile(dataFile *data.DataFile, transactionRecords map[uint64][]*data.TransactionRecord) error {
+	fileName := data.GetDataFileName(c.options.DirPath, dataFile.FileId)
+	fileSize, err := dataFile.IoManager.Size()
+	if err != nil {
+		return err
+	}
+
+	updateIndex := func(key []byte, typ data.LogRecordType, pos *data.LogRecordPos) {
+		if typ == data.LogRecordDeleted || pos.IsExpired() {
+			c.index.Delete(key)
+		} else {
+			c.index.Put(key, pos)
+		}
+	}
+
+	var offset int64 = 0
+	for offset < fileSize {
+		logRecord, size, err := dataFile.ReadLogRecord(offset)
+		if err != nil {
+			switch err {
+			case data.ErrInvalidCRC:
+				// 记录的长度可信时跳过这条记录继续检查
+				if size > 0 && offset+size <= fileSize {
+					c.addCorruptRecord(fileName, offset, size, err)
+					offset += size
+					continue
+				}
+				c.addCorruptRecord(fileName, offset, fileSize-offset, err)
+			case io.EOF, data.ErrIncompleteLogRecord:
+				c.addCorruptRecord(fileName, offset, fileSize-offset, data.ErrIncompleteLogRecord)
+			default:
+				return err
+			}
+			return nil
+		}
+		c.report.Records++
+
+		logRecordPos := &data.LogRecordPos{Fid: dataFile.FileId, Offset: offset, Size: uint32(size), Expire: logRecord.Expire}
+		realKey, seqNo := parseLogRecordKey(logRecord.Key)
+		if seqNo == nonTransactionSeqNo {
+			updateIndex(realKey, logRecord.Type, logRecordPos)
+		} else if logRecord.Type == data.LogRecordTxnFinished {
+			for _, txnRecord := range transactionRecords[seqNo] {
+				updateIndex(txnRecord.Record.Key, txnRecord.Record.Type, txnRecord.Pos)
+			}
+			delete(transactionRecords, seqNo)
+		} else {
+			logRecord.Key = realKey
+			transactionRecords[seqNo] = append(transactionRecords[seqNo], &data.TransactionRecord{
+				Record: logRecord,
+				Pos:    logRecordPos,
+			})
+		}
+		offset += size
+	}
+	return nil
+}
+
+// 检查 hint 文件中的记录是否完好，并且指向了数据文件中存在的数据
+func (c *checker) checkHintFile() error {
+	fileName := filepath.Join(c.options.DirPath, data.HintFileName)
+	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+		return nil
+	}
+	hintFile, err := data.OpenHintFile(c.options.DirPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = hintFile.Close()
+	}()
+	hintFile.Codec = c.codec
+
+	fileSize, err := hintFile.IoManager.Size()
+	if err != nil {
+		return err
+	}
+	var offset int64 = 0
+	for offset < fileSize {
+		logRecord, size, err := hintFile.ReadLogRecord(offset)
+		if err != nil {
+			switch err {
+			case data.ErrInvalidCRC:
+				c.addCorruptRecord(fileName, offset, size, err)
+				if size > 0 && offset+size <= fileSize {
+					offset += size
+					continue
+				}
+			case io.EOF, data.ErrIncompleteLogRecord:
+				c.addCorruptRecord(fileName, offset, fileSize-offset, data.ErrIncompleteLogRecord)
+			default:
+				return err
+			}
+			return nil
+		}
+		c.report.HintRecords++
+
+		pos := data.DecodeLogRecordPos(logRecord.Value)
+		dataFile, ok := c.dataFiles[pos.Fid]
+		if !ok {
+			c.report.InvalidHintRecords++
+		} else if dataFileSize, err := dataFile.IoManager.Size(); err != nil {
+			return err
+		} else if pos.Offset+int64(pos.Size) > dataFileSize {
+			c.report.InvalidHintRecords++
+		}
+		offset += size
+	}
+	return nil
+}
+
+// 检查 merge 完成的标识文件
+func (c *checker) checkMergeFinishedFile() error {
+	fileName := filepath.Join(c.options.DirPath, data.MergeFinishedFileName)
+	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+		return nil
+	}
+	mergeFinishedFile, err := data.OpenMergeFinishedFile(c.options.DirPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = mergeFinishedFile.Close()
+	}()
+
+	record, _, err := mergeFinishedFile.ReadLogRecord(0)
+	if err != nil {
+		if err != io.EOF && err != data.ErrInvalidCRC && err != data.ErrIncompleteLogRecord {
+			return err
+		}
+		size, _ := mergeFinishedFile.IoManager.Size()
+		c.addCorruptRecord(fileName, 0, size, err)
+		return nil
+	}
+	nonMergeFileId, err := strconv.Atoi(string(record.Value))
+	if err != nil {
+		return err
+	}
+	c.report.MergeFinished = true
+	c.report.NonMergeFileId = uint32(nonMergeFileId)
+	return nil
+}
+
+func (c *checker) addCorruptRecord(fileName string, offset int64, size int64, err error) {
+	c.report.CorruptRecords = append(c.report.CorruptRecords, CorruptRecord{
+		FileName: fileName,
+		Offset:   offset,
+		Size:     size,
+		Err:      err,
+	})
+}
+
+// 将有效的数据写入到新的数据目录中
+func (c *checker) rewrite(dstDir string) error {
+	options := c.options
+	options.DirPath = dstDir
+	options.MergeRatio = 0
+	options.ExpireCheckInterval = 0
+	db, err := Open(options)
+	if err != nil {
+		return err
+	}
+
+	iterator := c.index.Iterator(false)
+	defer iterator.Close()
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		pos := iterator.Value()
+		if pos.IsExpired() {
+			continue
+		}
+		logRecord, _, err := c.dataFiles[pos.Fid].ReadLogRecord(pos.Offset)
+		if err != nil {
+			_ = db.Close()
+			return err
+		}
+		if err := db.put(iterator.Key(), logRecord.Value, logRecord.Expire); err != nil {
+			_ = db.Close()
+			return err
+		}
+	}
+
+	if err := db.Sync(); err != nil {
+		_ = db.Close()
+		return err
+	}
+	return db.Close()
+}
@@ -0,0 +1,134 @@
+package kv_go
+
+import (
+	"KV-go/data"
+	"KV-go/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-fsck")
+	opts.DirPath = dir
+	opts.DataFileSize = 8 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 500; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 100; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	err = db.Merge()
+	assert.Nil(t, err)
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	for i := 500; i < 600; i++ {
+		assert.Nil(t, wb.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	assert.Nil(t, wb.Commit())
+
+	// 数据目录正在被使用
+	_, err = Check(opts)
+	assert.Equal(t, ErrDatabaseIsUsing, err)
+
+	err = db.Close()
+	assert.Nil(t, err)
+	report, err := Check(opts)
+	assert.Nil(t, err)
+	assert.True(t, report.Healthy())
+	assert.Equal(t, uint(500), report.Keys)
+	assert.Equal(t, uint(0), report.UnfinishedTxns)
+	assert.Equal(t, 0, len(report.CorruptRecords))
+	assert.NotEmpty(t, report.MergeDir)
+	assert.True(t, report.MergeDirFinished)
+
+	// merge 生效之后，hint 文件和 merge 完成的标识文件都在数据目录中
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	err = db2.Close()
+	assert.Nil(t, err)
+	report, err = Check(opts)
+	assert.Nil(t, err)
+	assert.True(t, report.Healthy())
+	assert.Equal(t, uint(500), report.Keys)
+	assert.Equal(t, uint(400), report.HintRecords)
+	assert.True(t, report.MergeFinished)
+	assert.Empty(t, report.MergeDir)
+}
+
+func TestRepair(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-fsck-repair")
+	opts.DirPath = dir
+	opts.DataFileSize = 8 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 500; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	// 没有提交完成的事务
+	for i := 500; i < 510; i++ {
+		_, err := db.appendLogRecordWithLock(&data.LogRecord{
+			Key:   logRecordKeyWithSeq(utils.GetTestKey(i), 100),
+			Value: utils.RandomValue(24),
+		})
+		assert.Nil(t, err)
+	}
+	pos := db.index.Get(utils.GetTestKey(10))
+	activeFileId := db.activeFile.FileId
+	err = db.Close()
+	assert.Nil(t, err)
+
+	corruptFile(t, data.GetDataFileName(dir, pos.Fid), pos.Offset+int64(pos.Size)-1)
+	appendToFile(t, data.GetDataFileName(dir, activeFileId), []byte{1, 2, 3})
+	err = os.MkdirAll(getMergePath(dir), os.ModePerm)
+	assert.Nil(t, err)
+	defer os.RemoveAll(getMergePath(dir))
+
+	report, err := Check(opts)
+	assert.Nil(t, err)
+	assert.False(t, report.Healthy())
+	assert.Equal(t, uint(499), report.Keys)
+	assert.Equal(t, 2, len(report.CorruptRecords))
+	assert.Equal(t, data.ErrInvalidCRC, report.CorruptRecords[0].Err)
+	assert.Equal(t, pos.Offset, report.CorruptRecords[0].Offset)
+	assert.Equal(t, data.ErrIncompleteLogRecord, report.CorruptRecords[1].Err)
+	assert.Equal(t, int64(3), report.CorruptRecords[1].Size)
+	assert.Equal(t, uint(1), report.UnfinishedTxns)
+	assert.Equal(t, uint(10), report.UnfinishedTxnRecords)
+	assert.NotEmpty(t, report.MergeDir)
+	assert.False(t, report.MergeDirFinished)
+
+	// 修复到新的目录中
+	dstDir, _ := os.MkdirTemp("", "bitcask-go-fsck-repaired")
+	report, err = Repair(opts, dstDir)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(499), report.Keys)
+	_, err = Repair(opts, dstDir)
+	assert.Equal(t, ErrRepairDirNotEmpty, err)
+
+	opts.DirPath = dstDir
+	report, err = Check(opts)
+	assert.Nil(t, err)
+	assert.True(t, report.Healthy())
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 499, len(db2.ListKeys()))
+	_, err = db2.Get(utils.GetTestKey(10))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db2.Get(utils.GetTestKey(505))
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err := db2.Get(utils.GetTestKey(499))
+	assert.Nil(t, err)
+	assert.NotNil(t, val)
+}
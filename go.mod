@@ -3,13 +3,17 @@ module KV-go
 go 1.20
 
 require (
+	github.com/gofrs/flock v0.8.1
 	github.com/google/btree v1.1.2
+	github.com/peterh/liner v1.2.2
 	github.com/stretchr/testify v1.8.2
+	go.etcd.io/bbolt v1.3.7
+	golang.org/x/sys v0.10.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/mattn/go-runewidth v0.0.3 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/objx v0.5.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,158 @@
+package kv_go
+
+import (
+	"KV-go/data"
+	"sync"
+	"sync/atomic"
+)
+
+// writeRequest 一次 Put 或者 Delete 的写入请求
+type writeRequest struct {
+	key    []byte             // 实际的 key
+	record *data.LogRecord    // 需要写入的记录，key 已经带上了事务序列号
+	pos    *data.LogRecordPos // 写入的位置，删除不存在的 key 时为 nil
+	err    error
+
+	// 写入完成时收到 true；收到 false 表示之前的写入已经完成，当前请求需要负责写入队列中的数据
+	signal chan bool
+}
+
+// groupCommitter 合并并发的写入请求，开启 SyncWrites 时一批写入只需要持久化一次
+// 第一个到达的请求成为 leader，将队列中所有的请求一起写入并持久化，然后唤醒等待的请求；
+// 这期间到达的请求进入队列，由下一个 leader 负责写入
+type groupCommitter struct {
+	mu      sync.Mutex
+	queue   []*writeRequest
+	leading bool // 是否已经有 leader 正在写入
+}
+
+// write 写入数据并更新索引，返回写入的位置
+func (db *DB) write(req *writeRequest) (*data.LogRecordPos, error) {
+	if db.option.ReadOnly {
+		return nil, ErrReadOnly
+	}
+	if !db.option.SyncWrites {
+		db.applyWrites([]*writeRequest{req})
+		return req.pos, req.err
+	}
+	db.committer.commit(db, req)
+	return req.pos, req.err
+}
+
+func (g *groupCommitter) commit(db *DB, req *writeRequest) {
+	req.signal = make(chan bool, 1)
+
+	g.mu.Lock()
+	g.queue = append(g.queue, req)
+	if g.leading {
+		g.mu.Unlock()
+		if done := <-req.signal; done {
+			return
+		}
+		// 成为新的 leader
+		g.mu.Lock()
+	}
+	g.leading = true
+	batch := g.queue
+	g.queue = nil
+	g.mu.Unlock()
+
+	db.applyWrites(batch)
+	for _, r := range batch {
+		if r != req {
+			r.signal <- true
+		}
+	}
+
+	// 将 leader 交给队列中的第一个请求
+	g.mu.Lock()
+	if len(g.queue) > 0 {
+		g.queue[0].signal <- false
+	} else {
+		g.leading = false
+	}
+	g.mu.Unlock()
+}
+
+// applyWrites 写入一批请求，只持久化一次，持久化完成之后再更新内存索引
+// 持久化失败时这一批请求都返回错误，已经写入数据文件的记录不会回滚，也不会更新索引，
+// 但重启之后仍然可能从数据文件中加载出来，调用方需要将这些写入的结果视为不确定
+func (db *DB) applyWrites(batch []*writeRequest) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// 这一批请求中已经写入的 key 是否存在，写入之后索引还没有更新，删除时需要以此为准
+	pending := make(map[string]bool)
+	var err error
+	for _, req := range batch {
+		// 删除不存在的 key 不需要写入
+		if req.record.Type == data.LogRecordDeleted {
+			exists, ok := pending[string(req.key)]
+			if !ok {
+				exists = db.index.Get(req.key) != nil
+			}
+			if !exists {
+				continue
+			}
+		}
+		// 之前的写入失败时，后面的请求同样失败
+		if err != nil {
+			req.err = err
+			continue
+		}
+		if req.pos, err = db.writeLogRecord(req.record); err != nil {
+			req.err = err
+			continue
+		}
+		pending[string(req.key)] = req.record.Type != data.LogRecordDeleted
+	}
+
+	// 根据用户配置决定是否需要对数据进行持久化的操作
+	if db.option.SyncWrites && db.activeFile != nil {
+		if err := db.activeFile.Sync(); err != nil {
+			for _, req := range batch {
+				if req.pos != nil {
+					req.pos, req.err = nil, err
+				}
+			}
+			return
+		}
+	}
+
+	// 更新索引信息，一批写入只更新一次
+	var written []*writeRequest
+	var keys [][]byte
+	var positions []*data.LogRecordPos
+	for _, req := range batch {
+		if req.pos == nil {
+			continue
+		}
+		written = append(written, req)
+		keys = append(keys, req.key)
+		if req.record.Type == data.LogRecordDeleted {
+			positions = append(positions, nil)
+		} else {
+			positions = append(positions, req.pos)
+		}
+	}
+	if len(written) == 0 {
+		return
+	}
+	oldPositions, err := db.updateIndexBatch(keys, positions)
+	if err != nil {
+		for _, req := range written {
+			req.err = err
+		}
+		return
+	}
+	for i, req := range written {
+		// 删除标记本身也是可以被回收的数据
+		if req.record.Type == data.LogRecordDeleted {
+			atomic.AddInt64(&db.reclaimSize, int64(req.pos.Size))
+		}
+		if oldPos := oldPositions[i]; oldPos != nil {
+			atomic.AddInt64(&db.reclaimSize, int64(oldPos.Size))
+		}
+		db.recordWrite(req.key, nonTransactionSeqNo, oldPositions[i])
+	}
+}
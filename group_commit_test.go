@@ -0,0 +1,148 @@
+package kv_go
+
+import (
+	"KV-go/data"
+	"KV-go/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestDB_GroupCommit(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-group-commit")
+	opts.DirPath = dir
+	opts.SyncWrites = true
+	opts.DataFileSize = 32 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	// 并发写入，每个协程写入不同的 key，并删除其中的一半
+	const workers, keysPerWorker = 16, 50
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < keysPerWorker; i++ {
+				key := utils.GetTestKey(w*keysPerWorker + i)
+				assert.Nil(t, db.Put(key, key))
+				if i%2 == 0 {
+					assert.Nil(t, db.Delete(key))
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	check := func(db *DB) {
+		for i := 0; i < workers*keysPerWorker; i++ {
+			value, err := db.Get(utils.GetTestKey(i))
+			if i%keysPerWorker%2 == 0 {
+				assert.Equal(t, ErrKeyNotFound, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, utils.GetTestKey(i), value)
+			}
+		}
+	}
+	check(db)
+	stat, err := db.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, uint(workers*keysPerWorker/2), stat.KeyNum)
+	assert.True(t, stat.DataFileNum > 1)
+
+	// 删除不存在的 key
+	assert.Nil(t, db.Delete([]byte("not-exist")))
+
+	// 重启之后数据一致
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check(db)
+}
+
+func TestDB_GroupCommit_Batching(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-group-commit-batching")
+	opts.DirPath = dir
+	opts.SyncWrites = true
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	// 模拟有 leader 正在写入，期间到达的请求都在队列中等待，由下一个 leader 一起写入
+	db.committer.mu.Lock()
+	db.committer.leading = true
+	db.committer.mu.Unlock()
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, db.Put(utils.GetTestKey(i), utils.GetTestKey(i)))
+		}(i)
+	}
+	for {
+		db.committer.mu.Lock()
+		queued := len(db.committer.queue)
+		db.committer.mu.Unlock()
+		if queued == n {
+			break
+		}
+	}
+	db.committer.mu.Lock()
+	db.committer.queue[0].signal <- false
+	db.committer.mu.Unlock()
+	wg.Wait()
+
+	assert.False(t, db.committer.leading)
+	assert.Empty(t, db.committer.queue)
+	for i := 0; i < n; i++ {
+		value, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, utils.GetTestKey(i), value)
+	}
+}
+
+func TestDB_GroupCommit_DeleteInBatch(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-group-commit-delete")
+	opts.DirPath = dir
+	opts.SyncWrites = true
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	newRequest := func(key []byte, typ data.LogRecordType) *writeRequest {
+		return &writeRequest{key: key, record: &data.LogRecord{
+			Key:   logRecordKeyWithSeq(key, nonTransactionSeqNo),
+			Value: key,
+			Type:  typ,
+		}}
+	}
+
+	// 同一批中先写入再删除两次，只写入一条删除标记
+	key := utils.GetTestKey(1)
+	batch := []*writeRequest{
+		newRequest(key, data.LogRecordNormal),
+		newRequest(key, data.LogRecordDeleted),
+		newRequest(key, data.LogRecordDeleted),
+		newRequest(utils.GetTestKey(2), data.LogRecordDeleted),
+	}
+	db.applyWrites(batch)
+	for _, req := range batch {
+		assert.Nil(t, req.err)
+	}
+	assert.NotNil(t, batch[0].pos)
+	assert.NotNil(t, batch[1].pos)
+	assert.Nil(t, batch[2].pos)
+	assert.Nil(t, batch[3].pos)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, int64(batch[0].pos.Size+batch[1].pos.Size), db.activeFile.WriteOff)
+}
@@ -0,0 +1,317 @@
+// Package http 通过 HTTP/JSON 接口访问存储引擎
+//
+//	GET    /keys/{key}        读取 value，返回原始的字节
+//	PUT    /keys/{key}?ttl=1m 写入 value，请求体为原始的字节
+//	DELETE /keys/{key}        删除 key
+//	GET    /keys              按照前缀或者范围分页遍历 key
+//	POST   /batch             通过 WriteBatch 原子地写入多个 key
+//	POST   /admin/merge       执行 merge
+//	GET    /admin/stat        数据库的统计信息
+//
+// JSON 中的 key、value 以及遍历的游标都是任意的字节，按照 base64 编码
+package http
+
+import (
+	kv "KV-go"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	gohttp "net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	keysPath = "/keys"
+
+	defaultLimit  = 100
+	maxLimit      = 10000
+	maxValueSize  = 64 * 1024 * 1024 // PUT 请求中 value 的最大长度
+	maxBatchBytes = 64 * 1024 * 1024 // POST /batch 请求体的最大长度
+)
+
+// Handler 将 HTTP 请求映射到 DB 的操作上
+type Handler struct {
+	db *kv.DB
+}
+
+// NewHandler 创建处理 HTTP 请求的 Handler
+func NewHandler(db *kv.DB) *Handler {
+	return &Handler{db: db}
+}
+
+func (h *Handler) ServeHTTP(w gohttp.ResponseWriter, r *gohttp.Request) {
+	path := r.URL.EscapedPath()
+	switch {
+	case path == keysPath || path == keysPath+"/":
+		h.allowMethods(w, r, h.listKeys, gohttp.MethodGet)
+	case strings.HasPrefix(path, keysPath+"/"):
+		key, err := url.PathUnescape(strings.TrimPrefix(path, keysPath+"/"))
+		if err != nil {
+			writeError(w, gohttp.StatusBadRequest, err)
+			return
+		}
+		switch r.Method {
+		case gohttp.MethodGet, gohttp.MethodHead:
+			h.getKey(w, r, []byte(key))
+		case gohttp.MethodPut:
+			h.putKey(w, r, []byte(key))
+		case gohttp.MethodDelete:
+			h.deleteKey(w, r, []byte(key))
+		default:
+			methodNotAllowed(w, gohttp.MethodGet, gohttp.MethodPut, gohttp.MethodDelete)
+		}
+	case path == "/batch":
+		h.allowMethods(w, r, h.batch, gohttp.MethodPost)
+	case path == "/admin/merge":
+		h.allowMethods(w, r, h.merge, gohttp.MethodPost)
+	case path == "/admin/stat":
+		h.allowMethods(w, r, h.stat, gohttp.MethodGet)
+	default:
+		writeError(w, gohttp.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (h *Handler) allowMethods(w gohttp.ResponseWriter, r *gohttp.Request,
+	fn func(gohttp.ResponseWriter, *gohttp.Request), methods ...string) {
+	for _, method := range methods {
+		if r.Method == method {
+			fn(w, r)
+			return
+		}
+	}
+	methodNotAllowed(w, methods...)
+}
+
+func (h *Handler) getKey(w gohttp.ResponseWriter, r *gohttp.Request, key []byte) {
+	value, err := h.db.Get(key)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+	if ttl, err := h.db.TTL(key); err == nil && ttl != kv.NoExpiration {
+		w.Header().Set("X-TTL", ttl.Round(time.Millisecond).String())
+	}
+	w.WriteHeader(gohttp.StatusOK)
+	if r.Method != gohttp.MethodHead {
+		_, _ = w.Write(value)
+	}
+}
+
+func (h *Handler) putKey(w gohttp.ResponseWriter, r *gohttp.Request, key []byte) {
+	value, err := io.ReadAll(gohttp.MaxBytesReader(w, r.Body, maxValueSize))
+	if err != nil {
+		writeError(w, gohttp.StatusRequestEntityTooLarge, err)
+		return
+	}
+
+	if ttlParam := r.URL.Query().Get("ttl"); ttlParam != "" {
+		var ttl time.Duration
+		if ttl, err = time.ParseDuration(ttlParam); err != nil {
+			writeError(w, gohttp.StatusBadRequest, err)
+			return
+		}
+		err = h.db.PutWithTTL(key, value, ttl)
+	} else {
+		err = h.db.Put(key, value)
+	}
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.WriteHeader(gohttp.StatusNoContent)
+}
+
+func (h *Handler) deleteKey(w gohttp.ResponseWriter, _ *gohttp.Request, key []byte) {
+	if err := h.db.Delete(key); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.WriteHeader(gohttp.StatusNoContent)
+}
+
+// Entry 遍历返回的一条数据
+type Entry struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"` // 没有请求返回 value 时为 null
+}
+
+// ListResponse GET /keys 的返回结果
+type ListResponse struct {
+	Entries []Entry `json:"entries"`
+	Next    []byte  `json:"next,omitempty"` // 下一页的游标，为空表示已经遍历结束
+}
+
+// listKeys 分页遍历 key，参数：
+// prefix 前缀，start 起始 key（包含），end 结束 key（不包含），reverse 反向遍历，
+// limit 每页的数量，cursor 上一页返回的 base64 编码的游标，values 是否同时返回 value
+func (h *Handler) listKeys(w gohttp.ResponseWriter, r *gohttp.Request) {
+	query := r.URL.Query()
+	limit := defaultLimit
+	if limitParam := query.Get("limit"); limitParam != "" {
+		n, err := strconv.Atoi(limitParam)
+		if err != nil || n <= 0 || n > maxLimit {
+			writeError(w, gohttp.StatusBadRequest, errors.New("limit must be between 1 and "+strconv.Itoa(maxLimit)))
+			return
+		}
+		limit = n
+	}
+	withValues := query.Get("values") == "true"
+	cursor, err := base64.StdEncoding.DecodeString(query.Get("cursor"))
+	if err != nil {
+		writeError(w, gohttp.StatusBadRequest, errors.New("invalid cursor"))
+		return
+	}
+
+	iterator := h.db.NewIterator(kv.IteratorOptions{
+		Prefix:     []byte(query.Get("prefix")),
+		Reverse:    query.Get("reverse") == "true",
+		LowerBound: []byte(query.Get("start")),
+		UpperBound: []byte(query.Get("end")),
+	})
+	defer iterator.Close()
+
+	// 游标为下一页的第一个 key
+	if len(cursor) > 0 {
+		iterator.Seek(cursor)
+	} else {
+		iterator.Rewind()
+	}
+
+	resp := ListResponse{Entries: []Entry{}}
+	for ; iterator.Valid(); iterator.Next() {
+		key := iterator.Key()
+		if len(resp.Entries) == limit {
+			resp.Next = key
+			break
+		}
+
+		entry := Entry{Key: key}
+		if withValues {
+			value, err := iterator.Value()
+			if err == kv.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				writeDBError(w, err)
+				return
+			}
+			// 空的 value 编码为 ""，和没有返回 value 的 null 区分开
+			if value == nil {
+				value = []byte{}
+			}
+			entry.Value = value
+		}
+		resp.Entries = append(resp.Entries, entry)
+	}
+	writeJSON(w, gohttp.StatusOK, &resp)
+}
+
+// BatchOperation POST /batch 中的一个写操作
+type BatchOperation struct {
+	Op    string `json:"op"` // put 或 delete
+	Key   []byte `json:"key"`
+	Value []byte `json:"value,omitempty"`
+	TTL   string `json:"ttl,omitempty"` // 过期时间，例如 10s，只对 put 有效
+}
+
+// BatchRequest POST /batch 的请求体
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+// batch 通过 WriteBatch 原子地执行所有的写操作，任何一个操作不合法时都不会写入
+func (h *Handler) batch(w gohttp.ResponseWriter, r *gohttp.Request) {
+	var req BatchRequest
+	decoder := json.NewDecoder(gohttp.MaxBytesReader(w, r.Body, maxBatchBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, gohttp.StatusBadRequest, err)
+		return
+	}
+
+	options := kv.DefaultWriteBatchOptions
+	if uint(len(req.Operations)) > options.MaxBatchNum {
+		writeError(w, gohttp.StatusBadRequest, kv.ErrExceedMaxBatchNum)
+		return
+	}
+	wb := h.db.NewWriteBatch(options)
+	for i, op := range req.Operations {
+		var err error
+		switch op.Op {
+		case "put":
+			if op.TTL == "" {
+				err = wb.Put(op.Key, op.Value)
+				break
+			}
+			var ttl time.Duration
+			if ttl, err = time.ParseDuration(op.TTL); err == nil {
+				err = wb.PutWithTTL(op.Key, op.Value, ttl)
+			}
+		case "delete":
+			err = wb.Delete(op.Key)
+		default:
+			err = errors.New("unsupported op " + strconv.Quote(op.Op))
+		}
+		if err != nil {
+			writeError(w, gohttp.StatusBadRequest, errors.New("operation "+strconv.Itoa(i)+": "+err.Error()))
+			return
+		}
+	}
+	if err := wb.Commit(); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	writeJSON(w, gohttp.StatusOK, map[string]int{"applied": len(req.Operations)})
+}
+
+func (h *Handler) merge(w gohttp.ResponseWriter, _ *gohttp.Request) {
+	if err := h.db.Merge(); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	writeJSON(w, gohttp.StatusOK, map[string]string{"status": "merged"})
+}
+
+func (h *Handler) stat(w gohttp.ResponseWriter, _ *gohttp.Request) {
+	stat, err := h.db.Stat()
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	writeJSON(w, gohttp.StatusOK, stat)
+}
+
+func writeJSON(w gohttp.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w gohttp.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// 根据 DB 返回的错误选择对应的状态码
+func writeDBError(w gohttp.ResponseWriter, err error) {
+	switch err {
+	case kv.ErrKeyNotFound:
+		writeError(w, gohttp.StatusNotFound, err)
+	case kv.ErrKeyIsEmpty, kv.ErrInvalidTTL, kv.ErrExceedMaxBatchNum:
+		writeError(w, gohttp.StatusBadRequest, err)
+	case kv.ErrMergeInProgress:
+		writeError(w, gohttp.StatusConflict, err)
+	default:
+		writeError(w, gohttp.StatusInternalServerError, err)
+	}
+}
+
+func methodNotAllowed(w gohttp.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, gohttp.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
@@ -0,0 +1,234 @@
+package http
+
+import (
+	kv "KV-go"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	gohttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startServer(t *testing.T) (*httptest.Server, func()) {
+	opts := kv.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-http")
+	opts.DirPath = dir
+	db, err := kv.Open(opts)
+	assert.Nil(t, err)
+
+	server := httptest.NewServer(NewHandler(db))
+	return server, func() {
+		server.Close()
+		_ = db.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func doRequest(t *testing.T, method, url, body string) (int, []byte) {
+	req, err := gohttp.NewRequest(method, url, strings.NewReader(body))
+	assert.Nil(t, err)
+	resp, err := gohttp.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	return resp.StatusCode, data
+}
+
+func TestHandler_Keys(t *testing.T) {
+	server, cleanup := startServer(t)
+	defer cleanup()
+
+	code, body := doRequest(t, gohttp.MethodGet, server.URL+"/keys/name", "")
+	assert.Equal(t, gohttp.StatusNotFound, code)
+	assert.Contains(t, string(body), kv.ErrKeyNotFound.Error())
+
+	code, _ = doRequest(t, gohttp.MethodPut, server.URL+"/keys/name", "bitcask")
+	assert.Equal(t, gohttp.StatusNoContent, code)
+	code, body = doRequest(t, gohttp.MethodGet, server.URL+"/keys/name", "")
+	assert.Equal(t, gohttp.StatusOK, code)
+	assert.Equal(t, "bitcask", string(body))
+
+	// key 中包含需要转义的字符
+	code, _ = doRequest(t, gohttp.MethodPut, server.URL+"/keys/a%2Fb%20c", "escaped")
+	assert.Equal(t, gohttp.StatusNoContent, code)
+	code, body = doRequest(t, gohttp.MethodGet, server.URL+"/keys/a%2Fb%20c", "")
+	assert.Equal(t, gohttp.StatusOK, code)
+	assert.Equal(t, "escaped", string(body))
+
+	code, _ = doRequest(t, gohttp.MethodDelete, server.URL+"/keys/name", "")
+	assert.Equal(t, gohttp.StatusNoContent, code)
+	code, _ = doRequest(t, gohttp.MethodGet, server.URL+"/keys/name", "")
+	assert.Equal(t, gohttp.StatusNotFound, code)
+
+	// 过期时间
+	code, _ = doRequest(t, gohttp.MethodPut, server.URL+"/keys/session?ttl=50ms", "s1")
+	assert.Equal(t, gohttp.StatusNoContent, code)
+	resp, err := gohttp.Get(server.URL + "/keys/session")
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.NotEmpty(t, resp.Header.Get("X-TTL"))
+	time.Sleep(100 * time.Millisecond)
+	code, _ = doRequest(t, gohttp.MethodGet, server.URL+"/keys/session", "")
+	assert.Equal(t, gohttp.StatusNotFound, code)
+
+	code, _ = doRequest(t, gohttp.MethodPut, server.URL+"/keys/session?ttl=abc", "s1")
+	assert.Equal(t, gohttp.StatusBadRequest, code)
+	code, _ = doRequest(t, gohttp.MethodPut, server.URL+"/keys/session?ttl=-1s", "s1")
+	assert.Equal(t, gohttp.StatusBadRequest, code)
+	code, _ = doRequest(t, gohttp.MethodPut, server.URL+"/keys/", "empty")
+	assert.Equal(t, gohttp.StatusMethodNotAllowed, code)
+	code, _ = doRequest(t, gohttp.MethodPost, server.URL+"/keys/name", "")
+	assert.Equal(t, gohttp.StatusMethodNotAllowed, code)
+	code, _ = doRequest(t, gohttp.MethodGet, server.URL+"/unknown", "")
+	assert.Equal(t, gohttp.StatusNotFound, code)
+}
+
+func listKeys(t *testing.T, url string) ListResponse {
+	code, body := doRequest(t, gohttp.MethodGet, url, "")
+	assert.Equal(t, gohttp.StatusOK, code)
+	var resp ListResponse
+	assert.Nil(t, json.Unmarshal(body, &resp))
+	return resp
+}
+
+func entryKeys(resp ListResponse) []string {
+	keys := make([]string, 0, len(resp.Entries))
+	for _, entry := range resp.Entries {
+		keys = append(keys, string(entry.Key))
+	}
+	return keys
+}
+
+func TestHandler_ListKeys(t *testing.T) {
+	server, cleanup := startServer(t)
+	defer cleanup()
+
+	for i := 0; i < 5; i++ {
+		code, _ := doRequest(t, gohttp.MethodPut, fmt.Sprintf("%s/keys/user:%d", server.URL, i), fmt.Sprintf("v%d", i))
+		assert.Equal(t, gohttp.StatusNoContent, code)
+	}
+	code, _ := doRequest(t, gohttp.MethodPut, server.URL+"/keys/other", "o")
+	assert.Equal(t, gohttp.StatusNoContent, code)
+
+	// 前缀和分页
+	resp := listKeys(t, server.URL+"/keys?prefix=user:&limit=2&values=true")
+	assert.Equal(t, []string{"user:0", "user:1"}, entryKeys(resp))
+	assert.Equal(t, []byte("v0"), resp.Entries[0].Value)
+	assert.Equal(t, []byte("user:2"), resp.Next)
+	resp = listKeys(t, server.URL+"/keys?prefix=user:&limit=2&cursor="+encodeCursor(resp.Next))
+	assert.Equal(t, []string{"user:2", "user:3"}, entryKeys(resp))
+	assert.Nil(t, resp.Entries[0].Value)
+	resp = listKeys(t, server.URL+"/keys?prefix=user:&limit=2&cursor="+encodeCursor(resp.Next))
+	assert.Equal(t, []string{"user:4"}, entryKeys(resp))
+	assert.Empty(t, resp.Next)
+
+	// 范围
+	resp = listKeys(t, server.URL+"/keys?start=user:1&end=user:3")
+	assert.Equal(t, []string{"user:1", "user:2"}, entryKeys(resp))
+	resp = listKeys(t, server.URL+"/keys?start=user:1&end=user:4&reverse=true")
+	assert.Equal(t, []string{"user:3", "user:2", "user:1"}, entryKeys(resp))
+	resp = listKeys(t, server.URL+"/keys?reverse=true&limit=2")
+	assert.Equal(t, []string{"user:4", "user:3"}, entryKeys(resp))
+	resp = listKeys(t, server.URL+"/keys?reverse=true&limit=10&cursor="+encodeCursor(resp.Next))
+	assert.Equal(t, []string{"user:2", "user:1", "user:0", "other"}, entryKeys(resp))
+
+	code, _ = doRequest(t, gohttp.MethodGet, server.URL+"/keys?limit=0", "")
+	assert.Equal(t, gohttp.StatusBadRequest, code)
+	code, _ = doRequest(t, gohttp.MethodGet, server.URL+"/keys?cursor=not-base64", "")
+	assert.Equal(t, gohttp.StatusBadRequest, code)
+}
+
+func encodeCursor(cursor []byte) string {
+	return url.QueryEscape(base64.StdEncoding.EncodeToString(cursor))
+}
+
+func TestHandler_BinaryKeys(t *testing.T) {
+	server, cleanup := startServer(t)
+	defer cleanup()
+
+	// 不是合法 UTF-8 的 key 和 value 通过 base64 原样传输
+	key := []byte{0xff, 0x00, 0xfe}
+	value := []byte{0x80, 0x81}
+	ops, err := json.Marshal(BatchRequest{Operations: []BatchOperation{
+		{Op: "put", Key: key, Value: value},
+		{Op: "put", Key: []byte("empty"), Value: []byte{}},
+	}})
+	assert.Nil(t, err)
+	code, _ := doRequest(t, gohttp.MethodPost, server.URL+"/batch", string(ops))
+	assert.Equal(t, gohttp.StatusOK, code)
+
+	resp := listKeys(t, server.URL+"/keys?values=true")
+	assert.Equal(t, 2, len(resp.Entries))
+	assert.Equal(t, []byte("empty"), resp.Entries[0].Key)
+	assert.Equal(t, []byte{}, resp.Entries[0].Value)
+	assert.Equal(t, key, resp.Entries[1].Key)
+	assert.Equal(t, value, resp.Entries[1].Value)
+}
+
+func TestHandler_Batch(t *testing.T) {
+	server, cleanup := startServer(t)
+	defer cleanup()
+
+	code, _ := doRequest(t, gohttp.MethodPut, server.URL+"/keys/old", "v")
+	assert.Equal(t, gohttp.StatusNoContent, code)
+
+	// key 和 value 使用 base64 编码："a" "1" "b" "2" "old"
+	body := `{"operations":[
+		{"op":"put","key":"YQ==","value":"MQ=="},
+		{"op":"put","key":"Yg==","value":"Mg==","ttl":"1h"},
+		{"op":"delete","key":"b2xk"}
+	]}`
+	code, resp := doRequest(t, gohttp.MethodPost, server.URL+"/batch", body)
+	assert.Equal(t, gohttp.StatusOK, code)
+	assert.JSONEq(t, `{"applied":3}`, string(resp))
+
+	code, resp = doRequest(t, gohttp.MethodGet, server.URL+"/keys/b", "")
+	assert.Equal(t, gohttp.StatusOK, code)
+	assert.Equal(t, "2", string(resp))
+	code, _ = doRequest(t, gohttp.MethodGet, server.URL+"/keys/old", "")
+	assert.Equal(t, gohttp.StatusNotFound, code)
+
+	// 有一个操作不合法时整个批次都不会写入
+	body = `{"operations":[{"op":"put","key":"Yw==","value":"Mw=="},{"op":"incr","key":"YQ=="}]}`
+	code, _ = doRequest(t, gohttp.MethodPost, server.URL+"/batch", body)
+	assert.Equal(t, gohttp.StatusBadRequest, code)
+	code, _ = doRequest(t, gohttp.MethodGet, server.URL+"/keys/c", "")
+	assert.Equal(t, gohttp.StatusNotFound, code)
+
+	code, _ = doRequest(t, gohttp.MethodPost, server.URL+"/batch", `{"operations":[{"op":"put","key":""}]}`)
+	assert.Equal(t, gohttp.StatusBadRequest, code)
+	code, _ = doRequest(t, gohttp.MethodPost, server.URL+"/batch", `not json`)
+	assert.Equal(t, gohttp.StatusBadRequest, code)
+	code, _ = doRequest(t, gohttp.MethodGet, server.URL+"/batch", "")
+	assert.Equal(t, gohttp.StatusMethodNotAllowed, code)
+}
+
+func TestHandler_Admin(t *testing.T) {
+	server, cleanup := startServer(t)
+	defer cleanup()
+
+	for i := 0; i < 10; i++ {
+		code, _ := doRequest(t, gohttp.MethodPut, fmt.Sprintf("%s/keys/key-%d", server.URL, i%3), "value")
+		assert.Equal(t, gohttp.StatusNoContent, code)
+	}
+
+	code, body := doRequest(t, gohttp.MethodGet, server.URL+"/admin/stat", "")
+	assert.Equal(t, gohttp.StatusOK, code)
+	var stat kv.Stat
+	assert.Nil(t, json.Unmarshal(body, &stat))
+	assert.Equal(t, uint(3), stat.KeyNum)
+	assert.True(t, stat.ReclaimableSize > 0)
+
+	code, _ = doRequest(t, gohttp.MethodPost, server.URL+"/admin/merge", "")
+	assert.Equal(t, gohttp.StatusOK, code)
+	code, _ = doRequest(t, gohttp.MethodGet, server.URL+"/admin/merge", "")
+	assert.Equal(t, gohttp.StatusMethodNotAllowed, code)
+}
@@ -0,0 +1,658 @@
+package index
+
+import (
+	"KV-go/data"
+	"bytes"
+	"sync"
+)
+
+// AdaptiveRadixTree 自适应基数树索引
+// 内部节点根据子节点的数量在 Node4、Node16、Node48、Node256 之间自适应地调整，并对公共前缀做了路径压缩，
+// 对于拥有较长公共前缀的 key 集合，比 BTree 更加节省内存
+// 节点是写时复制的，创建迭代器时只需要记录当前的根节点，之后的修改会先复制被快照引用的节点
+type AdaptiveRadixTree struct {
+	root artNode
+	size int
+	gen  uint64 // 当前的版本，版本不同的节点可能被迭代器的快照引用，修改之前需要先复制
+	lock *sync.RWMutex
+}
+
+// NewART 初始化自适应基数树索引
+func NewART() *AdaptiveRadixTree {
+	return &AdaptiveRadixTree{
+		lock: new(sync.RWMutex),
+	}
+}
+
+func (art *AdaptiveRadixTree) Put(key []byte, pos *data.LogRecordPos) (*data.LogRecordPos, error) {
+	art.lock.Lock()
+	oldPos := artInsert(&art.root, key, 0, &artLeaf{key: key, pos: pos}, art.gen)
+	if oldPos == nil {
+		art.size++
+	}
+	art.lock.Unlock()
+	return oldPos, nil
+}
+
+func (art *AdaptiveRadixTree) Get(key []byte) *data.LogRecordPos {
+	art.lock.RLock()
+	defer art.lock.RUnlock()
+	return artSearch(art.root, key)
+}
+
+func (art *AdaptiveRadixTree) Delete(key []byte) (*data.LogRecordPos, bool, error) {
+	art.lock.Lock()
+	defer art.lock.Unlock()
+	if artSearch(art.root, key) == nil {
+		return nil, false, nil
+	}
+	oldPos := artDelete(&art.root, key, 0, art.gen)
+	if oldPos == nil {
+		return nil, false, nil
+	}
+	art.size--
+	return oldPos, true, nil
+}
+
+func (art *AdaptiveRadixTree) Size() int {
+	art.lock.RLock()
+	defer art.lock.RUnlock()
+	return art.size
+}
+
+func (art *AdaptiveRadixTree) Iterator(reverse bool) Iterator {
+	// 记录当前的根节点作为快照，并切换到新的版本，之后的修改不会影响快照中的节点
+	art.lock.Lock()
+	snapshot := art.root
+	art.gen++
+	art.lock.Unlock()
+
+	return newBatchIterator(func(key []byte, fn func(item *Item) bool) {
+		leafFn := func(leaf *artLeaf) bool {
+			return fn(&Item{key: leaf.key, pos: leaf.pos})
+		}
+		if key == nil {
+			artWalk(snapshot, reverse, leafFn)
+		} else {
+			artWalkFrom(snapshot, nil, key, reverse, leafFn)
+		}
+	})
+}
+
+func (art *AdaptiveRadixTree) Close() error {
+	return nil
+}
+
+type artNodeKind uint8
+
+const (
+	artNode4 artNodeKind = iota
+	artNode16
+	artNode48
+	artNode256
+)
+
+// 各种内部节点能够容纳的最多子节点数量
+const (
+	artNode4Max   = 4
+	artNode16Max  = 16
+	artNode48Max  = 48
+	artNode256Max = 256
+)
+
+// 删除数据时节点缩小的阈值，比扩容的阈值略小，避免在临界点上反复扩容、缩小
+const (
+	artNode16Min  = 3
+	artNode48Min  = 12
+	artNode256Min = 37
+)
+
+// artNode 基数树的节点，为叶子节点 *artLeaf 或者内部节点 artInnerNode
+type artNode interface {
+	isLeaf() bool
+}
+
+// artLeaf 叶子节点，只保存完整的 key 和位置索引信息
+// 叶子节点创建之后不会被修改，更新 key 时直接替换为新的叶子节点，可以被多个版本共用
+type artLeaf struct {
+	key []byte
+	pos *data.LogRecordPos
+}
+
+func (l *artLeaf) isLeaf() bool {
+	return true
+}
+
+// artInnerNode 内部节点，不同类型的内部节点使用不同大小的数组保存边和子节点
+type artInnerNode interface {
+	artNode
+	header() *artInner
+	// slots 返回保存边和子节点的数组，Node4/Node16 中的边是有序的，Node48 中的边为 256 个字节到子节点下标（加 1）的映射，Node256 没有边
+	slots() ([]byte, []artNode)
+	clone() artInnerNode
+}
+
+// artInner 内部节点的公共部分
+type artInner struct {
+	kind     artNodeKind
+	size     uint16   // 子节点的数量
+	gen      uint64   // 创建节点时树的版本
+	prefix   []byte   // 路径压缩之后的公共前缀
+	terminal *artLeaf // key 恰好在当前节点结束时对应的叶子节点
+}
+
+func (n *artInner) isLeaf() bool {
+	return false
+}
+
+func (n *artInner) header() *artInner {
+	return n
+}
+
+type artInner4 struct {
+	artInner
+	keys     [artNode4Max]byte
+	children [artNode4Max]artNode
+}
+
+type artInner16 struct {
+	artInner
+	keys     [artNode16Max]byte
+	children [artNode16Max]artNode
+}
+
+type artInner48 struct {
+	artInner
+	keys     [artNode256Max]byte
+	children [artNode48Max]artNode
+}
+
+type artInner256 struct {
+	artInner
+	children [artNode256Max]artNode
+}
+
+func (n *artInner4) slots() ([]byte, []artNode)   { return n.keys[:], n.children[:] }
+func (n *artInner16) slots() ([]byte, []artNode)  { return n.keys[:], n.children[:] }
+func (n *artInner48) slots() ([]byte, []artNode)  { return n.keys[:], n.children[:] }
+func (n *artInner256) slots() ([]byte, []artNode) { return nil, n.children[:] }
+
+func (n *artInner4) clone() artInnerNode   { nn := *n; return &nn }
+func (n *artInner16) clone() artInnerNode  { nn := *n; return &nn }
+func (n *artInner48) clone() artInnerNode  { nn := *n; return &nn }
+func (n *artInner256) clone() artInnerNode { nn := *n; return &nn }
+
+func newARTInnerNode(kind artNodeKind, gen uint64) artInnerNode {
+	var n artInnerNode
+	switch kind {
+	case artNode4:
+		n = &artInner4{}
+	case artNode16:
+		n = &artInner16{}
+	case artNode48:
+		n = &artInner48{}
+	default:
+		n = &artInner256{}
+	}
+	h := n.header()
+	h.kind, h.gen = kind, gen
+	return n
+}
+
+// artWritable 返回可以在版本 gen 中直接修改的节点，节点属于旧的版本时复制一份
+// 前缀只会被整体替换，不会原地修改，可以和旧的节点共用
+func artWritable(n artInnerNode, gen uint64) artInnerNode {
+	if n.header().gen == gen {
+		return n
+	}
+	nn := n.clone()
+	nn.header().gen = gen
+	return nn
+}
+
+func artIsFull(n artInnerNode) bool {
+	h := n.header()
+	switch h.kind {
+	case artNode4:
+		return h.size == artNode4Max
+	case artNode16:
+		return h.size == artNode16Max
+	case artNode48:
+		return h.size == artNode48Max
+	}
+	return false
+}
+
+// artFindChild 查找边 c 对应的子节点，返回子节点在数组中的引用
+func artFindChild(n artInnerNode, c byte) *artNode {
+	h := n.header()
+	keys, children := n.slots()
+	switch h.kind {
+	case artNode4, artNode16:
+		for i := 0; i < int(h.size); i++ {
+			if keys[i] == c {
+				return &children[i]
+			}
+		}
+	case artNode48:
+		if idx := keys[c]; idx > 0 {
+			return &children[idx-1]
+		}
+	case artNode256:
+		if children[c] != nil {
+			return &children[c]
+		}
+	}
+	return nil
+}
+
+// artAddChild 添加一个子节点，调用前需要保证节点没有满
+func artAddChild(n artInnerNode, c byte, child artNode) {
+	h := n.header()
+	keys, children := n.slots()
+	size := int(h.size)
+	switch h.kind {
+	case artNode4, artNode16:
+		// 保持边的有序
+		i := 0
+		for ; i < size && keys[i] < c; i++ {
+		}
+		copy(keys[i+1:size+1], keys[i:size])
+		copy(children[i+1:size+1], children[i:size])
+		keys[i] = c
+		children[i] = child
+	case artNode48:
+		i := 0
+		for ; children[i] != nil; i++ {
+		}
+		children[i] = child
+		keys[c] = byte(i + 1)
+	case artNode256:
+		children[c] = child
+	}
+	h.size++
+}
+
+// artRemoveChild 删除边 c 对应的子节点
+func artRemoveChild(n artInnerNode, c byte) {
+	h := n.header()
+	keys, children := n.slots()
+	size := int(h.size)
+	switch h.kind {
+	case artNode4, artNode16:
+		for i := 0; i < size; i++ {
+			if keys[i] == c {
+				copy(keys[i:], keys[i+1:size])
+				copy(children[i:], children[i+1:size])
+				children[size-1] = nil
+				break
+			}
+		}
+	case artNode48:
+		if idx := keys[c]; idx > 0 {
+			children[idx-1] = nil
+			keys[c] = 0
+		}
+	case artNode256:
+		children[c] = nil
+	}
+	h.size--
+}
+
+// artForEachChild 按边的顺序遍历所有子节点，fn 返回 false 时终止遍历
+func artForEachChild(n artInnerNode, reverse bool, fn func(c byte, child artNode) bool) bool {
+	h := n.header()
+	keys, children := n.slots()
+	switch h.kind {
+	case artNode4, artNode16:
+		size := int(h.size)
+		for i := 0; i < size; i++ {
+			j := i
+			if reverse {
+				j = size - 1 - i
+			}
+			if !fn(keys[j], children[j]) {
+				return false
+			}
+		}
+	case artNode48, artNode256:
+		for i := 0; i < artNode256Max; i++ {
+			c := byte(i)
+			if reverse {
+				c = byte(artNode256Max - 1 - i)
+			}
+			var child artNode
+			if h.kind == artNode48 {
+				if idx := keys[c]; idx > 0 {
+					child = children[idx-1]
+				}
+			} else {
+				child = children[c]
+			}
+			if child != nil && !fn(c, child) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// artResize 将内部节点转换为另一种类型，保留前缀和所有子节点
+func artResize(n artInnerNode, kind artNodeKind, gen uint64) artInnerNode {
+	nn := newARTInnerNode(kind, gen)
+	nn.header().prefix = n.header().prefix
+	nn.header().terminal = n.header().terminal
+	artForEachChild(n, false, func(c byte, child artNode) bool {
+		artAddChild(nn, c, child)
+		return true
+	})
+	return nn
+}
+
+// artGrow 节点满了之后扩容为更大的节点类型
+func artGrow(n artInnerNode, gen uint64) artInnerNode {
+	switch n.header().kind {
+	case artNode4:
+		return artResize(n, artNode16, gen)
+	case artNode16:
+		return artResize(n, artNode48, gen)
+	case artNode48:
+		return artResize(n, artNode256, gen)
+	}
+	return n
+}
+
+// artShrink 删除子节点之后，根据子节点数量缩小节点，或者和唯一的子节点合并，*ref 需要是版本 gen 中的节点 n
+func artShrink(ref *artNode, n artInnerNode, gen uint64) {
+	h := n.header()
+	if h.size == 0 {
+		// 没有子节点，只剩下 key 在此结束的叶子节点，或者为空
+		if h.terminal == nil {
+			*ref = nil
+		} else {
+			*ref = h.terminal
+		}
+		return
+	}
+
+	switch h.kind {
+	case artNode4:
+		if h.size == 1 && h.terminal == nil {
+			// 只有一个子节点，将当前节点的前缀合并到子节点中
+			keys, children := n.slots()
+			c, child := keys[0], children[0]
+			if inner, ok := child.(artInnerNode); ok {
+				inner = artWritable(inner, gen)
+				ch := inner.header()
+				prefix := make([]byte, 0, len(h.prefix)+1+len(ch.prefix))
+				prefix = append(prefix, h.prefix...)
+				prefix = append(prefix, c)
+				prefix = append(prefix, ch.prefix...)
+				ch.prefix = prefix
+				child = inner
+			}
+			*ref = child
+		}
+	case artNode16:
+		if h.size <= artNode16Min {
+			*ref = artResize(n, artNode4, gen)
+		}
+	case artNode48:
+		if h.size <= artNode48Min {
+			*ref = artResize(n, artNode16, gen)
+		}
+	case artNode256:
+		if h.size <= artNode256Min {
+			*ref = artResize(n, artNode48, gen)
+		}
+	}
+}
+
+// artInsert 插入叶子节点，如果 key 已经存在则替换叶子节点并返回旧的位置信息
+// 路径上旧版本的内部节点会先被复制，叶子节点不会被原地修改
+func artInsert(ref *artNode, key []byte, depth int, leaf *artLeaf, gen uint64) *data.LogRecordPos {
+	if *ref == nil {
+		*ref = leaf
+		return nil
+	}
+
+	if old, ok := (*ref).(*artLeaf); ok {
+		if bytes.Equal(old.key, key) {
+			*ref = leaf
+			return old.pos
+		}
+		// 两个 key 不相同，分裂出一个新的内部节点，前缀为两者的公共部分
+		lcp := longestCommonPrefix(old.key[depth:], key[depth:])
+		nn := newARTInnerNode(artNode4, gen)
+		nn.header().prefix = append([]byte(nil), key[depth:depth+lcp]...)
+		depth += lcp
+		artAddLeaf(nn, old, depth)
+		artAddLeaf(nn, leaf, depth)
+		*ref = nn
+		return nil
+	}
+
+	n := artWritable((*ref).(artInnerNode), gen)
+	*ref = n
+	h := n.header()
+
+	// 比较压缩的前缀，如果不匹配则在不匹配的位置分裂
+	p := longestCommonPrefix(h.prefix, key[depth:])
+	if p < len(h.prefix) {
+		nn := newARTInnerNode(artNode4, gen)
+		nn.header().prefix = append([]byte(nil), h.prefix[:p]...)
+		c := h.prefix[p]
+		h.prefix = h.prefix[p+1:]
+		artAddChild(nn, c, n)
+		artAddLeaf(nn, leaf, depth+p)
+		*ref = nn
+		return nil
+	}
+
+	depth += len(h.prefix)
+	if depth == len(key) {
+		var oldPos *data.LogRecordPos
+		if h.terminal != nil {
+			oldPos = h.terminal.pos
+		}
+		h.terminal = leaf
+		return oldPos
+	}
+
+	if child := artFindChild(n, key[depth]); child != nil {
+		return artInsert(child, key, depth+1, leaf, gen)
+	}
+
+	if artIsFull(n) {
+		n = artGrow(n, gen)
+		*ref = n
+	}
+	artAddChild(n, key[depth], leaf)
+	return nil
+}
+
+// artAddLeaf 将叶子节点挂在刚分裂出来的节点上，depth 为当前节点结束时的 key 长度
+func artAddLeaf(n artInnerNode, leaf *artLeaf, depth int) {
+	if len(leaf.key) == depth {
+		n.header().terminal = leaf
+	} else {
+		artAddChild(n, leaf.key[depth], leaf)
+	}
+}
+
+func artSearch(node artNode, key []byte) *data.LogRecordPos {
+	depth := 0
+	for node != nil {
+		n, ok := node.(artInnerNode)
+		if !ok {
+			leaf := node.(*artLeaf)
+			if bytes.Equal(leaf.key, key) {
+				return leaf.pos
+			}
+			return nil
+		}
+		h := n.header()
+		if !bytes.HasPrefix(key[depth:], h.prefix) {
+			return nil
+		}
+		depth += len(h.prefix)
+		if depth == len(key) {
+			if h.terminal == nil {
+				return nil
+			}
+			return h.terminal.pos
+		}
+		child := artFindChild(n, key[depth])
+		if child == nil {
+			return nil
+		}
+		node = *child
+		depth++
+	}
+	return nil
+}
+
+// artDelete 删除 key，返回被删除的位置信息，key 不存在时返回 nil
+// 和插入一样，路径上旧版本的内部节点会先被复制，调用前先确认 key 存在，避免白白复制节点
+func artDelete(ref *artNode, key []byte, depth int, gen uint64) *data.LogRecordPos {
+	if *ref == nil {
+		return nil
+	}
+
+	if leaf, ok := (*ref).(*artLeaf); ok {
+		if !bytes.Equal(leaf.key, key) {
+			return nil
+		}
+		*ref = nil
+		return leaf.pos
+	}
+
+	n := (*ref).(artInnerNode)
+	h := n.header()
+	if !bytes.HasPrefix(key[depth:], h.prefix) {
+		return nil
+	}
+	depth += len(h.prefix)
+	if depth == len(key) {
+		if h.terminal == nil {
+			return nil
+		}
+		oldPos := h.terminal.pos
+		n = artWritable(n, gen)
+		*ref = n
+		n.header().terminal = nil
+		artShrink(ref, n, gen)
+		return oldPos
+	}
+
+	c := key[depth]
+	if artFindChild(n, c) == nil {
+		return nil
+	}
+	n = artWritable(n, gen)
+	*ref = n
+	child := artFindChild(n, c)
+	oldPos := artDelete(child, key, depth+1, gen)
+	if oldPos == nil {
+		return nil
+	}
+	// 子节点已经被整个删除
+	if *child == nil {
+		artRemoveChild(n, c)
+		artShrink(ref, n, gen)
+	}
+	return oldPos
+}
+
+func longestCommonPrefix(a, b []byte) int {
+	i := 0
+	for ; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+	}
+	return i
+}
+
+// 按 key 的顺序遍历节点下的所有叶子节点，fn 返回 false 时终止遍历
+// key 在当前节点结束的叶子节点比所有子节点都要小
+func artWalk(node artNode, reverse bool, fn func(leaf *artLeaf) bool) bool {
+	if node == nil {
+		return true
+	}
+	n, ok := node.(artInnerNode)
+	if !ok {
+		return fn(node.(*artLeaf))
+	}
+	h := n.header()
+	if !reverse && h.terminal != nil && !fn(h.terminal) {
+		return false
+	}
+	if !artForEachChild(n, reverse, func(_ byte, child artNode) bool {
+		return artWalk(child, reverse, fn)
+	}) {
+		return false
+	}
+	if reverse && h.terminal != nil && !fn(h.terminal) {
+		return false
+	}
+	return true
+}
+
+// 按 key 的顺序遍历节点下所有不早于 start 的叶子节点，正向遍历时 key >= start，反向遍历时 key <= start
+// path 为到达节点 n 之前已经匹配的 key 的前缀，不满足条件的子树会被直接跳过
+func artWalkFrom(node artNode, path []byte, start []byte, reverse bool, fn func(leaf *artLeaf) bool) bool {
+	if node == nil {
+		return true
+	}
+	n, ok := node.(artInnerNode)
+	if !ok {
+		leaf := node.(*artLeaf)
+		cmp := bytes.Compare(leaf.key, start)
+		if (!reverse && cmp >= 0) || (reverse && cmp <= 0) {
+			return fn(leaf)
+		}
+		return true
+	}
+	h := n.header()
+
+	full := make([]byte, 0, len(path)+len(h.prefix)+1)
+	full = append(full, path...)
+	full = append(full, h.prefix...)
+	m := len(full)
+	if len(start) < m {
+		m = len(start)
+	}
+	// 子树中所有的 key 都以 full 开头，前缀不同时整棵子树要么都满足条件，要么都不满足
+	if cmp := bytes.Compare(full[:m], start[:m]); cmp != 0 {
+		if (cmp > 0) != reverse {
+			return artWalk(n, reverse, fn)
+		}
+		return true
+	}
+	// start 是 full 的前缀，子树中所有的 key 都不小于 start
+	if len(start) <= len(full) {
+		if !reverse {
+			return artWalk(n, reverse, fn)
+		}
+		if len(start) == len(full) && h.terminal != nil {
+			return fn(h.terminal)
+		}
+		return true
+	}
+
+	// full 是 start 的前缀，key 在当前节点结束的叶子节点小于 start，子节点按照边和 start 的下一个字节比较
+	next := start[len(full)]
+	if !artForEachChild(n, reverse, func(c byte, child artNode) bool {
+		switch {
+		case c == next:
+			return artWalkFrom(child, append(full, c), start, reverse, fn)
+		case (c > next) != reverse:
+			return artWalk(child, reverse, fn)
+		}
+		return true
+	}) {
+		return false
+	}
+	if reverse && h.terminal != nil && !fn(h.terminal) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,363 @@
+package index
+
+import (
+	"KV-go/data"
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestAdaptiveRadixTree_Put(t *testing.T) {
+	art := NewART()
+
+	res0, err := art.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
+
+	assert.Nil(t, err)
+	assert.Nil(t, res0)
+
+	res1, err := art.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 2})
+
+	assert.Nil(t, err)
+	assert.Nil(t, res1)
+
+	res2, err := art.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 3})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), res2.Offset)
+	assert.Equal(t, 2, art.Size())
+}
+
+func TestAdaptiveRadixTree_Get(t *testing.T) {
+	art := NewART()
+
+	art.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
+	pos1 := art.Get(nil)
+	assert.Equal(t, uint32(1), pos1.Fid)
+	assert.Equal(t, int64(100), pos1.Offset)
+
+	art.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 2})
+	art.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 3})
+	pos2 := art.Get([]byte("a"))
+	assert.Equal(t, uint32(1), pos2.Fid)
+	assert.Equal(t, int64(3), pos2.Offset)
+
+	// 一个 key 是另一个 key 的前缀
+	art.Put([]byte("abc"), &data.LogRecordPos{Fid: 2, Offset: 1})
+	art.Put([]byte("abcde"), &data.LogRecordPos{Fid: 2, Offset: 2})
+	art.Put([]byte("abd"), &data.LogRecordPos{Fid: 2, Offset: 3})
+	assert.Equal(t, int64(1), art.Get([]byte("abc")).Offset)
+	assert.Equal(t, int64(2), art.Get([]byte("abcde")).Offset)
+	assert.Equal(t, int64(3), art.Get([]byte("abd")).Offset)
+	assert.Nil(t, art.Get([]byte("ab")))
+	assert.Nil(t, art.Get([]byte("abcd")))
+	assert.Nil(t, art.Get([]byte("not exist")))
+}
+
+func TestAdaptiveRadixTree_Delete(t *testing.T) {
+	art := NewART()
+
+	res1, ok1, err := art.Delete([]byte("not exist"))
+
+	assert.Nil(t, err)
+	assert.False(t, ok1)
+	assert.Nil(t, res1)
+
+	art.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
+	res2, ok2, err := art.Delete(nil)
+	assert.Nil(t, err)
+	assert.True(t, ok2)
+	assert.Equal(t, int64(100), res2.Offset)
+
+	art.Put([]byte("aaa"), &data.LogRecordPos{Fid: 2, Offset: 1})
+	art.Put([]byte("aab"), &data.LogRecordPos{Fid: 2, Offset: 2})
+	res3, ok3, err := art.Delete([]byte("aaa"))
+	assert.Nil(t, err)
+	assert.True(t, ok3)
+	assert.Equal(t, int64(1), res3.Offset)
+	assert.Nil(t, art.Get([]byte("aaa")))
+	assert.Equal(t, int64(2), art.Get([]byte("aab")).Offset)
+	assert.Equal(t, 1, art.Size())
+
+	_, ok4, err := art.Delete([]byte("aaa"))
+
+	assert.Nil(t, err)
+	assert.False(t, ok4)
+}
+
+func TestAdaptiveRadixTree_Iterator(t *testing.T) {
+	art := NewART()
+	// 1.ART 为空的情况
+	iter1 := art.Iterator(false)
+	assert.Equal(t, false, iter1.Valid())
+
+	// 2.ART 有数据的情况
+	art.Put([]byte("ccde"), &data.LogRecordPos{Fid: 1, Offset: 10})
+	iter2 := art.Iterator(false)
+	assert.Equal(t, true, iter2.Valid())
+	assert.Equal(t, []byte("ccde"), iter2.Key())
+	assert.NotNil(t, iter2.Value())
+	iter2.Next()
+	assert.Equal(t, false, iter2.Valid())
+
+	// 3.有多条数据，按照 key 的顺序遍历
+	art.Put([]byte("acee"), &data.LogRecordPos{Fid: 1, Offset: 10})
+	art.Put([]byte("eede"), &data.LogRecordPos{Fid: 1, Offset: 10})
+	art.Put([]byte("bbcd"), &data.LogRecordPos{Fid: 1, Offset: 10})
+	art.Put([]byte("cc"), &data.LogRecordPos{Fid: 1, Offset: 10})
+	expected := []string{"acee", "bbcd", "cc", "ccde", "eede"}
+	var keys []string
+	iter3 := art.Iterator(false)
+	for iter3.Rewind(); iter3.Valid(); iter3.Next() {
+		keys = append(keys, string(iter3.Key()))
+	}
+	assert.Equal(t, expected, keys)
+
+	keys = nil
+	iter4 := art.Iterator(true)
+	for iter4.Rewind(); iter4.Valid(); iter4.Next() {
+		keys = append(keys, string(iter4.Key()))
+	}
+	assert.Equal(t, []string{"eede", "ccde", "cc", "bbcd", "acee"}, keys)
+
+	// 4.测试 seek
+	iter5 := art.Iterator(false)
+	iter5.Seek([]byte("cd"))
+	assert.Equal(t, []byte("eede"), iter5.Key())
+
+	// 5.反向遍历的 seek
+	iter6 := art.Iterator(true)
+	iter6.Seek([]byte("cd"))
+	assert.Equal(t, []byte("ccde"), iter6.Key())
+}
+
+// 随机写入和删除大量数据，节点会在各种类型之间扩容和缩小，结果和排序后的 map 保持一致
+func TestAdaptiveRadixTree_Random(t *testing.T) {
+	art := NewART()
+	expected := make(map[string]int64)
+	r := rand.New(rand.NewSource(1))
+
+	// 中途创建的迭代器看到的是当时的数据，之后节点的扩容、缩小和合并不影响快照
+	var snapshot Iterator
+	var snapshotKeys []string
+	for i := 0; i < 20000; i++ {
+		if i == 10000 {
+			snapshot = art.Iterator(false)
+			for k := range expected {
+				snapshotKeys = append(snapshotKeys, k)
+			}
+			sort.Strings(snapshotKeys)
+		}
+		key := []byte(fmt.Sprintf("key-%d", r.Intn(5000)))
+		if r.Intn(3) == 0 {
+			_, exist := expected[string(key)]
+			_, ok, err := art.Delete(key)
+			assert.Nil(t, err)
+			assert.Equal(t, exist, ok)
+			delete(expected, string(key))
+		} else {
+			art.Put(key, &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+			expected[string(key)] = int64(i)
+		}
+		// 单个字节的 key，用于测试 Node48 和 Node256
+		b := []byte{byte(r.Intn(256))}
+		art.Put(b, &data.LogRecordPos{Fid: 2, Offset: int64(i)})
+		expected[string(b)] = int64(i)
+	}
+	assert.Equal(t, len(expected), art.Size())
+
+	sortedKeys := make([]string, 0, len(expected))
+	for k, offset := range expected {
+		sortedKeys = append(sortedKeys, k)
+		pos := art.Get([]byte(k))
+		assert.NotNil(t, pos)
+		assert.Equal(t, offset, pos.Offset)
+	}
+	sort.Strings(sortedKeys)
+
+	var idx int
+	iter := art.Iterator(false)
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		assert.True(t, bytes.Equal([]byte(sortedKeys[idx]), iter.Key()))
+		idx++
+	}
+	assert.Equal(t, len(sortedKeys), idx)
+
+	idx = 0
+	for ; snapshot.Valid(); snapshot.Next() {
+		assert.Equal(t, snapshotKeys[idx], string(snapshot.Key()))
+		idx++
+	}
+	assert.Equal(t, len(snapshotKeys), idx)
+
+	// 全部删除
+	for _, k := range sortedKeys {
+		_, ok, err := art.Delete([]byte(k))
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	assert.Equal(t, 0, art.Size())
+	assert.Nil(t, art.root)
+}
+
+func TestAdaptiveRadixTree_NodeKinds(t *testing.T) {
+	art := NewART()
+	rootKind := func() artNodeKind {
+		return art.root.(artInnerNode).header().kind
+	}
+	expected := map[int]artNodeKind{2: artNode4, 4: artNode4, 5: artNode16, 16: artNode16, 17: artNode48, 48: artNode48, 49: artNode256}
+	for i := 0; i < 256; i++ {
+		art.Put([]byte{'k', byte(i)}, &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+		if kind, ok := expected[i+1]; ok {
+			assert.Equal(t, kind, rootKind(), "%d children", i+1)
+		}
+	}
+	assert.Equal(t, []byte("k"), art.root.(artInnerNode).header().prefix)
+
+	// 删除时在略小于扩容阈值的位置缩小
+	expected = map[int]artNodeKind{38: artNode256, 37: artNode48, 13: artNode48, 12: artNode16, 4: artNode16, 3: artNode4, 2: artNode4}
+	for i := 255; i > 0; i-- {
+		_, ok, err := art.Delete([]byte{'k', byte(i)})
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		if kind, ok := expected[i]; ok {
+			assert.Equal(t, kind, rootKind(), "%d children", i)
+		}
+	}
+	// 只剩下一个 key 时退化为叶子节点
+	leaf, ok := art.root.(*artLeaf)
+	assert.True(t, ok)
+	assert.Equal(t, []byte{'k', 0}, leaf.key)
+}
+
+func TestAdaptiveRadixTree_Iterator_Batches(t *testing.T) {
+	art := NewART()
+	n := iteratorBatchSize*3 + 7
+	for i := 0; i < n; i++ {
+		art.Put([]byte(fmt.Sprintf("key-%05d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+
+	// 跨越多个批次的正向和反向遍历
+	iter := art.Iterator(false)
+	count := 0
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		assert.Equal(t, fmt.Sprintf("key-%05d", count), string(iter.Key()))
+		count++
+	}
+	assert.Equal(t, n, count)
+
+	iter = art.Iterator(true)
+	count = 0
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		assert.Equal(t, fmt.Sprintf("key-%05d", n-1-count), string(iter.Key()))
+		count++
+	}
+	assert.Equal(t, n, count)
+
+	// 批次内的数据量和索引的大小无关
+	ai := art.Iterator(false).(*batchIterator)
+	assert.Equal(t, iteratorBatchSize, len(ai.values))
+
+	iter = art.Iterator(false)
+	iter.Seek([]byte(fmt.Sprintf("key-%05d", 200)))
+	assert.Equal(t, "key-00200", string(iter.Key()))
+	iter = art.Iterator(true)
+	iter.Seek([]byte("key-00200a"))
+	assert.Equal(t, "key-00200", string(iter.Key()))
+	iter.Next()
+	assert.Equal(t, "key-00199", string(iter.Key()))
+}
+
+// 随机的 key 之间互为前缀，seek 的结果和在排序后的数组中二分查找保持一致
+func TestAdaptiveRadixTree_Iterator_Seek(t *testing.T) {
+	art := NewART()
+	r := rand.New(rand.NewSource(1))
+	randomKey := func() []byte {
+		key := make([]byte, r.Intn(5))
+		for i := range key {
+			key[i] = "abc"[r.Intn(3)]
+		}
+		return key
+	}
+	keySet := make(map[string]struct{})
+	for i := 0; i < 200; i++ {
+		key := randomKey()
+		art.Put(key, &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+		keySet[string(key)] = struct{}{}
+	}
+	sortedKeys := make([]string, 0, len(keySet))
+	for k := range keySet {
+		sortedKeys = append(sortedKeys, k)
+	}
+	sort.Strings(sortedKeys)
+
+	for i := 0; i < 200; i++ {
+		target := randomKey()
+		idx := sort.SearchStrings(sortedKeys, string(target))
+		var expected []string
+		for j := idx; j < len(sortedKeys); j++ {
+			expected = append(expected, sortedKeys[j])
+		}
+		var keys []string
+		iter := art.Iterator(false)
+		for iter.Seek(target); iter.Valid(); iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		assert.Equal(t, expected, keys, "seek %q", target)
+
+		// 反向遍历从不大于 target 的最大的 key 开始
+		if idx == len(sortedKeys) || sortedKeys[idx] != string(target) {
+			idx--
+		}
+		expected = nil
+		for j := idx; j >= 0; j-- {
+			expected = append(expected, sortedKeys[j])
+		}
+		keys = nil
+		iter = art.Iterator(true)
+		for iter.Seek(target); iter.Valid(); iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		assert.Equal(t, expected, keys, "reverse seek %q", target)
+	}
+}
+
+func TestAdaptiveRadixTree_Iterator_Snapshot(t *testing.T) {
+	art := NewART()
+	for i := 0; i < 300; i++ {
+		art.Put([]byte(fmt.Sprintf("key-%05d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+
+	iter := art.Iterator(false)
+	// 创建迭代器之后的修改对迭代器不可见
+	for i := 0; i < 300; i += 2 {
+		art.Delete([]byte(fmt.Sprintf("key-%05d", i)))
+	}
+	art.Put([]byte("key-00001"), &data.LogRecordPos{Fid: 2, Offset: 100})
+	art.Put([]byte("key-99999"), &data.LogRecordPos{Fid: 2, Offset: 100})
+	art.Put([]byte("key-0000"), &data.LogRecordPos{Fid: 2, Offset: 100})
+
+	count := 0
+	for ; iter.Valid(); iter.Next() {
+		assert.Equal(t, fmt.Sprintf("key-%05d", count), string(iter.Key()))
+		assert.Equal(t, uint32(1), iter.Value().Fid)
+		count++
+	}
+	assert.Equal(t, 300, count)
+	iter.Close()
+
+	assert.Equal(t, 152, art.Size())
+	pos := art.Get([]byte("key-00001"))
+	assert.Equal(t, uint32(2), pos.Fid)
+	assert.Nil(t, art.Get([]byte("key-00000")))
+
+	// 快照之后的修改在新的迭代器中可见
+	count = 0
+	iter = art.Iterator(false)
+	for ; iter.Valid(); iter.Next() {
+		count++
+	}
+	assert.Equal(t, 152, count)
+}
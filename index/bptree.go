@@ -0,0 +1,196 @@
+package index
+
+import (
+	"KV-go/data"
+	"bytes"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"path/filepath"
+	"time"
+)
+
+// BptreeIndexFileName B+ 树索引文件的名称
+const BptreeIndexFileName = "bptree-index"
+
+var (
+	indexBucketName = []byte("bitcask-index")
+	metaBucketName  = []byte("bitcask-index-meta")
+	appliedKey      = []byte("applied")
+)
+
+// BPlusTree B+ 树索引，封装了 go.etcd.io/bbolt
+// 索引数据存储在磁盘上按页组织的 B+ 树文件中，不受内存大小的限制，启动时只需要重放最后一次更新之后写入的数据
+type BPlusTree struct {
+	tree *bbolt.DB
+}
+
+// NewBPlusTree 初始化 B+ 树索引，索引文件存放在数据目录中
+func NewBPlusTree(dirPath string, syncWrites bool) (*BPlusTree, error) {
+	opts := bbolt.DefaultOptions
+	opts.NoSync = !syncWrites
+	// 索引文件被其他进程打开时不一直等待
+	opts.Timeout = time.Second
+	bptree, err := bbolt.Open(filepath.Join(dirPath, BptreeIndexFileName), 0644, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bptree index: %w", err)
+	}
+
+	// 创建对应的 bucket
+	if err := bptree.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(indexBucketName); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(metaBucketName)
+		return err
+	}); err != nil {
+		_ = bptree.Close()
+		return nil, fmt.Errorf("failed to create bucket in bptree index: %w", err)
+	}
+
+	return &BPlusTree{tree: bptree}, nil
+}
+
+func (bpt *BPlusTree) Put(key []byte, pos *data.LogRecordPos) (*data.LogRecordPos, error) {
+	var oldPos *data.LogRecordPos
+	if err := bpt.tree.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(indexBucketName)
+		if oldValue := bucket.Get(key); len(oldValue) != 0 {
+			oldPos = data.DecodeLogRecordPos(oldValue)
+		}
+		return bucket.Put(key, data.EncodeLogRecordPos(pos))
+	}); err != nil {
+		return nil, err
+	}
+	return oldPos, nil
+}
+
+// Get 读取索引，索引已经关闭时返回 nil
+func (bpt *BPlusTree) Get(key []byte) *data.LogRecordPos {
+	var pos *data.LogRecordPos
+	_ = bpt.tree.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(indexBucketName)
+		value := bucket.Get(key)
+		if len(value) != 0 {
+			pos = data.DecodeLogRecordPos(value)
+		}
+		return nil
+	})
+	return pos
+}
+
+func (bpt *BPlusTree) Delete(key []byte) (*data.LogRecordPos, bool, error) {
+	var oldPos *data.LogRecordPos
+	if err := bpt.tree.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(indexBucketName)
+		if oldValue := bucket.Get(key); len(oldValue) != 0 {
+			oldPos = data.DecodeLogRecordPos(oldValue)
+			return bucket.Delete(key)
+		}
+		return nil
+	}); err != nil {
+		return nil, false, err
+	}
+	return oldPos, oldPos != nil, nil
+}
+
+// Size 索引中的数据量，索引已经关闭时返回 0
+func (bpt *BPlusTree) Size() int {
+	var size int
+	_ = bpt.tree.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(indexBucketName)
+		size = bucket.Stats().KeyN
+		return nil
+	})
+	return size
+}
+
+// ApplyBatch 在一个写事务中更新一批索引，并记录已经应用到索引中的位置，开启 SyncWrites 时整批只持久化一次
+func (bpt *BPlusTree) ApplyBatch(keys [][]byte, positions []*data.LogRecordPos,
+	applied *data.LogRecordPos) ([]*data.LogRecordPos, error) {
+	oldPositions := make([]*data.LogRecordPos, len(keys))
+	if err := bpt.tree.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(indexBucketName)
+		for i, key := range keys {
+			// 同一批中重复的 key 能读到前面写入的位置
+			if oldValue := bucket.Get(key); len(oldValue) != 0 {
+				oldPositions[i] = data.DecodeLogRecordPos(oldValue)
+			}
+			var err error
+			if positions[i] != nil {
+				err = bucket.Put(key, data.EncodeLogRecordPos(positions[i]))
+			} else if oldPositions[i] != nil {
+				err = bucket.Delete(key)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(metaBucketName).Put(appliedKey, data.EncodeLogRecordPos(applied))
+	}); err != nil {
+		return nil, err
+	}
+	return oldPositions, nil
+}
+
+// AppliedPosition 读取已经应用到索引中的位置，索引已经关闭时返回 nil
+func (bpt *BPlusTree) AppliedPosition() *data.LogRecordPos {
+	var pos *data.LogRecordPos
+	_ = bpt.tree.View(func(tx *bbolt.Tx) error {
+		if value := tx.Bucket(metaBucketName).Get(appliedKey); len(value) != 0 {
+			pos = data.DecodeLogRecordPos(value)
+		}
+		return nil
+	})
+	return pos
+}
+
+// Sync 持久化索引，没有开启 SyncWrites 时索引的更新不会立即持久化
+func (bpt *BPlusTree) Sync() error {
+	return bpt.tree.Sync()
+}
+
+// Iterator 每次在一个短的只读事务中取出一批数据，不会在遍历期间一直持有事务
+// 持有只读事务时 bbolt 无法扩容索引文件，写入会一直等待，调用方在遍历期间写入数据时就会死锁
+// 因此 B+ 树的迭代器不是快照，每一批数据都是读取时最新的索引
+func (bpt *BPlusTree) Iterator(reverse bool) Iterator {
+	return newBatchIterator(func(key []byte, fn func(item *Item) bool) {
+		// 索引已经关闭时返回错误，迭代器为空
+		_ = bpt.tree.View(func(tx *bbolt.Tx) error {
+			cursor := tx.Bucket(indexBucketName).Cursor()
+			var k, v []byte
+			switch {
+			case key == nil && reverse:
+				k, v = cursor.Last()
+			case key == nil:
+				k, v = cursor.First()
+			default:
+				k, v = cursor.Seek(key)
+				// 反向遍历时需要找到第一个小于等于目标的 key
+				if reverse {
+					if k == nil {
+						k, v = cursor.Last()
+					} else if !bytes.Equal(k, key) {
+						k, v = cursor.Prev()
+					}
+				}
+			}
+			for k != nil {
+				// bbolt 返回的数据只在事务期间有效，需要拷贝一份
+				item := &Item{key: append([]byte(nil), k...), pos: data.DecodeLogRecordPos(v)}
+				if !fn(item) {
+					return nil
+				}
+				if reverse {
+					k, v = cursor.Prev()
+				} else {
+					k, v = cursor.Next()
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func (bpt *BPlusTree) Close() error {
+	return bpt.tree.Close()
+}
@@ -0,0 +1,166 @@
+package index
+
+import (
+	"KV-go/data"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestBPlusTree_Put(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bptree-put")
+	defer os.RemoveAll(dir)
+	tree, err := NewBPlusTree(dir, false)
+	assert.Nil(t, err)
+	defer tree.Close()
+
+	res1, err := tree.Put([]byte("aac"), &data.LogRecordPos{Fid: 123, Offset: 999})
+
+	assert.Nil(t, err)
+	assert.Nil(t, res1)
+	res2, err := tree.Put([]byte("abc"), &data.LogRecordPos{Fid: 123, Offset: 999})
+	assert.Nil(t, err)
+	assert.Nil(t, res2)
+	res3, err := tree.Put([]byte("acc"), &data.LogRecordPos{Fid: 123, Offset: 999})
+	assert.Nil(t, err)
+	assert.Nil(t, res3)
+	assert.Equal(t, 3, tree.Size())
+
+	res4, err := tree.Put([]byte("acc"), &data.LogRecordPos{Fid: 1, Offset: 2, Size: 3})
+
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(123), res4.Fid)
+	assert.Equal(t, int64(999), res4.Offset)
+}
+
+func TestBPlusTree_Get(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bptree-get")
+	defer os.RemoveAll(dir)
+	tree, err := NewBPlusTree(dir, false)
+	assert.Nil(t, err)
+	defer tree.Close()
+
+	pos := tree.Get([]byte("not exist"))
+	assert.Nil(t, pos)
+
+	tree.Put([]byte("aac"), &data.LogRecordPos{Fid: 123, Offset: 999})
+	pos1 := tree.Get([]byte("aac"))
+	assert.Equal(t, uint32(123), pos1.Fid)
+	assert.Equal(t, int64(999), pos1.Offset)
+
+	tree.Put([]byte("aac"), &data.LogRecordPos{Fid: 9884, Offset: 1232})
+	pos2 := tree.Get([]byte("aac"))
+	assert.Equal(t, uint32(9884), pos2.Fid)
+	assert.Equal(t, int64(1232), pos2.Offset)
+}
+
+func TestBPlusTree_Delete(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bptree-delete")
+	defer os.RemoveAll(dir)
+	tree, err := NewBPlusTree(dir, false)
+	assert.Nil(t, err)
+	defer tree.Close()
+
+	res1, ok1, err := tree.Delete([]byte("not exist"))
+
+	assert.Nil(t, err)
+	assert.False(t, ok1)
+	assert.Nil(t, res1)
+
+	tree.Put([]byte("aac"), &data.LogRecordPos{Fid: 123, Offset: 999, Size: 10})
+	res2, ok2, err := tree.Delete([]byte("aac"))
+	assert.Nil(t, err)
+	assert.True(t, ok2)
+	assert.Equal(t, uint32(10), res2.Size)
+	assert.Nil(t, tree.Get([]byte("aac")))
+	assert.Equal(t, 0, tree.Size())
+}
+
+func TestBPlusTree_Iterator(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bptree-iter")
+	defer os.RemoveAll(dir)
+	tree, err := NewBPlusTree(dir, false)
+	assert.Nil(t, err)
+	defer tree.Close()
+
+	// 1.B+ 树为空的情况
+	iter1 := tree.Iterator(false)
+	assert.False(t, iter1.Valid())
+	iter1.Close()
+
+	tree.Put([]byte("ccde"), &data.LogRecordPos{Fid: 1, Offset: 10})
+	tree.Put([]byte("acee"), &data.LogRecordPos{Fid: 1, Offset: 10})
+	tree.Put([]byte("eede"), &data.LogRecordPos{Fid: 1, Offset: 10})
+	tree.Put([]byte("bbcd"), &data.LogRecordPos{Fid: 1, Offset: 10})
+
+	// 2.正向遍历
+	var keys []string
+	iter2 := tree.Iterator(false)
+	for iter2.Rewind(); iter2.Valid(); iter2.Next() {
+		keys = append(keys, string(iter2.Key()))
+		assert.NotNil(t, iter2.Value())
+	}
+	iter2.Close()
+	assert.Equal(t, []string{"acee", "bbcd", "ccde", "eede"}, keys)
+
+	// 3.反向遍历
+	keys = nil
+	iter3 := tree.Iterator(true)
+	for iter3.Rewind(); iter3.Valid(); iter3.Next() {
+		keys = append(keys, string(iter3.Key()))
+	}
+	iter3.Close()
+	assert.Equal(t, []string{"eede", "ccde", "bbcd", "acee"}, keys)
+
+	// 4.测试 seek
+	iter4 := tree.Iterator(false)
+	iter4.Seek([]byte("cc"))
+	assert.Equal(t, []byte("ccde"), iter4.Key())
+	iter4.Close()
+
+	// 5.反向遍历的 seek
+	iter5 := tree.Iterator(true)
+	iter5.Seek([]byte("cc"))
+	assert.Equal(t, []byte("bbcd"), iter5.Key())
+	iter5.Seek([]byte("zz"))
+	assert.Equal(t, []byte("eede"), iter5.Key())
+	iter5.Seek([]byte("ccde"))
+	assert.Equal(t, []byte("ccde"), iter5.Key())
+	iter5.Close()
+}
+
+func TestBPlusTree_ApplyBatch(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bptree-apply-batch")
+	defer os.RemoveAll(dir)
+	tree, err := NewBPlusTree(dir, false)
+	assert.Nil(t, err)
+	assert.Nil(t, tree.AppliedPosition())
+
+	_, err = tree.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 1})
+	assert.Nil(t, err)
+
+	// 同一批中重复的 key 能读到前面写入的位置，删除不存在的 key 不是错误
+	oldPositions, err := tree.ApplyBatch(
+		[][]byte{[]byte("a"), []byte("b"), []byte("b"), []byte("c")},
+		[]*data.LogRecordPos{nil, {Fid: 1, Offset: 2}, {Fid: 1, Offset: 3}, nil},
+		&data.LogRecordPos{Fid: 1, Offset: 100},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), oldPositions[0].Offset)
+	assert.Nil(t, oldPositions[1])
+	assert.Equal(t, int64(2), oldPositions[2].Offset)
+	assert.Nil(t, oldPositions[3])
+	assert.Nil(t, tree.Get([]byte("a")))
+	assert.Equal(t, int64(3), tree.Get([]byte("b")).Offset)
+	assert.Equal(t, 1, tree.Size())
+
+	// 已经应用的位置在重新打开之后仍然存在
+	assert.Nil(t, tree.Sync())
+	assert.Nil(t, tree.Close())
+	tree, err = NewBPlusTree(dir, false)
+	assert.Nil(t, err)
+	defer tree.Close()
+	applied := tree.AppliedPosition()
+	assert.Equal(t, uint32(1), applied.Fid)
+	assert.Equal(t, int64(100), applied.Offset)
+}
@@ -2,9 +2,7 @@ package index
 
 import (
 	"KV-go/data"
-	"bytes"
 	"github.com/google/btree"
-	"sort"
 	"sync"
 )
 
@@ -23,106 +21,73 @@ func NewBTree() *BTree {
 	}
 }
 
-func (bt *BTree) Put(key []byte, pos *data.LogRecordPos) bool {
+func (bt *BTree) Put(key []byte, pos *data.LogRecordPos) (*data.LogRecordPos, error) {
 	it := &Item{key: key, pos: pos}
 	bt.lock.Lock()
-	bt.tree.ReplaceOrInsert(it)
+	oldItem := bt.tree.ReplaceOrInsert(it)
 	bt.lock.Unlock()
-	return true
+	if oldItem == nil {
+		return nil, nil
+	}
+	return oldItem.(*Item).pos, nil
 }
 
 func (bt *BTree) Get(key []byte) *data.LogRecordPos {
 	it := &Item{key: key}
+	bt.lock.RLock()
 	btreeItem := bt.tree.Get(it)
+	bt.lock.RUnlock()
 	if btreeItem == nil {
 		return nil
 	}
 	return btreeItem.(*Item).pos
 }
 
-func (bt *BTree) Delete(key []byte) bool {
+func (bt *BTree) Delete(key []byte) (*data.LogRecordPos, bool, error) {
 	it := &Item{key: key}
 	bt.lock.Lock()
 	oldItem := bt.tree.Delete(it)
 	bt.lock.Unlock()
 	if oldItem == nil {
-		return false
+		return nil, false, nil
 	}
-	return true
+	return oldItem.(*Item).pos, true, nil
 }
 
 func (bt *BTree) Size() int {
-	//bt.lock.RLock()
-	//defer bt.lock.RUnlock()
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
 	return bt.tree.Len()
 }
 
+// Iterator 克隆一份索引的快照进行遍历，克隆是写时复制的，之后对索引的修改不会影响到迭代器看到的数据
 func (bt *BTree) Iterator(reverse bool) Iterator {
 	if bt.tree == nil {
 		return nil
 	}
-	bt.lock.RLock()
-	defer bt.lock.RUnlock()
-	return newBtreeIterator(bt.tree, reverse)
-}
-
-// Btree 的索引迭代器
-type btreeIterator struct {
-	currIndex int     // 当前遍历的下标位置
-	reverse   bool    // 是否是反向的遍历
-	values    []*Item // key 和 位置索引信息
-}
-
-func newBtreeIterator(tree *btree.BTree, reverse bool) *btreeIterator {
-	var idx int
-	values := make([]*Item, tree.Len())
-
-	// 将所有的数据存放到数组中
-	// 潜在的问题：内容容量的膨胀
-	saveValues := func(it btree.Item) bool {
-		values[idx] = it.(*Item)
-		idx++
-		return true
-	}
-	if reverse {
-		tree.Descend(saveValues)
-	} else {
-		tree.Ascend(saveValues)
-	}
+	// Clone 会修改原来的树的写时复制标记，不能和其他的 Clone 并发执行
+	bt.lock.Lock()
+	snapshot := bt.tree.Clone()
+	bt.lock.Unlock()
 
-	return &btreeIterator{
-		currIndex: 0,
-		reverse:   reverse,
-		values:    values,
-	}
+	return newBatchIterator(func(key []byte, fn func(item *Item) bool) {
+		iter := func(it btree.Item) bool {
+			return fn(it.(*Item))
+		}
+		pivot := &Item{key: key}
+		switch {
+		case key == nil && reverse:
+			snapshot.Descend(iter)
+		case key == nil:
+			snapshot.Ascend(iter)
+		case reverse:
+			snapshot.DescendLessOrEqual(pivot, iter)
+		default:
+			snapshot.AscendGreaterOrEqual(pivot, iter)
+		}
+	})
 }
 
-func (bti *btreeIterator) Rewind() {
-	bti.currIndex = 0
-}
-func (bti *btreeIterator) Seek(key []byte) {
-	if bti.reverse {
-		bti.currIndex = sort.Search(len(bti.values), func(i int) bool {
-			return bytes.Compare(bti.values[i].key, key) <= 0
-		})
-	} else {
-		bti.currIndex = sort.Search(len(bti.values), func(i int) bool {
-			return bytes.Compare(bti.values[i].key, key) >= 0
-		})
-	}
-}
-func (bti *btreeIterator) Next() {
-	bti.currIndex += 1
-}
-func (bti *btreeIterator) Valid() bool {
-	return bti.currIndex < len(bti.values)
-}
-func (bti *btreeIterator) Key() []byte {
-	return bti.values[bti.currIndex].key
-}
-func (bti *btreeIterator) Value() *data.LogRecordPos {
-	return bti.values[bti.currIndex].pos
-}
-func (bti *btreeIterator) Close() {
-	bti.values = nil
+func (bt *BTree) Close() error {
+	return nil
 }
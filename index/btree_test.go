@@ -2,6 +2,7 @@ package index
 
 import (
 	"KV-go/data"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -9,29 +10,44 @@ import (
 func TestBTree_Put(t *testing.T) {
 	bt := NewBTree()
 
-	res0 := bt.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
-	assert.True(t, res0)
+	res0, err := bt.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
 
-	res1 := bt.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 2})
-	assert.True(t, res1)
+	assert.Nil(t, err)
+	assert.Nil(t, res0)
 
+	res1, err := bt.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 2})
+
+	assert.Nil(t, err)
+	assert.Nil(t, res1)
+
+	res2, err := bt.Put([]byte("a"), &data.LogRecordPos{Fid: 11, Offset: 12})
+
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), res2.Fid)
+	assert.Equal(t, int64(2), res2.Offset)
 }
 
 func TestBTree_Get(t *testing.T) {
 	bt := NewBTree()
 
-	res0 := bt.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
-	assert.True(t, res0)
+	res0, err := bt.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
+
+	assert.Nil(t, err)
+	assert.Nil(t, res0)
 
 	pos1 := bt.Get(nil)
 	assert.Equal(t, uint32(1), pos1.Fid)
 	assert.Equal(t, int64(100), pos1.Offset)
 
-	res1 := bt.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 2})
-	assert.True(t, res1)
+	res1, err := bt.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 2})
 
-	res2 := bt.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 3})
-	assert.True(t, res2)
+	assert.Nil(t, err)
+	assert.Nil(t, res1)
+
+	res2, err := bt.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 3})
+
+	assert.Nil(t, err)
+	assert.NotNil(t, res2)
 
 	pos2 := bt.Get([]byte("a"))
 	assert.Equal(t, uint32(1), pos2.Fid)
@@ -40,16 +56,30 @@ func TestBTree_Get(t *testing.T) {
 
 func TestBTree_Delete(t *testing.T) {
 	bt := NewBTree()
-	res1 := bt.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
-	assert.True(t, res1)
+	res1, err := bt.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
+	assert.Nil(t, err)
+	assert.Nil(t, res1)
+
+	res2, ok1, err := bt.Delete(nil)
 
-	res2 := bt.Delete(nil)
-	assert.True(t, res2)
+	assert.Nil(t, err)
+	assert.True(t, ok1)
+	assert.Equal(t, int64(100), res2.Offset)
 
-	res3 := bt.Put([]byte("aaa"), &data.LogRecordPos{Fid: 2, Offset: 1})
-	assert.True(t, res3)
-	res4 := bt.Delete([]byte("aaa"))
-	assert.True(t, res4)
+	res3, err := bt.Put([]byte("aaa"), &data.LogRecordPos{Fid: 2, Offset: 1})
+
+	assert.Nil(t, err)
+	assert.Nil(t, res3)
+	res4, ok2, err := bt.Delete([]byte("aaa"))
+	assert.Nil(t, err)
+	assert.True(t, ok2)
+	assert.Equal(t, uint32(2), res4.Fid)
+
+	res6, ok3, err := bt.Delete([]byte("aaa"))
+
+	assert.Nil(t, err)
+	assert.False(t, ok3)
+	assert.Nil(t, res6)
 
 	res5 := bt.Get([]byte("aaa"))
 	assert.Nil(t, res5)
@@ -97,3 +127,69 @@ func TestBTree_Iterator(t *testing.T) {
 		assert.NotNil(t, iter6.Key())
 	}
 }
+
+func TestBTree_Iterator_Batches(t *testing.T) {
+	bt := NewBTree()
+	n := iteratorBatchSize*3 + 7
+	for i := 0; i < n; i++ {
+		bt.Put([]byte(fmt.Sprintf("key-%05d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+
+	// 跨越多个批次的正向和反向遍历
+	iter := bt.Iterator(false)
+	count := 0
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		assert.Equal(t, fmt.Sprintf("key-%05d", count), string(iter.Key()))
+		count++
+	}
+	assert.Equal(t, n, count)
+
+	iter = bt.Iterator(true)
+	count = 0
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		assert.Equal(t, fmt.Sprintf("key-%05d", n-1-count), string(iter.Key()))
+		count++
+	}
+	assert.Equal(t, n, count)
+
+	// 批次内的数据量和索引的大小无关
+	bti := bt.Iterator(false).(*batchIterator)
+	assert.Equal(t, iteratorBatchSize, len(bti.values))
+
+	iter = bt.Iterator(false)
+	iter.Seek([]byte(fmt.Sprintf("key-%05d", 200)))
+	assert.Equal(t, "key-00200", string(iter.Key()))
+	iter = bt.Iterator(true)
+	iter.Seek([]byte("key-00200a"))
+	assert.Equal(t, "key-00200", string(iter.Key()))
+	iter.Next()
+	assert.Equal(t, "key-00199", string(iter.Key()))
+}
+
+func TestBTree_Iterator_Snapshot(t *testing.T) {
+	bt := NewBTree()
+	for i := 0; i < 300; i++ {
+		bt.Put([]byte(fmt.Sprintf("key-%05d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+
+	iter := bt.Iterator(false)
+	// 创建迭代器之后的修改对迭代器不可见
+	for i := 0; i < 300; i += 2 {
+		bt.Delete([]byte(fmt.Sprintf("key-%05d", i)))
+	}
+	bt.Put([]byte("key-00001"), &data.LogRecordPos{Fid: 2, Offset: 100})
+	bt.Put([]byte("key-99999"), &data.LogRecordPos{Fid: 2, Offset: 100})
+
+	count := 0
+	for ; iter.Valid(); iter.Next() {
+		assert.Equal(t, fmt.Sprintf("key-%05d", count), string(iter.Key()))
+		assert.Equal(t, uint32(1), iter.Value().Fid)
+		count++
+	}
+	assert.Equal(t, 300, count)
+	iter.Close()
+
+	assert.Equal(t, 151, bt.Size())
+	pos := bt.Get([]byte("key-00001"))
+	assert.Equal(t, uint32(2), pos.Fid)
+}
@@ -3,25 +3,47 @@ package index
 import (
 	"KV-go/data"
 	"bytes"
+	"errors"
 	"github.com/google/btree"
 )
 
+// ErrUnsupportedIndexType 不支持的索引类型
+var ErrUnsupportedIndexType = errors.New("unsupported index type")
+
 // Indexer 抽象索引接口，后续接入其他数据结构，只需实现这个接口
 type Indexer interface {
-	// Put 向索引中插入Key-Value
-	Put(key []byte, pos *data.LogRecordPos) bool
+	// Put 向索引中插入Key-Value，返回被覆盖的旧的位置信息
+	Put(key []byte, pos *data.LogRecordPos) (*data.LogRecordPos, error)
 
 	// Get 根据Key取出Value
 	Get(key []byte) *data.LogRecordPos
 
-	// Delete 根据Key删除对应的Value
-	Delete(key []byte) bool
+	// Delete 根据Key删除对应的Value，返回被删除的位置信息，以及 key 是否存在
+	Delete(key []byte) (*data.LogRecordPos, bool, error)
 
 	// Size 索引中数据量
 	Size() int
 
 	// Iterator 索引迭代器
 	Iterator(reverse bool) Iterator
+
+	// Close 关闭索引
+	Close() error
+}
+
+// BatchIndexer 持久化在磁盘上的索引
+// 一批索引在一次原子操作中更新，同时记录已经应用到索引中的数据文件的位置，启动时只需要从这个位置开始重放数据文件
+type BatchIndexer interface {
+	Indexer
+
+	// ApplyBatch 原子地更新一批索引，pos 为 nil 表示删除，并将已经应用的位置更新为 applied，返回每个 key 旧的位置信息
+	ApplyBatch(keys [][]byte, positions []*data.LogRecordPos, applied *data.LogRecordPos) ([]*data.LogRecordPos, error)
+
+	// AppliedPosition 已经应用到索引中的数据文件的位置，只有 Fid 和 Offset 有效，没有记录时返回 nil
+	AppliedPosition() *data.LogRecordPos
+
+	// Sync 持久化索引
+	Sync() error
 }
 
 type IndexType = int8
@@ -32,17 +54,22 @@ const (
 
 	// ART 自适应基数树索引
 	ART
+
+	// BPTree B+ 树索引，将索引存储在磁盘上
+	BPTree
 )
 
 // NewIndexer 根据类型初始化初始化
-func NewIndexer(typ IndexType) Indexer {
+func NewIndexer(typ IndexType, dirPath string, sync bool) (Indexer, error) {
 	switch typ {
 	case Btree:
-		return NewBTree()
+		return NewBTree(), nil
 	case ART:
-		return nil
+		return NewART(), nil
+	case BPTree:
+		return NewBPlusTree(dirPath, sync)
 	default:
-		panic("unsupported index type")
+		return nil, ErrUnsupportedIndexType
 	}
 }
 
@@ -65,3 +92,76 @@ type Iterator interface {
 	Value() *data.LogRecordPos // 当前遍历位置的 Value 数据
 	Close()                    // 关闭迭代器，释放相应的资源
 }
+
+// iteratorBatchSize 迭代器每次从索引中取出的数据量
+const iteratorBatchSize = 128
+
+// walkFunc 按照遍历的方向从 key 开始依次访问索引中的数据，key 为 nil 时从头开始，fn 返回 false 时终止
+// 正向遍历时从第一个大于等于 key 的数据开始，反向遍历时从第一个小于等于 key 的数据开始
+type walkFunc func(key []byte, fn func(item *Item) bool)
+
+// batchIterator 分批遍历索引的迭代器
+// 每次只通过 walk 从索引中取出一批数据，这一批遍历完之后再从最后一个 key 之后继续取，内存占用和索引的大小无关
+type batchIterator struct {
+	walk      walkFunc
+	values    []*Item // 当前批次的 key 和位置索引信息
+	currIndex int     // 当前遍历的下标位置
+	hasMore   bool    // 当前批次之后是否还有数据
+}
+
+func newBatchIterator(walk walkFunc) *batchIterator {
+	bi := &batchIterator{
+		walk:   walk,
+		values: make([]*Item, 0, iteratorBatchSize),
+	}
+	bi.Rewind()
+	return bi
+}
+
+func (bi *batchIterator) Rewind() {
+	bi.fill(nil, true)
+}
+func (bi *batchIterator) Seek(key []byte) {
+	bi.fill(key, true)
+}
+func (bi *batchIterator) Next() {
+	bi.currIndex += 1
+	if bi.currIndex == len(bi.values) && bi.hasMore {
+		bi.fill(bi.values[len(bi.values)-1].key, false)
+	}
+}
+func (bi *batchIterator) Valid() bool {
+	return bi.currIndex < len(bi.values)
+}
+func (bi *batchIterator) Key() []byte {
+	return bi.values[bi.currIndex].key
+}
+func (bi *batchIterator) Value() *data.LogRecordPos {
+	return bi.values[bi.currIndex].pos
+}
+func (bi *batchIterator) Close() {
+	bi.walk = nil
+	bi.values = nil
+}
+
+// fill 从 key 开始取出下一批数据，inclusive 表示是否包含 key 本身
+func (bi *batchIterator) fill(key []byte, inclusive bool) {
+	bi.values = bi.values[:0]
+	bi.currIndex = 0
+	bi.hasMore = false
+	if bi.walk == nil {
+		return
+	}
+
+	bi.walk(key, func(item *Item) bool {
+		if !inclusive && bytes.Equal(item.key, key) {
+			return true
+		}
+		if len(bi.values) == iteratorBatchSize {
+			bi.hasMore = true
+			return false
+		}
+		bi.values = append(bi.values, item)
+		return true
+	})
+}
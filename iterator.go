@@ -10,38 +10,70 @@ type Iterator struct {
 	indexIter index.Iterator // 索引迭代器
 	db        *DB
 	options   IteratorOptions
+
+	// 由 Prefix、LowerBound 和 UpperBound 共同决定的遍历范围 [lowerBound, upperBound)，为 nil 表示没有边界
+	lowerBound []byte
+	upperBound []byte
+
+	count    int  // 已经遍历的 key 的数量
+	finished bool // 是否已经越过了遍历的边界
 }
 
 // NewIterator 创建一个迭代器
 func (db *DB) NewIterator(options IteratorOptions) *Iterator {
 	indexIter := db.index.Iterator(options.Reverse)
-	return &Iterator{
+	it := &Iterator{
 		db:        db,
 		indexIter: indexIter,
 		options:   options,
 	}
+	it.lowerBound, it.upperBound = iteratorBounds(options)
+	return it
 }
 
 // Rewind 重新回到迭代器的起点
 func (it *Iterator) Rewind() {
-	it.indexIter.Rewind()
+	it.count = 0
+	it.finished = false
+	switch {
+	case it.options.Reverse && it.upperBound != nil:
+		it.indexIter.Seek(it.upperBound)
+	case !it.options.Reverse && it.lowerBound != nil:
+		it.indexIter.Seek(it.lowerBound)
+	default:
+		it.indexIter.Rewind()
+	}
 	it.skipToNext()
 }
 
 // Seek 根据传入的 Key 查找到第一个大于等于的目标 Key，根据这个 Key 开始遍历
+// 反向遍历时查找第一个小于等于的目标 Key，超出遍历范围的 Key 会被限制在边界上
 func (it *Iterator) Seek(key []byte) {
+	it.count = 0
+	it.finished = false
+	if it.options.Reverse {
+		if it.upperBound != nil && bytes.Compare(key, it.upperBound) > 0 {
+			key = it.upperBound
+		}
+	} else if it.lowerBound != nil && bytes.Compare(key, it.lowerBound) < 0 {
+		key = it.lowerBound
+	}
 	it.indexIter.Seek(key)
 	it.skipToNext()
 }
 
 // Next 跳转到下一个 Key
 func (it *Iterator) Next() {
+	it.count++
 	it.indexIter.Next()
 	it.skipToNext()
 }
 
 // Valid 是否有效，即是否已经遍历完了所有的 Key，用于退出遍历
 func (it *Iterator) Valid() bool {
+	if it.finished || (it.options.Limit > 0 && it.count >= it.options.Limit) {
+		return false
+	}
 	return it.indexIter.Valid()
 }
 
@@ -63,15 +95,67 @@ func (it *Iterator) Close() {
 	it.indexIter.Close()
 }
 
+// skipToNext 跳过已经过期的 key，越过遍历范围的边界之后结束遍历
 func (it *Iterator) skipToNext() {
-	prefixLen := len(it.options.Prefix)
-	if prefixLen == 0 {
-		return
-	}
 	for ; it.indexIter.Valid(); it.indexIter.Next() {
 		key := it.indexIter.Key()
-		if prefixLen <= len(key) && bytes.Compare(key[:prefixLen], it.options.Prefix) == 0 {
-			break
+		if it.options.Reverse {
+			if it.lowerBound != nil && bytes.Compare(key, it.lowerBound) < 0 {
+				it.finished = true
+				return
+			}
+			// 上界不包含在遍历范围内
+			if it.upperBound != nil && bytes.Compare(key, it.upperBound) >= 0 {
+				continue
+			}
+		} else {
+			if it.upperBound != nil && bytes.Compare(key, it.upperBound) >= 0 {
+				it.finished = true
+				return
+			}
+			if it.lowerBound != nil && bytes.Compare(key, it.lowerBound) < 0 {
+				continue
+			}
+		}
+		// 跳过已经过期的 key
+		if it.indexIter.Value().IsExpired() {
+			continue
+		}
+		return
+	}
+}
+
+// iteratorBounds 将前缀转换为范围，并和 LowerBound、UpperBound 取交集
+func iteratorBounds(options IteratorOptions) (lowerBound, upperBound []byte) {
+	lowerBound, upperBound = options.LowerBound, options.UpperBound
+	if len(lowerBound) == 0 {
+		lowerBound = nil
+	}
+	if len(upperBound) == 0 {
+		upperBound = nil
+	}
+	if len(options.Prefix) == 0 {
+		return
+	}
+	if lowerBound == nil || bytes.Compare(options.Prefix, lowerBound) > 0 {
+		lowerBound = options.Prefix
+	}
+	if prefixEnd := prefixSuccessor(options.Prefix); prefixEnd != nil &&
+		(upperBound == nil || bytes.Compare(prefixEnd, upperBound) < 0) {
+		upperBound = prefixEnd
+	}
+	return
+}
+
+// prefixSuccessor 所有以 prefix 开头的 key 都小于返回值，prefix 全部为 0xFF 时返回 nil
+func prefixSuccessor(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xFF {
+			end := make([]byte, i+1)
+			copy(end, prefix)
+			end[i]++
+			return end
 		}
 	}
+	return nil
 }
@@ -5,6 +5,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestDB_NewIterator(t *testing.T) {
@@ -96,3 +97,134 @@ func TestDB_Iterator_Multi_Values(t *testing.T) {
 	}
 	iter3.Close()
 }
+
+func iteratorKeys(iter *Iterator) []string {
+	var keys []string
+	for ; iter.Valid(); iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	return keys
+}
+
+func TestDB_Iterator_Bounds(t *testing.T) {
+	for _, indexType := range []IndexerType{Btree, ART, BPTree} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-iterator-bounds")
+		opts.DirPath = dir
+		opts.IndexType = indexType
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		for _, key := range []string{"a", "b1", "b2", "b3", "c", "d1", "d2"} {
+			assert.Nil(t, db.Put([]byte(key), []byte(key)))
+		}
+
+		// 左闭右开
+		iter := db.NewIterator(IteratorOptions{LowerBound: []byte("b2"), UpperBound: []byte("d1")})
+		iter.Rewind()
+		assert.Equal(t, []string{"b2", "b3", "c"}, iteratorKeys(iter))
+		iter.Seek([]byte("a"))
+		assert.Equal(t, []string{"b2", "b3", "c"}, iteratorKeys(iter))
+		iter.Seek([]byte("b3"))
+		assert.Equal(t, []string{"b3", "c"}, iteratorKeys(iter))
+		iter.Seek([]byte("z"))
+		assert.Empty(t, iteratorKeys(iter))
+		iter.Close()
+
+		iter = db.NewIterator(IteratorOptions{LowerBound: []byte("b2"), UpperBound: []byte("d1"), Reverse: true})
+		iter.Rewind()
+		assert.Equal(t, []string{"c", "b3", "b2"}, iteratorKeys(iter))
+		iter.Seek([]byte("z"))
+		assert.Equal(t, []string{"c", "b3", "b2"}, iteratorKeys(iter))
+		iter.Seek([]byte("b3"))
+		assert.Equal(t, []string{"b3", "b2"}, iteratorKeys(iter))
+		iter.Close()
+
+		// 前缀和边界取交集
+		iter = db.NewIterator(IteratorOptions{Prefix: []byte("b"), LowerBound: []byte("b2")})
+		iter.Rewind()
+		assert.Equal(t, []string{"b2", "b3"}, iteratorKeys(iter))
+		iter.Close()
+		iter = db.NewIterator(IteratorOptions{Prefix: []byte("d"), Reverse: true})
+		iter.Rewind()
+		assert.Equal(t, []string{"d2", "d1"}, iteratorKeys(iter))
+		iter.Close()
+
+		// 数量限制
+		iter = db.NewIterator(IteratorOptions{LowerBound: []byte("b"), Limit: 2})
+		iter.Rewind()
+		assert.Equal(t, []string{"b1", "b2"}, iteratorKeys(iter))
+		iter.Seek([]byte("c"))
+		assert.Equal(t, []string{"c", "d1"}, iteratorKeys(iter))
+		iter.Close()
+
+		destroyDB(db)
+	}
+}
+
+func TestDB_Iterator_SeekToPrefix(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-iterator-prefix")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.Put([]byte("\xff\xff"), []byte("1")))
+	assert.Nil(t, db.Put([]byte("\xff\xff\x01"), []byte("2")))
+	assert.Nil(t, db.Put([]byte("\xff\xfe"), []byte("3")))
+
+	iter := db.NewIterator(IteratorOptions{Prefix: []byte("\xff\xff")})
+	iter.Rewind()
+	assert.Equal(t, []string{"\xff\xff", "\xff\xff\x01"}, iteratorKeys(iter))
+	iter.Close()
+
+	assert.Equal(t, []byte("ab"), prefixSuccessor([]byte("aa")))
+	assert.Equal(t, []byte("b"), prefixSuccessor([]byte("a\xff")))
+	assert.Nil(t, prefixSuccessor([]byte("\xff\xff")))
+}
+
+// B+ 树的迭代器不能一直持有只读事务，否则并发的写入在索引文件扩容时会一直等待，和读取数据时的锁形成死锁
+func TestDB_Iterator_BPTree_ConcurrentPut(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-iterator-bptree")
+	opts.DirPath = dir
+	opts.IndexType = BPTree
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 500; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(10)))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// 持续写入新的 key，让 B+ 树索引文件不断扩容
+		for i := 500; i < 20000; i++ {
+			if err := db.Put(utils.GetTestKey(i), utils.RandomValue(10)); err != nil {
+				return
+			}
+		}
+	}()
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for round := 0; round < 20; round++ {
+			iter := db.NewIterator(DefaultIteratorOptions)
+			for iter.Rewind(); iter.Valid(); iter.Next() {
+				_, _ = iter.Value()
+			}
+			iter.Close()
+		}
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(30 * time.Second):
+		t.Fatal("iterator deadlocked with concurrent writes")
+	}
+	<-done
+}
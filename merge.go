@@ -2,21 +2,33 @@ package kv_go
 
 import (
 	"KV-go/data"
+	"KV-go/utils"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	mergeDirName     = "merge"
 	mergeFinishedKey = "merge.finished"
+
+	// 安装 merge 之后的文件时使用的临时文件后缀
+	mergeInstallSuffix = ".installing"
 )
 
 // Merge 清理无效数据，生成 Hint 文件
+// merge 的结果写在单独的 merge 目录中，下次打开数据库时才会安装到数据目录中
+// 在此之前被 merge 过的旧数据文件仍然占用磁盘空间，长时间运行的进程需要重启之后才能释放
 func (db *DB) Merge() error {
+	if db.option.ReadOnly {
+		return ErrReadOnly
+	}
 	// 数据库没有文件
 	if db.activeFile == nil {
 		return nil
@@ -29,9 +41,28 @@ func (db *DB) Merge() error {
 	}
 	db.isMerging = true
 	defer func() {
+		db.mu.Lock()
 		db.isMerging = false
+		db.mu.Unlock()
 	}()
 
+	// 查看剩余的磁盘空间是否可以容纳 merge 之后的数据量
+	dirSize, err := utils.DirSize(db.option.DirPath)
+	if err != nil {
+		db.mu.Unlock()
+		return err
+	}
+	reclaimSize := atomic.LoadInt64(&db.reclaimSize)
+	availableSize, err := utils.AvailableDiskSize(db.option.DirPath)
+	if err != nil {
+		db.mu.Unlock()
+		return err
+	}
+	if uint64(dirSize-reclaimSize) >= availableSize {
+		db.mu.Unlock()
+		return ErrNoEnoughSpaceForMerge
+	}
+
 	// 持久化当前活跃文件
 	if err := db.activeFile.Sync(); err != nil {
 		db.mu.Unlock()
@@ -44,8 +75,14 @@ func (db *DB) Merge() error {
 		db.mu.Unlock()
 		return err
 	}
+	// 持久化的索引从新的活跃文件开始记录已经应用的位置，安装 merge 的结果之后旧的数据文件中的位置会失效
+	if err := db.saveAppliedPosition(); err != nil {
+		db.mu.Unlock()
+		return err
+	}
 	// 记录最近没有参与 merge 的文件 id
 	nonMergeFileId := db.activeFile.FileId
+	epoch := db.replicationEpoch
 
 	// 取出所有需要 merge 的文件
 	var mergeFiles []*data.DataFile
@@ -74,16 +111,32 @@ func (db *DB) Merge() error {
 	mergeOptions := db.option
 	mergeOptions.DirPath = mergePath
 	mergeOptions.SyncWrites = false
+	// 临时实例不会用到索引，使用内存索引，避免在 merge 目录中生成 B+ 树索引文件
+	mergeOptions.IndexType = Btree
+	mergeOptions.MergeRatio = 0
+	mergeOptions.ExpireCheckInterval = 0
+	// 临时实例在 merge 结束时统一持久化，不需要后台持久化和读缓存
+	mergeOptions.SyncInterval = 0
+	mergeOptions.BytesPerSync = 0
+	mergeOptions.ValueCacheSize = 0
+	mergeOptions.ReadOnly = false
 	mergeDB, err := Open(mergeOptions)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		_ = mergeDB.Close()
+	}()
 
 	// 打开 Hint 文件存储索引
 	hintFile, err := data.OpenHintFile(mergePath)
 	if err != nil {
-		return nil
+		return err
 	}
+	hintFile.Codec = db.codec
+	defer func() {
+		_ = hintFile.Close()
+	}()
 
 	// 遍历处理每个数据文件
 	for _, dataFile := range mergeFiles {
@@ -94,13 +147,19 @@ func (db *DB) Merge() error {
 				if err == io.EOF {
 					break
 				}
+				// 启动时跳过的损坏记录不需要重写
+				if err == data.ErrInvalidCRC && size > 0 && db.option.RecoveryPolicy == RecoverySkipCorrupt {
+					offset += size
+					continue
+				}
 				return err
 			}
 			// 解析拿到实际的 key
 			realKey, _ := parseLogRecordKey(logRecord.Key)
 			logRecordPos := db.index.Get(realKey)
-			// 和内存中的索引位置进行比较，如果有效则重写
-			if logRecordPos != nil && logRecordPos.Fid == dataFile.FileId && logRecordPos.Offset == offset {
+			// 和内存中的索引位置进行比较，如果有效并且没有过期则重写
+			if logRecordPos != nil && logRecordPos.Fid == dataFile.FileId && logRecordPos.Offset == offset &&
+				!data.IsExpired(logRecord.Expire) {
 				// 清除事务标记
 				logRecord.Key = logRecordKeyWithSeq(realKey, nonTransactionSeqNo)
 				pos, err := mergeDB.appendLogRecord(logRecord)
@@ -125,11 +184,19 @@ func (db *DB) Merge() error {
 		return err
 	}
 
+	// 被 merge 的数据文件会被重写，安装之后使用新的复制 epoch
+	if err := saveReplicationEpoch(mergePath, epoch+1); err != nil {
+		return err
+	}
+
 	// 写标识 merge 完成的文件
 	mergeFinishedFile, err := data.OpenMergeFinishedFile(mergePath)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		_ = mergeFinishedFile.Close()
+	}()
 
 	mergeFinRecord := &data.LogRecord{
 		Key:   []byte(mergeFinishedKey),
@@ -143,11 +210,167 @@ func (db *DB) Merge() error {
 		return err
 	}
 
+	// 记录本次 merge 能够回收的数据量，这部分数据在下次启动时才会被真正清理
+	atomic.StoreInt64(&db.mergedReclaimSize, reclaimSize)
+
 	return nil
 }
 
+// 后台定期检查无效数据的占比，达到阈值之后自动进行 merge
+func (db *DB) autoMerge() {
+	defer db.bgWg.Done()
+
+	ticker := time.NewTicker(db.option.MergeCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if db.reachMergeRatio() {
+				_ = db.Merge()
+			}
+		case <-db.closeCh:
+			return
+		}
+	}
+}
+
+// 无效数据的占比是否达到了自动 merge 的阈值
+// 已经 merge 过但还没有清理的数据不计算在内，避免重复 merge
+func (db *DB) reachMergeRatio() bool {
+	dirSize, err := utils.DirSize(db.option.DirPath)
+	if err != nil {
+		return false
+	}
+	mergedReclaimSize := atomic.LoadInt64(&db.mergedReclaimSize)
+	reclaimSize := atomic.LoadInt64(&db.reclaimSize) - mergedReclaimSize
+	totalSize := dirSize - mergedReclaimSize
+	if reclaimSize <= 0 || totalSize <= 0 {
+		return false
+	}
+	return float32(reclaimSize)/float32(totalSize) >= db.option.MergeRatio
+}
+
 func (db *DB) getMergePath() string {
-	dir := path.Dir(path.Clean(db.option.DirPath))
-	base := path.Base(db.option.DirPath)
+	return getMergePath(db.option.DirPath)
+}
+
+// 数据目录对应的 merge 目录，和数据目录在同一级
+func getMergePath(dirPath string) string {
+	dir := path.Dir(path.Clean(dirPath))
+	base := path.Base(dirPath)
 	return filepath.Join(dir, base+mergeDirName)
 }
+
+// loadMergeFiles 加载 merge 数据目录
+// 如果上一次 merge 已经完成，则将 merge 目录中的文件安装到数据目录中，并删除被 merge 过的旧数据文件
+// 所有的文件安装完成之前 merge 目录不会被删除，中途崩溃之后下次启动时会重新安装
+func (db *DB) loadMergeFiles() error {
+	mergePath := db.getMergePath()
+	// merge 目录不存在的话直接返回
+	if _, err := os.Stat(mergePath); os.IsNotExist(err) {
+		return nil
+	}
+
+	dirEntries, err := os.ReadDir(mergePath)
+	if err != nil {
+		return err
+	}
+
+	// 查找标识 merge 完成的文件，判断 merge 是否处理完了
+	var mergeFinished bool
+	var mergeFileNames []string
+	for _, entry := range dirEntries {
+		if entry.Name() == data.MergeFinishedFileName {
+			mergeFinished = true
+			continue
+		}
+		// 临时实例的文件锁不需要移动
+		if entry.Name() == fileLockName {
+			continue
+		}
+		mergeFileNames = append(mergeFileNames, entry.Name())
+	}
+
+	// merge 没有完成，直接忽略
+	if !mergeFinished {
+		return os.RemoveAll(mergePath)
+	}
+
+	nonMergeFileId, err := db.getNonMergeFileId(mergePath)
+	if err != nil {
+		// 标识文件没有完整写入，同样认为 merge 没有完成
+		if err == io.EOF || err == data.ErrInvalidCRC {
+			return os.RemoveAll(mergePath)
+		}
+		return err
+	}
+
+	// 先安装 merge 之后的数据文件和 Hint 文件，同名的旧数据文件会被原子地替换，最后安装 merge 完成的标识文件
+	mergedFileIds := make(map[uint32]struct{})
+	for _, fileName := range mergeFileNames {
+		if err := installMergeFile(mergePath, db.option.DirPath, fileName); err != nil {
+			return err
+		}
+		if strings.HasSuffix(fileName, data.DataFileNameSuffix) {
+			fileId, err := strconv.Atoi(strings.TrimSuffix(fileName, data.DataFileNameSuffix))
+			if err != nil {
+				return ErrDataDirectoryCorrupted
+			}
+			mergedFileIds[uint32(fileId)] = struct{}{}
+		}
+	}
+	if err := installMergeFile(mergePath, db.option.DirPath, data.MergeFinishedFileName); err != nil {
+		return err
+	}
+
+	// 再删除比 nonMergeFileId 更小，并且没有被替换的旧数据文件
+	var fileId uint32 = 0
+	for ; fileId < nonMergeFileId; fileId++ {
+		if _, ok := mergedFileIds[fileId]; ok {
+			continue
+		}
+		fileName := data.GetDataFileName(db.option.DirPath, fileId)
+		if _, err := os.Stat(fileName); err == nil {
+			if err := os.Remove(fileName); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 全部安装完成之后才删除 merge 目录
+	return os.RemoveAll(mergePath)
+}
+
+// installMergeFile 将 merge 目录中的文件安装到数据目录中
+// 先创建硬链接到临时文件，再重命名为目标文件，merge 目录中的文件保留到全部安装完成，安装可以重复执行
+func installMergeFile(mergePath, dirPath, fileName string) error {
+	tmpPath := filepath.Join(dirPath, fileName+mergeInstallSuffix)
+	if err := os.Remove(tmpPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(filepath.Join(mergePath, fileName), tmpPath); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filepath.Join(dirPath, fileName))
+}
+
+// getNonMergeFileId 从 merge 完成的标识文件中读取最近没有参与 merge 的文件 id
+func (db *DB) getNonMergeFileId(dirPath string) (uint32, error) {
+	mergeFinishedFile, err := data.OpenMergeFinishedFile(dirPath)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = mergeFinishedFile.Close()
+	}()
+
+	record, _, err := mergeFinishedFile.ReadLogRecord(0)
+	if err != nil {
+		return 0, err
+	}
+	nonMergeFileId, err := strconv.Atoi(string(record.Value))
+	if err != nil {
+		return 0, err
+	}
+	return uint32(nonMergeFileId), nil
+}
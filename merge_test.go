@@ -0,0 +1,389 @@
+package kv_go
+
+import (
+	"KV-go/data"
+	"KV-go/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 没有任何数据的情况下进行 merge
+func TestDB_Merge(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-1")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	err = db.Merge()
+	assert.Nil(t, err)
+}
+
+// 全部都是有效的数据
+func TestDB_Merge2(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-2")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 50000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(1024))
+		assert.Nil(t, err)
+	}
+
+	err = db.Merge()
+	assert.Nil(t, err)
+
+	// 重启校验
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	keys := db2.ListKeys()
+	assert.Equal(t, 50000, len(keys))
+
+	// merge 之后的索引从 hint 文件中加载
+	_, err = os.Stat(filepath.Join(dir, data.HintFileName))
+	assert.Nil(t, err)
+
+	for i := 0; i < 50000; i++ {
+		val, err := db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.NotNil(t, val)
+	}
+}
+
+// 有失效的数据，和被重复 Put 的数据
+func TestDB_Merge3(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-3")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 50000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(1024))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 10000; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	for i := 40000; i < 50000; i++ {
+		err := db.Put(utils.GetTestKey(i), []byte("new value in merge"))
+		assert.Nil(t, err)
+	}
+
+	err = db.Merge()
+	assert.Nil(t, err)
+	oldFileNum := len(db.olderFiles)
+
+	// 重启校验
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	keys := db2.ListKeys()
+	assert.Equal(t, 40000, len(keys))
+
+	for i := 0; i < 10000; i++ {
+		_, err := db2.Get(utils.GetTestKey(i))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	for i := 40000; i < 50000; i++ {
+		val, err := db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("new value in merge"), val)
+	}
+
+	// merge 之后数据文件的数量变少了
+	assert.Less(t, len(db2.olderFiles), oldFileNum)
+	_, err = os.Stat(db.getMergePath())
+	assert.True(t, os.IsNotExist(err))
+}
+
+// 全部是无效的数据
+func TestDB_Merge4(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-4")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 50000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(1024))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 50000; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+
+	err = db.Merge()
+	assert.Nil(t, err)
+
+	// 重启校验
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	keys := db2.ListKeys()
+	assert.Equal(t, 0, len(keys))
+}
+
+// 没有完成的 merge 会被忽略
+func TestDB_Merge5(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-5")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+
+	err = db.Merge()
+	assert.Nil(t, err)
+
+	// 删除 merge 完成的标识文件，模拟 merge 过程中崩溃
+	err = os.Remove(filepath.Join(db.getMergePath(), data.MergeFinishedFileName))
+	assert.Nil(t, err)
+
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, len(db2.ListKeys()))
+	_, err = os.Stat(db2.getMergePath())
+	assert.True(t, os.IsNotExist(err))
+}
+
+// merge 之后继续写入数据，重启后 hint 文件和数据文件中的索引都能正确加载
+func TestDB_Merge6(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-6")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	err = db.Merge()
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), []byte("value after merge"))
+		assert.Nil(t, err)
+	}
+	for i := 100; i < 200; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 900, len(db2.ListKeys()))
+	for i := 0; i < 100; i++ {
+		val, err := db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value after merge"), val)
+	}
+	for i := 100; i < 200; i++ {
+		_, err := db2.Get(utils.GetTestKey(i))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+}
+
+// B+ 树索引，merge 之后重启，索引更新为 merge 之后的位置
+func TestDB_Merge_BPTree(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-bptree")
+	opts.DirPath = dir
+	opts.IndexType = BPTree
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 100; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	err = db.Merge()
+	assert.Nil(t, err)
+
+	// merge 之后写入的数据不会被 hint 文件覆盖
+	for i := 100; i < 200; i++ {
+		err := db.Put(utils.GetTestKey(i), []byte("value after merge"))
+		assert.Nil(t, err)
+	}
+	for i := 200; i < 300; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 800, len(db2.ListKeys()))
+	for i := 100; i < 200; i++ {
+		val, err := db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value after merge"), val)
+	}
+	for i := 200; i < 300; i++ {
+		_, err := db2.Get(utils.GetTestKey(i))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	for i := 300; i < 1000; i++ {
+		val, err := db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.NotNil(t, val)
+	}
+
+	// hint 文件应用到 B+ 树索引之后被删除，再次启动时不需要重新加载
+	_, err = os.Stat(filepath.Join(dir, data.HintFileName))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, data.MergeFinishedFileName))
+	assert.True(t, os.IsNotExist(err))
+	assert.Nil(t, db2.Close())
+	db3, err := Open(opts)
+	defer destroyDB(db3)
+	assert.Nil(t, err)
+	assert.Equal(t, 800, len(db3.ListKeys()))
+	val, err := db3.Get(utils.GetTestKey(150))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value after merge"), val)
+}
+
+// 无效数据达到阈值之后，后台自动进行 merge
+func TestDB_AutoMerge(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-auto-merge")
+	opts.DirPath = dir
+	opts.MergeRatio = 0.5
+	opts.MergeCheckInterval = 50 * time.Millisecond
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 10000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	// 无效数据的占比还没有达到阈值
+	time.Sleep(200 * time.Millisecond)
+	_, err = os.Stat(db.getMergePath())
+	assert.True(t, os.IsNotExist(err))
+
+	for i := 0; i < 8000; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	_, err = os.Stat(filepath.Join(db.getMergePath(), data.MergeFinishedFileName))
+	assert.Nil(t, err)
+
+	// 重启之后 merge 的结果生效
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2000, len(db2.ListKeys()))
+	stat, err := db2.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), stat.ReclaimableSize)
+}
+
+func TestDB_Merge_InvalidRatio(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-ratio")
+	opts.DirPath = dir
+	opts.MergeRatio = 1.5
+	db, err := Open(opts)
+	assert.Nil(t, db)
+	assert.NotNil(t, err)
+}
+
+// 安装 merge 结果的过程中崩溃，下次启动时重新安装，数据不会丢失
+func TestDB_Merge_InstallInterrupted(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-install")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, db.Delete(utils.GetTestKey(i)))
+	}
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+
+	// 只安装了第一个数据文件，并且留下了临时文件
+	mergePath := getMergePath(dir)
+	assert.Nil(t, installMergeFile(mergePath, dir, filepath.Base(data.GetDataFileName(dir, 0))))
+	tmpName := filepath.Base(data.GetDataFileName(dir, 1)) + mergeInstallSuffix
+	assert.Nil(t, os.Link(data.GetDataFileName(mergePath, 1), filepath.Join(dir, tmpName)))
+
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, len(db2.ListKeys()))
+	for i := 1000; i < 2000; i++ {
+		_, err := db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	_, err = os.Stat(mergePath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, tmpName))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -1,19 +1,69 @@
 package kv_go
 
-import "os"
+import (
+	"KV-go/data"
+	"os"
+	"time"
+)
 
 type Options struct {
-	DirPath      string      // 数据目录
-	DataFileSize int64       // 数据文件的大小
-	SyncWrites   bool        // 每次写数据是否持久化
-	IndexType    IndexerType // 索引类型
+	DirPath       string      // 数据目录
+	DataFileSize  int64       // 数据文件的大小
+	SyncWrites    bool        // 每次写数据是否持久化
+	IndexType     IndexerType // 索引类型
+	MMapAtStartup bool        // 启动时是否使用 MMap 加载数据文件，旧的数据文件会继续使用 MMap 读取
+
+	// 无效数据占总数据量的比例达到该阈值时，后台自动进行 merge，为 0 表示不自动 merge
+	MergeRatio float32
+
+	// 后台检查是否需要自动 merge 的时间间隔
+	MergeCheckInterval time.Duration
+
+	// 后台从索引中清理过期 key 的时间间隔，为 0 表示不清理，过期的 key 对外不可见，但会一直留在索引中
+	ExpireCheckInterval time.Duration
+
+	// 压缩 value 使用的算法，为 nil 表示不压缩
+	// 已经压缩写入的数据需要使用相同的算法才能读取
+	Compressor Compressor
+
+	// value 的大小达到该阈值时才进行压缩，字节为单位
+	CompressThreshold int
+
+	// 数据加密使用的 AES 密钥，长度需要是 16、24 或 32 字节，为空表示不加密
+	// 数据文件和 hint 文件中的 key 和 value 都会使用 AES-GCM 进行加密
+	// B+ 树索引文件中会保存明文的 key，因此不能和 BPTree 索引一起使用
+	EncryptionKey []byte
+
+	// 启动时数据文件中有损坏的记录（例如写入过程中崩溃）时的处理策略，默认打开失败，由调用方决定是否丢弃数据
+	RecoveryPolicy RecoveryPolicy
+
+	// 没有开启 SyncWrites 时，累计写入的数据量达到该阈值后，后台持久化活跃文件，字节为单位，为 0 表示不按照数据量持久化
+	BytesPerSync int64
+
+	// 没有开启 SyncWrites 时，后台定期持久化活跃文件的时间间隔，为 0 表示不定期持久化
+	SyncInterval time.Duration
+
+	// 读缓存的容量，字节为单位，缓存最近读取过的 value，为 0 表示不使用缓存
+	ValueCacheSize int64
+
+	// 以只读的方式打开数据库，拒绝所有的写入和 merge，数据只能通过复制写入，用于 replication 的 follower
+	ReadOnly bool
 }
 
+// Compressor value 的压缩算法，可以使用 data.NewFlateCompressor、data.NewGzipCompressor，或者自定义实现
+type Compressor = data.Compressor
+
 type IteratorOptions struct {
 	// 遍历前缀为指定的 key，默认为空
 	Prefix []byte
 	// 是否反向遍历，默认为 false
 	Reverse bool
+	// 遍历的下界，只遍历大于等于该值的 key，为空表示没有下界
+	LowerBound []byte
+	// 遍历的上界，只遍历小于该值的 key，为空表示没有上界
+	UpperBound []byte
+	// 最多遍历的 key 的数量，为 0 表示不限制
+	Limit int
 }
 
 // WriteBatchOptions 批量写入的配置项
@@ -27,15 +77,45 @@ type WriteBatchOptions struct {
 type IndexerType = int8
 
 const (
+	// Btree 索引
 	Btree IndexerType = iota + 1
+
+	// ART 自适应基数树索引
 	ART
+
+	// BPTree B+ 树索引，将索引存储在磁盘上
+	BPTree
+)
+
+type RecoveryPolicy = int8
+
+const (
+	// RecoveryFail 数据文件中有损坏的记录时打开失败
+	RecoveryFail RecoveryPolicy = iota
+
+	// RecoveryTruncateTail 将活跃文件截断到最后一条有效记录的末尾，旧的数据文件有损坏时仍然打开失败
+	RecoveryTruncateTail
+
+	// RecoverySkipCorrupt 跳过校验失败的记录，并截断所有数据文件末尾不完整的记录
+	RecoverySkipCorrupt
 )
 
 var DefaultOptions = Options{
-	DirPath:      os.TempDir(),
-	DataFileSize: 256 * 1024 * 1024,
-	SyncWrites:   false,
-	IndexType:    Btree,
+	DirPath:             os.TempDir(),
+	DataFileSize:        256 * 1024 * 1024,
+	SyncWrites:          false,
+	IndexType:           Btree,
+	MMapAtStartup:       false,
+	MergeRatio:          0,
+	MergeCheckInterval:  time.Minute,
+	ExpireCheckInterval: time.Minute,
+	Compressor:          nil,
+	CompressThreshold:   256,
+	RecoveryPolicy:      RecoveryFail,
+	BytesPerSync:        0,
+	SyncInterval:        0,
+	ValueCacheSize:      0,
+	ReadOnly:            false,
 }
 
 var DefaultIteratorOptions = IteratorOptions{
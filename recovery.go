@@ -0,0 +1,78 @@
+package kv_go
+
+import (
+	"KV-go/data"
+	"io"
+	"sync/atomic"
+)
+
+// RecoveryReport 启动时对数据文件中损坏数据的处理结果
+type RecoveryReport struct {
+	SkippedRecords uint  // 跳过的损坏记录的数量
+	TruncatedFiles uint  // 末尾被截断的数据文件数量
+	DroppedBytes   int64 // 丢弃的数据量，字节为单位
+}
+
+// RecoveryReport 返回启动时对损坏数据的处理结果
+func (db *DB) RecoveryReport() RecoveryReport {
+	return db.recovery
+}
+
+// 从 offset 开始遍历数据文件中的记录，遇到损坏的记录时根据配置的恢复策略进行处理
+// 返回文件中最后一条有效记录的末尾位置
+func (db *DB) iterateDataFile(dataFile *data.DataFile, offset int64, isActive bool,
+	fn func(logRecord *data.LogRecord, offset int64, size int64) error) (int64, error) {
+	fileSize, err := dataFile.IoManager.Size()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		logRecord, size, err := dataFile.ReadLogRecord(offset)
+		if err == nil {
+			if err := fn(logRecord, offset, size); err != nil {
+				return 0, err
+			}
+			offset += size
+			continue
+		}
+
+		// 文件末尾剩余的数据无法组成一条记录（例如文件系统填充的 0），同样认为是不完整的记录
+		if err == io.EOF {
+			if offset >= fileSize {
+				return offset, nil
+			}
+			err = data.ErrIncompleteLogRecord
+		}
+		if err != data.ErrInvalidCRC && err != data.ErrIncompleteLogRecord {
+			return 0, err
+		}
+
+		switch db.option.RecoveryPolicy {
+		case RecoverySkipCorrupt:
+			// 跳过校验失败的记录，继续读取后面的数据
+			if err == data.ErrInvalidCRC && size > 0 && offset+size <= fileSize {
+				db.recovery.SkippedRecords++
+				db.recovery.DroppedBytes += size
+				atomic.AddInt64(&db.reclaimSize, size)
+				offset += size
+				continue
+			}
+		case RecoveryTruncateTail:
+			// 只有活跃文件的末尾才可能出现写入了一部分的记录
+			if !isActive {
+				return 0, err
+			}
+		default:
+			return 0, err
+		}
+
+		// 截断到最后一条有效记录的末尾
+		if err := dataFile.Truncate(db.option.DirPath, offset); err != nil {
+			return 0, err
+		}
+		db.recovery.TruncatedFiles++
+		db.recovery.DroppedBytes += fileSize - offset
+		return offset, nil
+	}
+}
@@ -0,0 +1,170 @@
+package kv_go
+
+import (
+	"KV-go/data"
+	"KV-go/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+// 模拟写入过程中崩溃，活跃文件的末尾只写入了一部分数据
+func TestDB_Recovery_TruncateTail(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-recovery-truncate")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	validSize := db.activeFile.WriteOff
+	err = db.Close()
+	assert.Nil(t, err)
+
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{
+		Key:   logRecordKeyWithSeq(utils.GetTestKey(100), nonTransactionSeqNo),
+		Value: utils.RandomValue(24),
+	})
+	appendToFile(t, data.GetDataFileName(dir, 0), encRecord[:len(encRecord)/2])
+
+	// 默认策略下打开失败
+	opts.RecoveryPolicy = RecoveryFail
+	db2, err := Open(opts)
+	assert.Nil(t, db2)
+	assert.Equal(t, data.ErrIncompleteLogRecord, err)
+
+	opts.RecoveryPolicy = RecoveryTruncateTail
+	db3, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(db3.ListKeys()))
+	assert.Equal(t, validSize, db3.activeFile.WriteOff)
+	report := db3.RecoveryReport()
+	assert.Equal(t, uint(1), report.TruncatedFiles)
+	assert.Equal(t, int64(len(encRecord)/2), report.DroppedBytes)
+
+	// 截断之后继续写入的数据能够正常读取
+	err = db3.Put(utils.GetTestKey(100), []byte("value after recovery"))
+	assert.Nil(t, err)
+	err = db3.Close()
+	assert.Nil(t, err)
+
+	db4, err := Open(opts)
+	defer destroyDB(db4)
+	assert.Nil(t, err)
+	assert.Equal(t, 101, len(db4.ListKeys()))
+	assert.Equal(t, RecoveryReport{}, db4.RecoveryReport())
+	val, err := db4.Get(utils.GetTestKey(100))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value after recovery"), val)
+}
+
+// 活跃文件末尾的记录校验失败，或者被填充了 0
+func TestDB_Recovery_TruncateTail_Corrupted(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-recovery-corrupted")
+	opts.DirPath = dir
+	opts.RecoveryPolicy = RecoveryTruncateTail
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	lastPos := db.index.Get(utils.GetTestKey(99))
+	err = db.Close()
+	assert.Nil(t, err)
+
+	corruptFile(t, data.GetDataFileName(dir, 0), lastPos.Offset+int64(lastPos.Size)-1)
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 99, len(db2.ListKeys()))
+	assert.Equal(t, lastPos.Offset, db2.activeFile.WriteOff)
+	assert.Equal(t, int64(lastPos.Size), db2.RecoveryReport().DroppedBytes)
+	err = db2.Close()
+	assert.Nil(t, err)
+
+	appendToFile(t, data.GetDataFileName(dir, 0), make([]byte, 64))
+	db3, err := Open(opts)
+	defer destroyDB(db3)
+	assert.Nil(t, err)
+	assert.Equal(t, 99, len(db3.ListKeys()))
+	assert.Equal(t, lastPos.Offset, db3.activeFile.WriteOff)
+	assert.Equal(t, int64(64), db3.RecoveryReport().DroppedBytes)
+}
+
+// 旧的数据文件中间有损坏的记录
+func TestDB_Recovery_SkipCorrupt(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-recovery-skip")
+	opts.DirPath = dir
+	opts.DataFileSize = 4 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 500; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	pos := db.index.Get(utils.GetTestKey(10))
+	assert.NotEqual(t, db.activeFile.FileId, pos.Fid)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	corruptFile(t, data.GetDataFileName(dir, pos.Fid), pos.Offset+int64(pos.Size)-1)
+
+	// 旧的数据文件损坏，截断活跃文件的策略无法处理
+	opts.RecoveryPolicy = RecoveryTruncateTail
+	db2, err := Open(opts)
+	assert.Nil(t, db2)
+	assert.Equal(t, data.ErrInvalidCRC, err)
+
+	opts.RecoveryPolicy = RecoverySkipCorrupt
+	db3, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 499, len(db3.ListKeys()))
+	_, err = db3.Get(utils.GetTestKey(10))
+	assert.Equal(t, ErrKeyNotFound, err)
+	report := db3.RecoveryReport()
+	assert.Equal(t, uint(1), report.SkippedRecords)
+	assert.Equal(t, int64(pos.Size), report.DroppedBytes)
+
+	// merge 时跳过损坏的记录
+	err = db3.Merge()
+	assert.Nil(t, err)
+	err = db3.Close()
+	assert.Nil(t, err)
+
+	opts.RecoveryPolicy = RecoveryFail
+	db4, err := Open(opts)
+	defer destroyDB(db4)
+	assert.Nil(t, err)
+	assert.Equal(t, 499, len(db4.ListKeys()))
+}
+
+func appendToFile(t *testing.T, fileName string, buf []byte) {
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, err = f.Write(buf)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+}
+
+// 翻转文件中指定位置的一个字节
+func corruptFile(t *testing.T, fileName string, offset int64) {
+	f, err := os.OpenFile(fileName, os.O_RDWR, 0644)
+	assert.Nil(t, err)
+	b := make([]byte, 1)
+	_, err = f.ReadAt(b, offset)
+	assert.Nil(t, err)
+	b[0] ^= 0xFF
+	_, err = f.WriteAt(b, offset)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+}
@@ -0,0 +1,327 @@
+package redis
+
+import (
+	kv "KV-go"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reply 命令的回复，按照 RESP2 的格式写入到客户端
+type reply interface {
+	writeTo(w *respWriter)
+}
+
+type statusReply string
+
+func (r statusReply) writeTo(w *respWriter) { w.WriteString(string(r)) }
+
+type errorReply string
+
+func (r errorReply) writeTo(w *respWriter) { w.WriteError(string(r)) }
+
+type intReply int64
+
+func (r intReply) writeTo(w *respWriter) { w.WriteInt(int64(r)) }
+
+type bulkReply []byte
+
+func (r bulkReply) writeTo(w *respWriter) { w.WriteBulk(r) }
+
+type nullReply struct{}
+
+func (r nullReply) writeTo(w *respWriter) { w.WriteNull() }
+
+type arrayReply []reply
+
+func (r arrayReply) writeTo(w *respWriter) {
+	w.WriteArrayHeader(len(r))
+	for _, item := range r {
+		item.writeTo(w)
+	}
+}
+
+var (
+	okReply          = statusReply("OK")
+	syntaxErrorReply = errorReply("ERR syntax error")
+)
+
+// command Redis 命令的定义
+type command struct {
+	minArgs int                                  // 最少的参数数量，不包括命令名称
+	maxArgs int                                  // 最多的参数数量，为 -1 表示不限制
+	handler func(s *Server, args [][]byte) reply // 直接执行命令
+	queued  func(tx *txn, args [][]byte) reply   // 在 MULTI 事务中执行命令，为 nil 表示不支持在事务中使用
+}
+
+func (c command) checkArity(n int) bool {
+	return n >= c.minArgs && (c.maxArgs < 0 || n <= c.maxArgs)
+}
+
+var commands = map[string]command{
+	"ping":   {0, 1, ping, nil},
+	"echo":   {1, 1, echo, nil},
+	"get":    {1, 1, get, nil},
+	"set":    {2, -1, set, txnSet},
+	"del":    {1, -1, del, txnDel},
+	"exists": {1, -1, exists, nil},
+	"keys":   {1, 1, keys, nil},
+	"scan":   {1, -1, scan, nil},
+	"ttl":    {1, 1, ttl, nil},
+	"pttl":   {1, 1, pttl, nil},
+}
+
+func errReply(err error) reply {
+	return errorReply("ERR " + err.Error())
+}
+
+func ping(_ *Server, args [][]byte) reply {
+	if len(args) == 1 {
+		return bulkReply(args[0])
+	}
+	return statusReply("PONG")
+}
+
+func echo(_ *Server, args [][]byte) reply {
+	return bulkReply(args[0])
+}
+
+func get(s *Server, args [][]byte) reply {
+	value, err := s.db.Get(args[0])
+	if err == kv.ErrKeyNotFound {
+		return nullReply{}
+	}
+	if err != nil {
+		return errReply(err)
+	}
+	return bulkReply(value)
+}
+
+// 解析 SET key value [EX seconds | PX milliseconds]，返回过期时间，为 0 表示不过期
+func parseSet(args [][]byte) (time.Duration, reply) {
+	var ttl time.Duration
+	for i := 2; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		if (option != "ex" && option != "px") || ttl > 0 || i+1 >= len(args) {
+			return 0, syntaxErrorReply
+		}
+		n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil {
+			return 0, errorReply("ERR value is not an integer or out of range")
+		}
+		if n <= 0 {
+			return 0, errorReply("ERR invalid expire time in 'set' command")
+		}
+		if option == "ex" {
+			ttl = time.Duration(n) * time.Second
+		} else {
+			ttl = time.Duration(n) * time.Millisecond
+		}
+		i++
+	}
+	return ttl, nil
+}
+
+func set(s *Server, args [][]byte) reply {
+	ttl, errRep := parseSet(args)
+	if errRep != nil {
+		return errRep
+	}
+	var err error
+	if ttl > 0 {
+		err = s.db.PutWithTTL(args[0], args[1], ttl)
+	} else {
+		err = s.db.Put(args[0], args[1])
+	}
+	if err != nil {
+		return errReply(err)
+	}
+	return okReply
+}
+
+func keyExists(db *kv.DB, key []byte) (bool, error) {
+	_, err := db.Get(key)
+	if err == kv.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func del(s *Server, args [][]byte) reply {
+	var n int64
+	for _, key := range args {
+		ok, err := keyExists(s.db, key)
+		if err != nil {
+			return errReply(err)
+		}
+		if !ok {
+			continue
+		}
+		if err := s.db.Delete(key); err != nil {
+			return errReply(err)
+		}
+		n++
+	}
+	return intReply(n)
+}
+
+func exists(s *Server, args [][]byte) reply {
+	var n int64
+	for _, key := range args {
+		ok, err := keyExists(s.db, key)
+		if err != nil {
+			return errReply(err)
+		}
+		if ok {
+			n++
+		}
+	}
+	return intReply(n)
+}
+
+func keys(s *Server, args [][]byte) reply {
+	pattern := args[0]
+	iterator := s.db.NewIterator(kv.IteratorOptions{Prefix: literalPrefix(pattern)})
+	defer iterator.Close()
+
+	result := arrayReply{}
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		key := iterator.Key()
+		if matchPattern(pattern, key) {
+			result = append(result, bulkReply(key))
+		}
+	}
+	return result
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count]
+// cursor 为十进制的游标 id，服务端保存了它对应的下一个需要遍历的 key，为 0 表示从头开始或者遍历结束
+// 两次调用之间写入或者删除的 key 不会影响已经遍历过的位置，游标过期或者被淘汰之后返回错误
+func scan(s *Server, args [][]byte) reply {
+	id, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		return errorReply("ERR invalid cursor")
+	}
+	var cursor []byte
+	if id != 0 {
+		var ok bool
+		if cursor, ok = s.cursors.get(id); !ok {
+			return errorReply("ERR invalid cursor")
+		}
+	}
+	var pattern []byte
+	count := 10
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return syntaxErrorReply
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			pattern = args[i+1]
+		case "count":
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil || count <= 0 {
+				return syntaxErrorReply
+			}
+		default:
+			return syntaxErrorReply
+		}
+	}
+
+	iterator := s.db.NewIterator(kv.IteratorOptions{Prefix: literalPrefix(pattern)})
+	defer iterator.Close()
+
+	if cursor == nil {
+		iterator.Rewind()
+	} else {
+		iterator.Seek(cursor)
+	}
+	matched := arrayReply{}
+	for scanned := 0; iterator.Valid() && scanned < count; iterator.Next() {
+		key := iterator.Key()
+		if pattern == nil || matchPattern(pattern, key) {
+			matched = append(matched, bulkReply(key))
+		}
+		scanned++
+	}
+	var next uint64
+	if iterator.Valid() {
+		next = s.cursors.add(iterator.Key())
+	}
+	return arrayReply{bulkReply(strconv.FormatUint(next, 10)), matched}
+}
+
+// 返回 key 剩余的存活时间，key 不存在时返回 -2，没有设置过期时间时返回 -1
+func keyTTL(db *kv.DB, key []byte, unit time.Duration) reply {
+	remaining, err := db.TTL(key)
+	if err == kv.ErrKeyNotFound {
+		return intReply(-2)
+	}
+	if err != nil {
+		return errReply(err)
+	}
+	if remaining == kv.NoExpiration {
+		return intReply(-1)
+	}
+	// 和 Redis 一样向上取整
+	return intReply((remaining + unit - 1) / unit)
+}
+
+func ttl(s *Server, args [][]byte) reply {
+	return keyTTL(s.db, args[0], time.Second)
+}
+
+func pttl(s *Server, args [][]byte) reply {
+	return keyTTL(s.db, args[0], time.Millisecond)
+}
+
+// txn MULTI 事务的执行状态，写命令暂存在 WriteBatch 中，EXEC 时一起提交
+type txn struct {
+	db     *kv.DB
+	batch  *kv.WriteBatch
+	exists map[string]bool // 事务中已经写入或删除的 key 是否存在
+}
+
+func (tx *txn) keyExists(key []byte) (bool, error) {
+	if ok, found := tx.exists[string(key)]; found {
+		return ok, nil
+	}
+	return keyExists(tx.db, key)
+}
+
+func txnSet(tx *txn, args [][]byte) reply {
+	ttl, errRep := parseSet(args)
+	if errRep != nil {
+		return errRep
+	}
+	var err error
+	if ttl > 0 {
+		err = tx.batch.PutWithTTL(args[0], args[1], ttl)
+	} else {
+		err = tx.batch.Put(args[0], args[1])
+	}
+	if err != nil {
+		return errReply(err)
+	}
+	tx.exists[string(args[0])] = true
+	return okReply
+}
+
+func txnDel(tx *txn, args [][]byte) reply {
+	var n int64
+	for _, key := range args {
+		ok, err := tx.keyExists(key)
+		if err != nil {
+			return errReply(err)
+		}
+		if !ok {
+			continue
+		}
+		if err := tx.batch.Delete(key); err != nil {
+			return errReply(err)
+		}
+		tx.exists[string(key)] = false
+		n++
+	}
+	return intReply(n)
+}
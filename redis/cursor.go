@@ -0,0 +1,85 @@
+package redis
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// 服务端最多保存的 SCAN 游标数量，超过时淘汰最早创建的游标
+	maxScanCursors = 4096
+
+	// SCAN 游标的有效时间，超过之后客户端需要从头开始遍历
+	scanCursorTTL = 10 * time.Minute
+)
+
+// cursorTable 保存 SCAN 游标 id 到下一次开始遍历的 key 的映射
+// Redis 客户端要求游标是十进制的无符号整数，key 无法编码在游标中，所以在服务端保存
+// 游标按照创建的顺序排列，过期或者数量超过上限时从最早创建的游标开始淘汰
+type cursorTable struct {
+	mu      sync.Mutex
+	lastID  uint64
+	cursors map[uint64]*list.Element
+	order   *list.List
+}
+
+type scanCursor struct {
+	id      uint64
+	key     []byte
+	created time.Time
+}
+
+func newCursorTable() *cursorTable {
+	return &cursorTable{
+		cursors: make(map[uint64]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// add 保存下一次开始遍历的 key，返回分配的游标 id，id 不会为 0
+func (t *cursorTable) add(key []byte) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.removeExpired(now)
+	if t.order.Len() >= maxScanCursors {
+		t.remove(t.order.Front())
+	}
+	t.lastID++
+	if t.lastID == 0 {
+		t.lastID++
+	}
+	cursor := &scanCursor{id: t.lastID, key: key, created: now}
+	t.cursors[cursor.id] = t.order.PushBack(cursor)
+	return cursor.id
+}
+
+// get 获取游标对应的 key，游标不存在或者已经过期时返回 false
+// 同一个游标可以被多次使用，客户端重试时仍然可以从相同的位置继续遍历
+func (t *cursorTable) get(id uint64) ([]byte, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.removeExpired(time.Now())
+	elem, ok := t.cursors[id]
+	if !ok {
+		return nil, false
+	}
+	return elem.Value.(*scanCursor).key, true
+}
+
+func (t *cursorTable) removeExpired(now time.Time) {
+	for elem := t.order.Front(); elem != nil; elem = t.order.Front() {
+		if now.Sub(elem.Value.(*scanCursor).created) < scanCursorTTL {
+			return
+		}
+		t.remove(elem)
+	}
+}
+
+func (t *cursorTable) remove(elem *list.Element) {
+	delete(t.cursors, elem.Value.(*scanCursor).id)
+	t.order.Remove(elem)
+}
@@ -0,0 +1,101 @@
+package redis
+
+// matchPattern 按照 Redis 的 glob 规则匹配 key
+// 支持 * ? [abc] [^abc] [a-z] 以及使用 \ 转义
+// 遇到不匹配时回退到上一个 * 多吞掉一个字符重新匹配，不做递归，耗时不会随着 * 的数量指数增长
+func matchPattern(pattern []byte, key []byte) bool {
+	var p, k int
+	// 上一个 * 在 pattern 中的位置，以及它之后开始匹配的 key 的位置
+	starP, starK := -1, 0
+	for k < len(key) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starP, starK = p, k
+				p++
+				continue
+			case '?':
+				p, k = p+1, k+1
+				continue
+			case '[':
+				if matched, rest := matchClass(pattern[p+1:], key[k]); matched {
+					p, k = len(pattern)-len(rest), k+1
+					continue
+				}
+			default:
+				c, n := pattern[p], 1
+				if c == '\\' && p+1 < len(pattern) {
+					c, n = pattern[p+1], 2
+				}
+				if c == key[k] {
+					p, k = p+n, k+1
+					continue
+				}
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		starK++
+		p, k = starP+1, starK
+	}
+	// key 已经匹配完，剩下的 pattern 只能是 *
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// 匹配 [] 中的字符集合，返回是否匹配以及 ] 之后剩余的 pattern
+func matchClass(pattern []byte, c byte) (bool, []byte) {
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+	var matched bool
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			if pattern[1] == c {
+				matched = true
+			}
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := pattern[0], pattern[2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				matched = true
+			}
+			pattern = pattern[3:]
+		default:
+			if pattern[0] == c {
+				matched = true
+			}
+			pattern = pattern[1:]
+		}
+	}
+	// 跳过 ]，没有闭合的 [ 一直匹配到 pattern 的末尾
+	if len(pattern) > 0 {
+		pattern = pattern[1:]
+	}
+	return matched != negate, pattern
+}
+
+// literalPrefix 返回 pattern 中第一个通配符之前的固定前缀，用于缩小遍历的范围
+func literalPrefix(pattern []byte) []byte {
+	var prefix []byte
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?', '[':
+			return prefix
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+		}
+		prefix = append(prefix, pattern[i])
+	}
+	return prefix
+}
@@ -0,0 +1,154 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxBulkLen  = 512 * 1024 * 1024 // 单个参数的最大长度
+	maxArrayLen = 1024 * 1024       // 一条命令中参数的最大数量
+)
+
+var (
+	errProtocol = errors.New("ERR Protocol error")
+)
+
+// respReader 读取客户端发送的 RESP 格式的命令
+// 支持 RESP 数组格式的命令，以及 telnet 等工具发送的 inline 命令
+type respReader struct {
+	rd *bufio.Reader
+}
+
+func newRESPReader(rd io.Reader) *respReader {
+	return &respReader{rd: bufio.NewReader(rd)}
+}
+
+// ReadCommand 读取一条命令，返回命令的参数，第一个参数为命令的名称
+func (r *respReader) ReadCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return r.parseInline(line), nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArrayLen {
+		return nil, errProtocol
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	args := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		if args[i], err = r.readBulk(); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+func (r *respReader) readBulk() ([]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return nil, errProtocol
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 || n > maxBulkLen {
+		return nil, errProtocol
+	}
+	buf := make([]byte, n+2)
+	if _, err := io.ReadFull(r.rd, buf); err != nil {
+		return nil, err
+	}
+	if buf[n] != '\r' || buf[n+1] != '\n' {
+		return nil, errProtocol
+	}
+	return buf[:n], nil
+}
+
+// 读取一行数据，去掉末尾的 \r\n
+func (r *respReader) readLine() ([]byte, error) {
+	line, err := r.rd.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, errProtocol
+	}
+	if err != nil {
+		return nil, err
+	}
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	// ReadSlice 返回的数据在下一次读取时会被覆盖
+	return append([]byte(nil), line...), nil
+}
+
+func (r *respReader) parseInline(line []byte) [][]byte {
+	var args [][]byte
+	for _, field := range strings.Fields(string(line)) {
+		args = append(args, []byte(field))
+	}
+	return args
+}
+
+// respWriter 向客户端写入 RESP2 格式的回复
+type respWriter struct {
+	wr *bufio.Writer
+}
+
+func newRESPWriter(wr io.Writer) *respWriter {
+	return &respWriter{wr: bufio.NewWriter(wr)}
+}
+
+func (w *respWriter) WriteString(s string) {
+	w.wr.WriteByte('+')
+	w.wr.WriteString(s)
+	w.wr.WriteString("\r\n")
+}
+
+func (w *respWriter) WriteError(s string) {
+	w.wr.WriteByte('-')
+	w.wr.WriteString(s)
+	w.wr.WriteString("\r\n")
+}
+
+func (w *respWriter) WriteInt(n int64) {
+	w.wr.WriteByte(':')
+	w.wr.WriteString(strconv.FormatInt(n, 10))
+	w.wr.WriteString("\r\n")
+}
+
+func (w *respWriter) WriteBulk(b []byte) {
+	w.wr.WriteByte('$')
+	w.wr.WriteString(strconv.Itoa(len(b)))
+	w.wr.WriteString("\r\n")
+	w.wr.Write(b)
+	w.wr.WriteString("\r\n")
+}
+
+func (w *respWriter) WriteNull() {
+	w.wr.WriteString("$-1\r\n")
+}
+
+// WriteArrayHeader 写入数组的长度，之后需要依次写入数组中的每个元素
+func (w *respWriter) WriteArrayHeader(n int) {
+	w.wr.WriteByte('*')
+	w.wr.WriteString(strconv.Itoa(n))
+	w.wr.WriteString("\r\n")
+}
+
+func (w *respWriter) Flush() error {
+	return w.wr.Flush()
+}
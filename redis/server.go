@@ -0,0 +1,221 @@
+package redis
+
+import (
+	kv "KV-go"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+)
+
+// ErrServerClosed 服务已经关闭
+var ErrServerClosed = errors.New("redis: server closed")
+
+// Server 兼容 Redis 协议（RESP2）的服务端，将 Redis 命令映射到 DB 的操作上
+// 任何 Redis 客户端都可以通过 TCP 访问存储引擎
+type Server struct {
+	db       *kv.DB
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	closed   bool
+	cursors  *cursorTable // SCAN 命令的游标
+}
+
+// NewServer 创建一个 Redis 协议的服务端
+func NewServer(db *kv.DB) *Server {
+	return &Server{
+		db:      db,
+		conns:   make(map[net.Conn]struct{}),
+		cursors: newCursorTable(),
+	}
+}
+
+// ListenAndServe 监听 TCP 地址并处理客户端的连接，直到服务被关闭
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve 在给定的 listener 上处理客户端的连接，服务关闭之后返回 ErrServerClosed
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = listener.Close()
+		return ErrServerClosed
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.handleConn(conn)
+	}
+}
+
+// Close 停止监听并关闭所有的客户端连接，等待正在处理的命令结束
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// client 一个客户端连接的状态
+type client struct {
+	multi    bool       // 是否处于 MULTI 事务中
+	dirty    bool       // 事务中是否有命令入队失败，EXEC 时需要放弃整个事务
+	queue    [][][]byte // 事务中暂存的命令
+	shutdown bool       // 客户端发送了 QUIT
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+		s.wg.Done()
+	}()
+
+	reader := newRESPReader(conn)
+	writer := newRESPWriter(conn)
+	c := &client{}
+	for {
+		args, err := reader.ReadCommand()
+		if err != nil {
+			if err == errProtocol {
+				writer.WriteError(err.Error())
+				_ = writer.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		s.execute(c, args).writeTo(writer)
+
+		// 客户端一次发送了多条命令时，处理完所有的命令之后再统一发送回复
+		if reader.rd.Buffered() == 0 || c.shutdown {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+		}
+		if c.shutdown {
+			return
+		}
+	}
+}
+
+// execute 执行一条命令，处理 MULTI/EXEC 事务的状态
+func (s *Server) execute(c *client, args [][]byte) reply {
+	name := strings.ToLower(string(args[0]))
+	switch name {
+	case "multi":
+		if c.multi {
+			return errorReply("ERR MULTI calls can not be nested")
+		}
+		c.multi = true
+		return okReply
+	case "exec":
+		if !c.multi {
+			return errorReply("ERR EXEC without MULTI")
+		}
+		queue, dirty := c.queue, c.dirty
+		c.multi, c.dirty, c.queue = false, false, nil
+		if dirty {
+			return errorReply("EXECABORT Transaction discarded because of previous errors.")
+		}
+		return s.exec(queue)
+	case "discard":
+		if !c.multi {
+			return errorReply("ERR DISCARD without MULTI")
+		}
+		c.multi, c.dirty, c.queue = false, false, nil
+		return okReply
+	case "quit":
+		c.shutdown = true
+		return okReply
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		if c.multi {
+			c.dirty = true
+		}
+		return errorReply("ERR unknown command '" + string(args[0]) + "'")
+	}
+	if !cmd.checkArity(len(args) - 1) {
+		if c.multi {
+			c.dirty = true
+		}
+		return errorReply("ERR wrong number of arguments for '" + name + "' command")
+	}
+
+	if c.multi {
+		if cmd.queued == nil {
+			c.dirty = true
+			return errorReply("ERR command '" + name + "' is not supported in a transaction")
+		}
+		c.queue = append(c.queue, args)
+		return statusReply("QUEUED")
+	}
+	return cmd.handler(s, args[1:])
+}
+
+// exec 通过 WriteBatch 原子地执行事务中的所有写命令
+func (s *Server) exec(queue [][][]byte) reply {
+	tx := &txn{
+		db:     s.db,
+		batch:  s.db.NewWriteBatch(kv.DefaultWriteBatchOptions),
+		exists: make(map[string]bool),
+	}
+	replies := make(arrayReply, len(queue))
+	for i, args := range queue {
+		name := strings.ToLower(string(args[0]))
+		replies[i] = commands[name].queued(tx, args[1:])
+	}
+	if err := tx.batch.Commit(); err != nil {
+		return errorReply("ERR " + err.Error())
+	}
+	return replies
+}
@@ -0,0 +1,323 @@
+package redis
+
+import (
+	kv "KV-go"
+	"bufio"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClient 手写的 RESP 客户端
+type testClient struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func (c *testClient) do(t *testing.T, args ...string) interface{} {
+	c.send(t, args...)
+	return c.read(t)
+}
+
+func (c *testClient) send(t *testing.T, args ...string) {
+	cmd := "*" + strconv.Itoa(len(args)) + "\r\n"
+	for _, arg := range args {
+		cmd += "$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n"
+	}
+	_, err := c.conn.Write([]byte(cmd))
+	assert.Nil(t, err)
+}
+
+// 读取一条回复，状态回复返回 string，错误回复返回 error，整数返回 int64，空值返回 nil
+func (c *testClient) read(t *testing.T) interface{} {
+	line, err := c.rd.ReadString('\n')
+	assert.Nil(t, err)
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return fmt.Errorf("%s", line[1:])
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		assert.Nil(t, err)
+		return n
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		assert.Nil(t, err)
+		if n < 0 {
+			return nil
+		}
+		buf := make([]byte, n+2)
+		_, err = io.ReadFull(c.rd, buf)
+		assert.Nil(t, err)
+		return buf[:n]
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		assert.Nil(t, err)
+		items := make([]interface{}, n)
+		for i := range items {
+			items[i] = c.read(t)
+		}
+		return items
+	}
+	t.Fatalf("unexpected reply %q", line)
+	return nil
+}
+
+func startServer(t *testing.T) (*Server, *kv.DB, string) {
+	opts := kv.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis")
+	opts.DirPath = dir
+	db, err := kv.Open(opts)
+	assert.Nil(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := NewServer(db)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return server, db, listener.Addr().String()
+}
+
+func newTestClient(t *testing.T, addr string) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	return &testClient{conn: conn, rd: bufio.NewReader(conn)}
+}
+
+func TestServer_Commands(t *testing.T) {
+	server, db, addr := startServer(t)
+	defer db.Close()
+	defer server.Close()
+	c := newTestClient(t, addr)
+	defer c.conn.Close()
+
+	assert.Equal(t, "PONG", c.do(t, "PING"))
+	assert.Equal(t, []byte("hello"), c.do(t, "ECHO", "hello"))
+
+	assert.Nil(t, c.do(t, "GET", "name"))
+	assert.Equal(t, "OK", c.do(t, "SET", "name", "bitcask"))
+	assert.Equal(t, []byte("bitcask"), c.do(t, "GET", "name"))
+	assert.Equal(t, "OK", c.do(t, "SET", "empty", ""))
+	assert.Equal(t, []byte{}, c.do(t, "GET", "empty"))
+
+	assert.Equal(t, int64(2), c.do(t, "EXISTS", "name", "empty", "missing"))
+	assert.Equal(t, int64(1), c.do(t, "DEL", "empty", "missing"))
+	assert.Equal(t, int64(0), c.do(t, "EXISTS", "empty"))
+
+	// 过期时间
+	assert.Equal(t, int64(-2), c.do(t, "TTL", "missing"))
+	assert.Equal(t, int64(-1), c.do(t, "TTL", "name"))
+	assert.Equal(t, "OK", c.do(t, "SET", "session", "s1", "EX", "100"))
+	assert.Equal(t, int64(100), c.do(t, "TTL", "session"))
+	assert.Equal(t, "OK", c.do(t, "SET", "short", "s2", "PX", "50"))
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, c.do(t, "GET", "short"))
+	assert.Equal(t, int64(-2), c.do(t, "PTTL", "short"))
+
+	// 错误的命令
+	assert.Error(t, c.do(t, "SET", "name").(error))
+	assert.Error(t, c.do(t, "SET", "name", "v", "EX", "abc").(error))
+	assert.Error(t, c.do(t, "SET", "name", "v", "NX").(error))
+	assert.Error(t, c.do(t, "UNKNOWN").(error))
+
+	// inline 命令
+	_, err := c.conn.Write([]byte("GET name\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bitcask"), c.read(t))
+
+	// 一次发送多条命令
+	c.send(t, "SET", "a", "1")
+	c.send(t, "GET", "a")
+	assert.Equal(t, "OK", c.read(t))
+	assert.Equal(t, []byte("1"), c.read(t))
+
+	assert.Equal(t, "OK", c.do(t, "QUIT"))
+	_, err = c.rd.ReadByte()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestServer_KeysAndScan(t *testing.T) {
+	server, db, addr := startServer(t)
+	defer db.Close()
+	defer server.Close()
+	c := newTestClient(t, addr)
+	defer c.conn.Close()
+
+	for i := 0; i < 25; i++ {
+		assert.Equal(t, "OK", c.do(t, "SET", fmt.Sprintf("user:%02d", i), "v"))
+	}
+	assert.Equal(t, "OK", c.do(t, "SET", "order:1", "v"))
+
+	assert.Equal(t, 26, len(c.do(t, "KEYS", "*").([]interface{})))
+	assert.Equal(t, 25, len(c.do(t, "KEYS", "user:*").([]interface{})))
+	assert.Equal(t, []interface{}{[]byte("user:01"), []byte("user:11"), []byte("user:21")},
+		c.do(t, "KEYS", "user:?1"))
+	assert.Equal(t, []interface{}{[]byte("order:1")}, c.do(t, "KEYS", "[o]rder:*"))
+
+	// 分批遍历所有的 key
+	var scanned []interface{}
+	cursor := "0"
+	for {
+		result := c.do(t, "SCAN", cursor, "MATCH", "user:*", "COUNT", "10").([]interface{})
+		cursor = string(result[0].([]byte))
+		// 游标是十进制的无符号整数
+		_, err := strconv.ParseUint(cursor, 10, 64)
+		assert.Nil(t, err)
+		scanned = append(scanned, result[1].([]interface{})...)
+		if cursor == "0" {
+			break
+		}
+	}
+	assert.Equal(t, 25, len(scanned))
+	assert.Error(t, c.do(t, "SCAN", "abc").(error))
+	assert.Error(t, c.do(t, "SCAN", "-1").(error))
+	assert.Error(t, c.do(t, "SCAN", "123456").(error))
+
+	// 两次遍历之间删除已经遍历过的 key，不会跳过剩下的 key
+	result := c.do(t, "SCAN", "0", "MATCH", "user:*", "COUNT", "10").([]interface{})
+	scanned = result[1].([]interface{})
+	for _, key := range scanned {
+		assert.Equal(t, int64(1), c.do(t, "DEL", string(key.([]byte))))
+	}
+	cursor = string(result[0].([]byte))
+	for cursor != "0" {
+		result = c.do(t, "SCAN", cursor, "MATCH", "user:*", "COUNT", "10").([]interface{})
+		cursor = string(result[0].([]byte))
+		scanned = append(scanned, result[1].([]interface{})...)
+	}
+	assert.Equal(t, 25, len(scanned))
+}
+
+func TestCursorTable(t *testing.T) {
+	cursors := newCursorTable()
+	first := cursors.add([]byte("key-0"))
+	assert.NotEqual(t, uint64(0), first)
+	key, ok := cursors.get(first)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("key-0"), key)
+	// 同一个游标可以重复使用
+	_, ok = cursors.get(first)
+	assert.True(t, ok)
+
+	// 超过上限时淘汰最早创建的游标
+	var last uint64
+	for i := 1; i <= maxScanCursors; i++ {
+		last = cursors.add([]byte(fmt.Sprintf("key-%d", i)))
+	}
+	_, ok = cursors.get(first)
+	assert.False(t, ok)
+	key, ok = cursors.get(last)
+	assert.True(t, ok)
+	assert.Equal(t, []byte(fmt.Sprintf("key-%d", maxScanCursors)), key)
+	assert.Equal(t, maxScanCursors, len(cursors.cursors))
+
+	// 过期的游标被清理
+	for elem := cursors.order.Front(); elem != nil; elem = elem.Next() {
+		elem.Value.(*scanCursor).created = time.Now().Add(-scanCursorTTL)
+	}
+	_, ok = cursors.get(last)
+	assert.False(t, ok)
+	assert.Equal(t, 0, len(cursors.cursors))
+}
+
+func TestServer_MultiExec(t *testing.T) {
+	server, db, addr := startServer(t)
+	defer db.Close()
+	defer server.Close()
+	c := newTestClient(t, addr)
+	defer c.conn.Close()
+
+	assert.Equal(t, "OK", c.do(t, "SET", "a", "1"))
+	assert.Equal(t, "OK", c.do(t, "MULTI"))
+	assert.Equal(t, "QUEUED", c.do(t, "SET", "b", "2"))
+	assert.Equal(t, "QUEUED", c.do(t, "SET", "c", "3", "EX", "100"))
+	assert.Equal(t, "QUEUED", c.do(t, "DEL", "a", "b", "missing"))
+
+	// 另一个客户端在事务提交之前看不到写入的数据
+	c2 := newTestClient(t, addr)
+	defer c2.conn.Close()
+	assert.Nil(t, c2.do(t, "GET", "c"))
+
+	assert.Equal(t, []interface{}{"OK", "OK", int64(2)}, c.do(t, "EXEC"))
+	assert.Nil(t, c2.do(t, "GET", "a"))
+	assert.Nil(t, c2.do(t, "GET", "b"))
+	assert.Equal(t, []byte("3"), c2.do(t, "GET", "c"))
+	assert.Equal(t, int64(100), c2.do(t, "TTL", "c"))
+
+	// 入队失败的事务会被放弃
+	assert.Equal(t, "OK", c.do(t, "MULTI"))
+	assert.Equal(t, "QUEUED", c.do(t, "SET", "d", "4"))
+	assert.Error(t, c.do(t, "GET", "d").(error))
+	assert.Error(t, c.do(t, "EXEC").(error))
+	assert.Nil(t, c.do(t, "GET", "d"))
+
+	assert.Equal(t, "OK", c.do(t, "MULTI"))
+	assert.Equal(t, "QUEUED", c.do(t, "SET", "d", "4"))
+	assert.Equal(t, "OK", c.do(t, "DISCARD"))
+	assert.Nil(t, c.do(t, "GET", "d"))
+	assert.Error(t, c.do(t, "EXEC").(error))
+}
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		key     string
+		matched bool
+	}{
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "order:1", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"*a*b", "xaybzb", true},
+		{"*a*b", "xaybzc", false},
+		{"a**", "a", true},
+		{"*[0-9]", "user:1", true},
+		{`\\\\`, `\\`, true},
+		{"", "", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.matched, matchPattern([]byte(c.pattern), []byte(c.key)), c.pattern+" "+c.key)
+	}
+
+	// 大量的 * 不会导致匹配的耗时指数增长
+	key := []byte(strings.Repeat("a", 64))
+	start := time.Now()
+	assert.False(t, matchPattern([]byte(strings.Repeat("a*", 32)+"b"), key))
+	assert.True(t, time.Since(start) < time.Second)
+
+	assert.Equal(t, []byte("user:"), literalPrefix([]byte("user:*")))
+	assert.Equal(t, []byte("a*b"), literalPrefix([]byte(`a\*b?`)))
+}
+
+func TestServer_Close(t *testing.T) {
+	server, db, addr := startServer(t)
+	defer db.Close()
+	c := newTestClient(t, addr)
+	assert.Equal(t, "PONG", c.do(t, "PING"))
+
+	assert.Nil(t, server.Close())
+	_, err := c.rd.ReadByte()
+	assert.NotNil(t, err)
+	_, err = net.Dial("tcp", addr)
+	assert.NotNil(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	assert.Equal(t, ErrServerClosed, server.Serve(listener))
+}
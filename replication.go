@@ -0,0 +1,308 @@
+package kv_go
+
+import (
+	"KV-go/data"
+	"KV-go/fio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const replicationEpochKey = "replication.epoch"
+
+// 数据文件中的记录可以按照 (Fid, Offset) 原样复制到另一个数据库中，follower 的数据文件和 primary 保持一致
+// follower 需要使用和 primary 相同的压缩和加密配置，并以 ReadOnly 的方式打开
+// 只有已经持久化的数据才会被复制，primary 宕机之后丢失的数据不会出现在 follower 上
+// primary 进行 merge 并重启之后，被 merge 过的数据文件会被重写，启动时截断或者跳过了损坏的数据时，数据文件同样发生了变化，
+// epoch 随之加一，epoch 不一致的位置已经无法继续复制，follower 需要清空数据之后重新复制
+
+// ReplicationPosition 数据文件的 epoch，以及活跃文件中已经写入的位置，follower 从这个位置继续复制
+func (db *DB) ReplicationPosition() (uint64, uint32, int64) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.activeFile == nil {
+		return db.replicationEpoch, 0, 0
+	}
+	return db.replicationEpoch, db.activeFile.FileId, db.activeFile.WriteOff
+}
+
+// ReadReplicationLog 从 (fid, offset) 开始读取数据文件中完整的记录，读到 maxBytes 之后停止，但至少包含一条记录
+// 返回数据实际开始的位置，当前的数据文件已经读完时从下一个数据文件的开头读取
+// 只读取活跃文件中已经持久化的数据，还有没有持久化的数据时先进行持久化
+// 没有新的数据时返回当前写入的位置和空的数据
+// epoch 和当前的不一致时返回 ErrReplicationPositionLost，从头开始复制的位置 (0, 0) 除外
+func (db *DB) ReadReplicationLog(epoch uint64, fid uint32, offset int64, maxBytes int) (uint32, int64, []byte, error) {
+	if err := db.syncActiveFileData(); err != nil {
+		return 0, 0, nil, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if epoch != db.replicationEpoch && (fid != 0 || offset != 0) {
+		return 0, 0, nil, ErrReplicationPositionLost
+	}
+
+	for {
+		if db.activeFile == nil {
+			if fid != 0 || offset != 0 {
+				return 0, 0, nil, ErrReplicationPositionLost
+			}
+			return 0, 0, nil, nil
+		}
+
+		dataFile := db.dataFile(fid)
+		if dataFile == nil {
+			// 文件不存在时只能从下一个数据文件的开头继续
+			next, ok := db.nextDataFileId(fid)
+			if offset != 0 || !ok {
+				return 0, 0, nil, ErrReplicationPositionLost
+			}
+			fid = next
+			continue
+		}
+
+		// 旧的数据文件在切换时已经持久化过
+		size := dataFile.SyncedOff()
+		if dataFile != db.activeFile {
+			var err error
+			if size, err = dataFile.IoManager.Size(); err != nil {
+				return 0, 0, nil, err
+			}
+		}
+		if offset > size {
+			return 0, 0, nil, ErrReplicationPositionLost
+		}
+		if offset == size {
+			if dataFile == db.activeFile {
+				return fid, offset, nil, nil
+			}
+			fid, _ = db.nextDataFileId(fid)
+			offset = 0
+			continue
+		}
+
+		// 只复制完整的记录，这里只解析 header 找到记录的边界，不校验 crc，也不做解密和解压
+		// 校验失败的记录同样原样复制，由 follower 按照自己的恢复策略处理
+		end := offset
+		for end < size && end-offset < int64(maxBytes) {
+			recordSize, err := dataFile.ReadLogRecordSize(end)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return 0, 0, nil, err
+			}
+			if end+recordSize > size {
+				return 0, 0, nil, data.ErrIncompleteLogRecord
+			}
+			end += recordSize
+		}
+		if end == offset {
+			// 旧的数据文件末尾没有有效的数据，直接跳到下一个数据文件
+			if dataFile == db.activeFile {
+				return fid, offset, nil, nil
+			}
+			fid, _ = db.nextDataFileId(fid)
+			offset = 0
+			continue
+		}
+
+		chunk, err := dataFile.ReadRaw(offset, end-offset)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		return fid, offset, chunk, nil
+	}
+}
+
+// WaitReplicationLog 等待 (fid, offset) 之后写入新的数据，直到超时，数据库已经关闭时返回 false
+func (db *DB) WaitReplicationLog(fid uint32, offset int64, timeout time.Duration) bool {
+	select {
+	case <-db.closeCh:
+		return false
+	default:
+	}
+
+	db.mu.Lock()
+	if db.activeFile != nil && (db.activeFile.FileId != fid || db.activeFile.WriteOff != offset) {
+		db.mu.Unlock()
+		return true
+	}
+	if db.appendCh == nil {
+		db.appendCh = make(chan struct{})
+	}
+	appendCh := db.appendCh
+	db.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-appendCh:
+	case <-timer.C:
+	case <-db.closeCh:
+		return false
+	}
+	return true
+}
+
+// ApplyReplicationLog 将从 primary 复制过来的数据写入 (fid, offset) 处，并更新索引
+// offset 必须和本地数据文件写入的位置一致，offset 为 0 并且 fid 更大时切换到新的数据文件
+// 还没有复制过任何数据时使用 primary 的 epoch，之后 epoch 不一致时返回 ErrReplicationPositionLost
+func (db *DB) ApplyReplicationLog(epoch uint64, fid uint32, offset int64, chunk []byte) error {
+	if !db.option.ReadOnly {
+		return ErrReplicaNotReadOnly
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if epoch != db.replicationEpoch {
+		if db.activeFile != nil && (db.activeFile.WriteOff > 0 || len(db.olderFiles) > 0) {
+			return ErrReplicationPositionLost
+		}
+		if err := saveReplicationEpoch(db.option.DirPath, epoch); err != nil {
+			return err
+		}
+		db.replicationEpoch = epoch
+	}
+
+	if db.activeFile == nil || db.activeFile.FileId != fid {
+		if offset != 0 || (db.activeFile != nil && fid < db.activeFile.FileId) {
+			return ErrReplicationPositionMismatch
+		}
+		if err := db.setReplicationDataFile(fid); err != nil {
+			return err
+		}
+	} else if db.activeFile.WriteOff != offset {
+		return ErrReplicationPositionMismatch
+	}
+
+	if err := db.activeFile.Write(chunk); err != nil {
+		return err
+	}
+	db.addUnsyncedBytes(int64(len(chunk)))
+	if db.option.SyncWrites {
+		if err := db.activeFile.Sync(); err != nil {
+			return err
+		}
+	}
+
+	// 从写入的数据中解析出每一条记录，更新索引
+	if db.pendingTxnRecords == nil {
+		db.pendingTxnRecords = make(map[uint64][]*data.TransactionRecord)
+	}
+	for off := offset; off < db.activeFile.WriteOff; {
+		logRecord, size, err := db.activeFile.ReadLogRecord(off)
+		if err != nil {
+			// primary 上校验失败的记录同样被跳过
+			if err == data.ErrInvalidCRC && size > 0 {
+				off += size
+				continue
+			}
+			return err
+		}
+		pos := &data.LogRecordPos{Fid: fid, Offset: off, Size: uint32(size), Expire: logRecord.Expire}
+		seqNo, err := db.replayLogRecord(logRecord, pos, db.pendingTxnRecords)
+		if err != nil {
+			return err
+		}
+		for {
+			current := atomic.LoadUint64(&db.seqNo)
+			if seqNo <= current || atomic.CompareAndSwapUint64(&db.seqNo, current, seqNo) {
+				break
+			}
+		}
+		off += size
+	}
+
+	// 持久化的索引记录已经应用的位置，重启之后从这里继续重放
+	if err := db.saveAppliedPosition(); err != nil {
+		return err
+	}
+
+	db.notifyAppend()
+	return nil
+}
+
+// 从文件中加载复制的 epoch，文件不存在时为 0
+func (db *DB) loadReplicationEpoch() error {
+	fileName := filepath.Join(db.option.DirPath, data.EpochFileName)
+	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+		return nil
+	}
+
+	epochFile, err := data.OpenEpochFile(db.option.DirPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = epochFile.Close()
+	}()
+	record, _, err := epochFile.ReadLogRecord(0)
+	if err != nil {
+		return err
+	}
+	epoch, err := strconv.ParseUint(string(record.Value), 10, 64)
+	if err != nil {
+		return err
+	}
+	db.replicationEpoch = epoch
+	return nil
+}
+
+// 将复制的 epoch 保存到 dirPath 中
+func saveReplicationEpoch(dirPath string, epoch uint64) error {
+	record := &data.LogRecord{
+		Key:   []byte(replicationEpochKey),
+		Value: []byte(strconv.FormatUint(epoch, 10)),
+	}
+	return saveRecordFile(filepath.Join(dirPath, data.EpochFileName), record)
+}
+
+// 将活跃文件切换为指定 id 的数据文件，follower 的数据文件 id 和 primary 保持一致
+func (db *DB) setReplicationDataFile(fid uint32) error {
+	if db.activeFile != nil {
+		if err := db.activeFile.Sync(); err != nil {
+			return err
+		}
+		db.olderFiles[db.activeFile.FileId] = db.activeFile
+	}
+	dataFile, err := data.OpenDataFile(db.option.DirPath, fid, fio.StandardFIO)
+	if err != nil {
+		return err
+	}
+	dataFile.Codec = db.codec
+	db.activeFile = dataFile
+	return nil
+}
+
+// 通知等待新数据的 follower，调用方需要持有互斥锁
+func (db *DB) notifyAppend() {
+	if db.appendCh != nil {
+		close(db.appendCh)
+		db.appendCh = nil
+	}
+}
+
+// 根据 id 查找数据文件，调用方需要持有锁
+func (db *DB) dataFile(fid uint32) *data.DataFile {
+	if db.activeFile != nil && db.activeFile.FileId == fid {
+		return db.activeFile
+	}
+	return db.olderFiles[fid]
+}
+
+// 比 fid 更大的最小的数据文件 id，调用方需要持有锁
+func (db *DB) nextDataFileId(fid uint32) (uint32, bool) {
+	next, ok := db.activeFile.FileId, db.activeFile.FileId > fid
+	for id := range db.olderFiles {
+		if id > fid && id < next {
+			next, ok = id, true
+		}
+	}
+	return next, ok
+}
@@ -0,0 +1,169 @@
+package replication
+
+import (
+	kv "KV-go"
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrFollowerClosed follower 已经关闭
+var ErrFollowerClosed = errors.New("replication: follower closed")
+
+const (
+	dialTimeout      = 3 * time.Second
+	minRetryInterval = 100 * time.Millisecond
+	maxRetryInterval = 5 * time.Second
+)
+
+// Follower 从 primary 复制数据到本地的数据库中
+// 本地的数据库需要以 ReadOnly 的方式打开，只能读取，不能直接写入
+// 连接断开之后从本地数据文件写入的位置重新开始复制
+type Follower struct {
+	db      *kv.DB
+	addr    string
+	mu      sync.Mutex
+	conn    net.Conn
+	running sync.WaitGroup
+	closeCh chan struct{}
+	closed  bool
+}
+
+// NewFollower 创建一个从 addr 复制数据的 follower，db 需要在 Close 之后再关闭
+func NewFollower(db *kv.DB, addr string) *Follower {
+	return &Follower{
+		db:      db,
+		addr:    addr,
+		closeCh: make(chan struct{}),
+	}
+}
+
+// fatalError 重新连接也无法恢复的错误
+type fatalError struct {
+	err error
+}
+
+func (e *fatalError) Error() string {
+	return e.err.Error()
+}
+
+// Run 持续从 primary 复制数据，连接断开之后自动重连，直到 follower 被关闭或者出现无法恢复的错误
+// follower 关闭之后返回 ErrFollowerClosed
+func (f *Follower) Run() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return ErrFollowerClosed
+	}
+	f.running.Add(1)
+	f.mu.Unlock()
+	defer f.running.Done()
+
+	retryInterval := minRetryInterval
+	for {
+		connected, err := f.replicate()
+		if f.isClosed() {
+			return ErrFollowerClosed
+		}
+		var fatal *fatalError
+		if errors.As(err, &fatal) {
+			return fatal.err
+		}
+
+		// 连接成功过之后重新从最短的间隔开始重试
+		if connected {
+			retryInterval = minRetryInterval
+		}
+		select {
+		case <-time.After(retryInterval):
+		case <-f.closeCh:
+			return ErrFollowerClosed
+		}
+		if retryInterval *= 2; retryInterval > maxRetryInterval {
+			retryInterval = maxRetryInterval
+		}
+	}
+}
+
+// Close 断开和 primary 的连接，并等待正在写入的数据完成
+func (f *Follower) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	close(f.closeCh)
+	if f.conn != nil {
+		_ = f.conn.Close()
+	}
+	f.mu.Unlock()
+
+	f.running.Wait()
+	return nil
+}
+
+func (f *Follower) isClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+// replicate 建立一次连接并持续复制，直到连接断开，返回是否成功建立过连接
+func (f *Follower) replicate() (bool, error) {
+	conn, err := net.DialTimeout("tcp", f.addr, dialTimeout)
+	if err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		_ = conn.Close()
+		return false, ErrFollowerClosed
+	}
+	f.conn = conn
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.conn = nil
+		f.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	// 从本地已经写入的位置开始复制
+	epoch, fid, offset := f.db.ReplicationPosition()
+	_ = conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	if err := writeHandshake(conn, epoch, fid, offset); err != nil {
+		return false, err
+	}
+
+	reader := bufio.NewReader(conn)
+	for {
+		// 几个心跳间隔都没有收到数据，认为 primary 已经不可用
+		_ = conn.SetReadDeadline(time.Now().Add(3 * heartbeatInterval))
+		fr, err := readFrame(reader)
+		if err != nil {
+			return true, err
+		}
+		switch fr.typ {
+		case frameData:
+			if err := f.db.ApplyReplicationLog(fr.epoch, fr.fid, fr.offset, fr.payload); err != nil {
+				return true, &fatalError{err: err}
+			}
+		case frameHeartbeat:
+			// primary 的活跃文件还没有写入数据时，同样切换到这个数据文件，保持位置一致
+			if _, localFid, _ := f.db.ReplicationPosition(); fr.offset == 0 && fr.fid != localFid {
+				if err := f.db.ApplyReplicationLog(fr.epoch, fr.fid, fr.offset, nil); err != nil {
+					return true, &fatalError{err: err}
+				}
+			}
+		case frameError:
+			return true, &fatalError{err: fmt.Errorf("replication: primary: %s", fr.payload)}
+		default:
+			return true, &fatalError{err: fmt.Errorf("replication: unknown frame type %d", fr.typ)}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package replication
+
+import (
+	kv "KV-go"
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrPrimaryClosed 服务已经关闭
+var ErrPrimaryClosed = errors.New("replication: primary closed")
+
+// 没有新数据时发送心跳的间隔，follower 超过几个间隔没有收到任何数据时认为连接已经断开
+var heartbeatInterval = time.Second
+
+// Primary 将数据文件中追加的记录通过 TCP 推送给 follower
+// 每个 follower 从自己上报的 (Fid, Offset) 开始复制，之后持续接收新写入的记录
+type Primary struct {
+	db       *kv.DB
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	closed   bool
+}
+
+// NewPrimary 创建复制的服务端
+func NewPrimary(db *kv.DB) *Primary {
+	return &Primary{
+		db:    db,
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe 监听 TCP 地址并处理 follower 的连接，直到服务被关闭
+func (p *Primary) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return p.Serve(listener)
+}
+
+// Serve 在给定的 listener 上处理 follower 的连接，服务关闭之后返回 ErrPrimaryClosed
+func (p *Primary) Serve(listener net.Listener) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		_ = listener.Close()
+		return ErrPrimaryClosed
+	}
+	p.listener = listener
+	p.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if closed {
+				return ErrPrimaryClosed
+			}
+			return err
+		}
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			_ = conn.Close()
+			return ErrPrimaryClosed
+		}
+		p.conns[conn] = struct{}{}
+		p.wg.Add(1)
+		p.mu.Unlock()
+
+		go p.handleConn(conn)
+	}
+}
+
+// Close 停止监听并断开所有的 follower
+func (p *Primary) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	var err error
+	if p.listener != nil {
+		err = p.listener.Close()
+	}
+	for conn := range p.conns {
+		_ = conn.Close()
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return err
+}
+
+func (p *Primary) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+func (p *Primary) handleConn(conn net.Conn) {
+	defer func() {
+		p.mu.Lock()
+		delete(p.conns, conn)
+		p.mu.Unlock()
+		_ = conn.Close()
+		p.wg.Done()
+	}()
+
+	_ = conn.SetReadDeadline(time.Now().Add(3 * heartbeatInterval))
+	followerEpoch, fid, offset, err := readHandshake(conn)
+	if err != nil {
+		return
+	}
+	// primary 的 epoch 只在启动时加载 merge 的结果之后才会变化
+	epoch, _, _ := p.db.ReplicationPosition()
+	_ = conn.SetReadDeadline(time.Time{})
+
+	writer := bufio.NewWriter(conn)
+	send := func(f *frame) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(3 * heartbeatInterval))
+		if err := writeFrame(writer, f); err != nil {
+			return err
+		}
+		return writer.Flush()
+	}
+
+	lastSent := time.Now()
+	for !p.isClosed() {
+		chunkFid, chunkOffset, chunk, err := p.db.ReadReplicationLog(followerEpoch, fid, offset, maxChunkSize)
+		if err != nil {
+			_ = send(&frame{typ: frameError, epoch: epoch, fid: fid, offset: offset, payload: []byte(err.Error())})
+			return
+		}
+		fid, offset = chunkFid, chunkOffset
+		// 从头开始复制的 follower 在写入第一批数据之后使用 primary 的 epoch
+		followerEpoch = epoch
+
+		if len(chunk) == 0 {
+			// 没有新的数据，定期发送心跳，同时检测连接是否已经断开
+			if time.Since(lastSent) >= heartbeatInterval {
+				if err := send(&frame{typ: frameHeartbeat, epoch: epoch, fid: fid, offset: offset}); err != nil {
+					return
+				}
+				lastSent = time.Now()
+			}
+			if !p.db.WaitReplicationLog(fid, offset, heartbeatInterval-time.Since(lastSent)) {
+				return
+			}
+			continue
+		}
+
+		if err := send(&frame{typ: frameData, epoch: epoch, fid: fid, offset: offset, payload: chunk}); err != nil {
+			return
+		}
+		lastSent = time.Now()
+		offset += int64(len(chunk))
+	}
+}
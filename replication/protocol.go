@@ -0,0 +1,118 @@
+package replication
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// 复制协议
+//
+// follower 连接之后先发送握手消息，带上本地数据文件的 epoch 和写入的位置：
+//
+//	+---------+---------+---------+------------+
+//	|  magic  |  epoch  |   fid   |   offset   |
+//	+---------+---------+---------+------------+
+//	 4 bytes   8 bytes   4 bytes    8 bytes
+//
+// 之后 primary 持续发送帧，数据帧中是数据文件 fid 中从 offset 开始的完整记录，epoch 为 primary 数据文件的 epoch：
+//
+//	+--------+---------+---------+------------+------------+-----------+
+//	|  type  |  epoch  |   fid   |   offset   |   length   |  payload  |
+//	+--------+---------+---------+------------+------------+-----------+
+//	 1 byte    8 bytes   4 bytes    8 bytes      4 bytes     length
+
+const (
+	handshakeSize   = 4 + 8 + 4 + 8
+	frameHeaderSize = 1 + 8 + 4 + 8 + 4
+
+	// 单个帧中最多携带的数据量，一条记录比它更大时单独发送
+	maxChunkSize = 1024 * 1024
+	// 帧中 payload 的上限，避免异常的长度导致分配过大的内存
+	maxFrameSize = 256 * 1024 * 1024
+)
+
+var handshakeMagic = [4]byte{'K', 'V', 'R', 'P'}
+
+type frameType = byte
+
+const (
+	// frameData 数据文件中的记录
+	frameData frameType = iota + 1
+	// frameHeartbeat 没有新数据时定期发送，携带 primary 当前写入的位置
+	frameHeartbeat
+	// frameError primary 无法继续复制，payload 为错误信息，发送之后关闭连接
+	frameError
+)
+
+var errBadHandshake = errors.New("replication: bad handshake")
+
+type frame struct {
+	typ     frameType
+	epoch   uint64
+	fid     uint32
+	offset  int64
+	payload []byte
+}
+
+func writeHandshake(w io.Writer, epoch uint64, fid uint32, offset int64) error {
+	var buf [handshakeSize]byte
+	copy(buf[:4], handshakeMagic[:])
+	binary.BigEndian.PutUint64(buf[4:12], epoch)
+	binary.BigEndian.PutUint32(buf[12:16], fid)
+	binary.BigEndian.PutUint64(buf[16:], uint64(offset))
+	_, err := w.Write(buf[:])
+	return err
+}
+
+func readHandshake(r io.Reader) (uint64, uint32, int64, error) {
+	var buf [handshakeSize]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, 0, 0, err
+	}
+	if !bytes.Equal(buf[:4], handshakeMagic[:]) {
+		return 0, 0, 0, errBadHandshake
+	}
+	offset := int64(binary.BigEndian.Uint64(buf[16:]))
+	if offset < 0 {
+		return 0, 0, 0, errBadHandshake
+	}
+	return binary.BigEndian.Uint64(buf[4:12]), binary.BigEndian.Uint32(buf[12:16]), offset, nil
+}
+
+func writeFrame(w io.Writer, f *frame) error {
+	var header [frameHeaderSize]byte
+	header[0] = f.typ
+	binary.BigEndian.PutUint64(header[1:9], f.epoch)
+	binary.BigEndian.PutUint32(header[9:13], f.fid)
+	binary.BigEndian.PutUint64(header[13:21], uint64(f.offset))
+	binary.BigEndian.PutUint32(header[21:], uint32(len(f.payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(f.payload)
+	return err
+}
+
+func readFrame(r io.Reader) (*frame, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	f := &frame{
+		typ:    header[0],
+		epoch:  binary.BigEndian.Uint64(header[1:9]),
+		fid:    binary.BigEndian.Uint32(header[9:13]),
+		offset: int64(binary.BigEndian.Uint64(header[13:21])),
+	}
+	length := binary.BigEndian.Uint32(header[21:])
+	if length > maxFrameSize || f.offset < 0 {
+		return nil, errors.New("replication: invalid frame")
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,227 @@
+package replication
+
+import (
+	kv "KV-go"
+	"KV-go/utils"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func init() {
+	// 缩短心跳间隔，让断开的连接更快被发现
+	heartbeatInterval = 100 * time.Millisecond
+}
+
+func openDB(t *testing.T, name string, readOnly bool) *kv.DB {
+	opts := kv.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-replication-"+name)
+	opts.DirPath = dir
+	opts.DataFileSize = 16 * 1024
+	opts.ReadOnly = readOnly
+	db, err := kv.Open(opts)
+	assert.Nil(t, err)
+	return db
+}
+
+func startPrimary(t *testing.T, db *kv.DB, addr string) (*Primary, string) {
+	listener, err := net.Listen("tcp", addr)
+	assert.Nil(t, err)
+	primary := NewPrimary(db)
+	go func() {
+		_ = primary.Serve(listener)
+	}()
+	return primary, listener.Addr().String()
+}
+
+func startFollower(db *kv.DB, addr string) (*Follower, chan error) {
+	follower := NewFollower(db, addr)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- follower.Run()
+	}()
+	return follower, errCh
+}
+
+// 等待 follower 复制到 primary 当前写入的位置
+func waitCaughtUp(t *testing.T, primary, follower *kv.DB) {
+	assert.Eventually(t, func() bool {
+		pEpoch, pFid, pOffset := primary.ReplicationPosition()
+		fEpoch, fFid, fOffset := follower.ReplicationPosition()
+		return pEpoch == fEpoch && pFid == fFid && pOffset == fOffset
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestReplication_Follow(t *testing.T) {
+	primaryDB := openDB(t, "primary", false)
+	defer primaryDB.Close()
+	followerDB := openDB(t, "follower", true)
+	defer followerDB.Close()
+
+	// 启动之前已经写入的数据
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, primaryDB.Put(utils.GetTestKey(i), utils.RandomValue(256)))
+	}
+
+	primary, addr := startPrimary(t, primaryDB, "127.0.0.1:0")
+	defer primary.Close()
+	follower, errCh := startFollower(followerDB, addr)
+
+	waitCaughtUp(t, primaryDB, followerDB)
+	assert.Equal(t, 100, len(followerDB.ListKeys()))
+
+	// 之后写入的数据持续复制过来
+	assert.Nil(t, primaryDB.Delete(utils.GetTestKey(0)))
+	wb := primaryDB.NewWriteBatch(kv.DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put([]byte("batch-1"), []byte("v1")))
+	assert.Nil(t, wb.Put([]byte("batch-2"), []byte("v2")))
+	assert.Nil(t, wb.Commit())
+	txn := primaryDB.Begin()
+	assert.Nil(t, txn.Put([]byte("txn"), []byte("v3")))
+	assert.Nil(t, txn.Commit())
+	for i := 100; i < 200; i++ {
+		assert.Nil(t, primaryDB.Put(utils.GetTestKey(i), utils.RandomValue(256)))
+	}
+
+	waitCaughtUp(t, primaryDB, followerDB)
+	assert.Equal(t, len(primaryDB.ListKeys()), len(followerDB.ListKeys()))
+	_, err := followerDB.Get(utils.GetTestKey(0))
+	assert.Equal(t, kv.ErrKeyNotFound, err)
+	for _, key := range []string{"batch-1", "batch-2", "txn"} {
+		expected, err := primaryDB.Get([]byte(key))
+		assert.Nil(t, err)
+		value, err := followerDB.Get([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, value)
+	}
+
+	// follower 拒绝直接写入
+	assert.Equal(t, kv.ErrReadOnly, followerDB.Put([]byte("direct"), []byte("v")))
+	assert.Equal(t, kv.ErrReadOnly, followerDB.Delete(utils.GetTestKey(1)))
+
+	assert.Nil(t, follower.Close())
+	assert.Equal(t, ErrFollowerClosed, <-errCh)
+}
+
+func TestReplication_Resume(t *testing.T) {
+	primaryDB := openDB(t, "primary", false)
+	defer primaryDB.Close()
+	followerDB := openDB(t, "follower", true)
+	defer followerDB.Close()
+
+	primary, addr := startPrimary(t, primaryDB, "127.0.0.1:0")
+	follower, errCh := startFollower(followerDB, addr)
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, primaryDB.Put(utils.GetTestKey(i), utils.RandomValue(256)))
+	}
+	waitCaughtUp(t, primaryDB, followerDB)
+
+	// primary 断开期间写入的数据在重新连接之后继续复制
+	assert.Nil(t, primary.Close())
+	for i := 50; i < 150; i++ {
+		assert.Nil(t, primaryDB.Put(utils.GetTestKey(i), utils.RandomValue(256)))
+	}
+	primary, _ = startPrimary(t, primaryDB, addr)
+	defer primary.Close()
+	waitCaughtUp(t, primaryDB, followerDB)
+	assert.Equal(t, 150, len(followerDB.ListKeys()))
+
+	// follower 重启之后从本地的位置继续复制
+	assert.Nil(t, follower.Close())
+	assert.Equal(t, ErrFollowerClosed, <-errCh)
+	for i := 150; i < 200; i++ {
+		assert.Nil(t, primaryDB.Put(utils.GetTestKey(i), utils.RandomValue(256)))
+	}
+	follower, errCh = startFollower(followerDB, addr)
+	waitCaughtUp(t, primaryDB, followerDB)
+	assert.Equal(t, 200, len(followerDB.ListKeys()))
+	for i := 0; i < 200; i += 25 {
+		expected, err := primaryDB.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		value, err := followerDB.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, value)
+	}
+
+	assert.Nil(t, follower.Close())
+	assert.Equal(t, ErrFollowerClosed, <-errCh)
+}
+
+func TestReplication_Errors(t *testing.T) {
+	primaryDB := openDB(t, "primary", false)
+	defer primaryDB.Close()
+	primary, addr := startPrimary(t, primaryDB, "127.0.0.1:0")
+	defer primary.Close()
+	assert.Nil(t, primaryDB.Put(utils.GetTestKey(0), utils.RandomValue(10)))
+
+	// follower 的数据库没有以只读的方式打开
+	writableDB := openDB(t, "writable", false)
+	defer writableDB.Close()
+	_, errCh := startFollower(writableDB, addr)
+	assert.Equal(t, kv.ErrReplicaNotReadOnly, <-errCh)
+
+	// follower 的数据比 primary 更新，无法继续复制
+	opts := kv.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-replication-ahead")
+	opts.DirPath = dir
+	aheadDB, err := kv.Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, aheadDB.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	assert.Nil(t, aheadDB.Close())
+	opts.ReadOnly = true
+	aheadDB, err = kv.Open(opts)
+	assert.Nil(t, err)
+	defer aheadDB.Close()
+	_, errCh = startFollower(aheadDB, addr)
+	err = <-errCh
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), kv.ErrReplicationPositionLost.Error())
+}
+
+func TestReplication_Merge(t *testing.T) {
+	opts := kv.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-replication-merge")
+	opts.DirPath = dir
+	opts.DataFileSize = 16 * 1024
+	primaryDB, err := kv.Open(opts)
+	assert.Nil(t, err)
+	followerDB := openDB(t, "follower", true)
+	defer followerDB.Close()
+
+	for i := 0; i < 200; i++ {
+		assert.Nil(t, primaryDB.Put(utils.GetTestKey(i%100), utils.RandomValue(256)))
+	}
+	primary, addr := startPrimary(t, primaryDB, "127.0.0.1:0")
+	follower, errCh := startFollower(followerDB, addr)
+	waitCaughtUp(t, primaryDB, followerDB)
+	assert.Nil(t, follower.Close())
+	assert.Equal(t, ErrFollowerClosed, <-errCh)
+	assert.Nil(t, primary.Close())
+
+	// primary merge 之后重启，数据文件被重写，follower 不能继续复制
+	assert.Nil(t, primaryDB.Merge())
+	assert.Nil(t, primaryDB.Close())
+	primaryDB, err = kv.Open(opts)
+	assert.Nil(t, err)
+	defer primaryDB.Close()
+	primary, _ = startPrimary(t, primaryDB, addr)
+	defer primary.Close()
+
+	_, errCh = startFollower(followerDB, addr)
+	err = <-errCh
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), kv.ErrReplicationPositionLost.Error())
+
+	// 新的 follower 可以从头开始复制
+	newFollowerDB := openDB(t, "new-follower", true)
+	defer newFollowerDB.Close()
+	newFollower, errCh := startFollower(newFollowerDB, addr)
+	waitCaughtUp(t, primaryDB, newFollowerDB)
+	assert.Equal(t, 100, len(newFollowerDB.ListKeys()))
+	assert.Nil(t, newFollower.Close())
+	assert.Equal(t, ErrFollowerClosed, <-errCh)
+}
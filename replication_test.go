@@ -0,0 +1,240 @@
+package kv_go
+
+import (
+	"KV-go/data"
+	"KV-go/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+// 从 follower 写入的位置开始，将 primary 中的数据逐条复制到 follower 中，最多复制 n 条
+func copyReplicationLog(t *testing.T, primary, follower *DB, n int) {
+	for i := 0; i < n; i++ {
+		epoch, fid, offset := follower.ReplicationPosition()
+		fid, offset, chunk, err := primary.ReadReplicationLog(epoch, fid, offset, 1)
+		assert.Nil(t, err)
+		if len(chunk) == 0 {
+			return
+		}
+		epoch, _, _ = primary.ReplicationPosition()
+		assert.Nil(t, follower.ApplyReplicationLog(epoch, fid, offset, chunk))
+	}
+}
+
+func TestDB_ReplicationLog(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-replication-primary")
+	opts.DirPath = dir
+	opts.DataFileSize = 4 * 1024
+	primary, err := Open(opts)
+	defer destroyDB(primary)
+	assert.Nil(t, err)
+
+	followerOpts := opts
+	followerDir, _ := os.MkdirTemp("", "bitcask-go-replication-follower")
+	followerOpts.DirPath = followerDir
+	followerOpts.ReadOnly = true
+	follower, err := Open(followerOpts)
+	assert.Nil(t, err)
+
+	// 只读的数据库拒绝所有的写入
+	assert.Equal(t, ErrReadOnly, follower.Put(utils.GetTestKey(0), utils.RandomValue(10)))
+	assert.Equal(t, ErrReadOnly, follower.Delete(utils.GetTestKey(0)))
+	wb := follower.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put(utils.GetTestKey(0), utils.RandomValue(10)))
+	assert.Equal(t, ErrReadOnly, wb.Commit())
+	txn := follower.Begin()
+	assert.Nil(t, txn.Put(utils.GetTestKey(0), utils.RandomValue(10)))
+	assert.Equal(t, ErrReadOnly, txn.Commit())
+	assert.Equal(t, ErrReadOnly, follower.Merge())
+	// 可以写入的数据库不能写入复制的数据
+	assert.Equal(t, ErrReplicaNotReadOnly, primary.ApplyReplicationLog(0, 0, 0, nil))
+
+	// 写入的数据跨越多个数据文件
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, primary.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	assert.Nil(t, primary.Delete(utils.GetTestKey(0)))
+	copyReplicationLog(t, primary, follower, 1000)
+	assert.Equal(t, 99, len(follower.ListKeys()))
+	stat, err := follower.Stat()
+	assert.Nil(t, err)
+	assert.True(t, stat.DataFileNum > 1)
+
+	// 事务的数据在复制过来事务完成的标记之后才可见，follower 重启之后仍然可以继续完成
+	wb = primary.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put(utils.GetTestKey(200), []byte("v200")))
+	assert.Nil(t, wb.Put(utils.GetTestKey(201), []byte("v201")))
+	assert.Nil(t, wb.Commit())
+	copyReplicationLog(t, primary, follower, 2)
+	_, err = follower.Get(utils.GetTestKey(200))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.Nil(t, follower.Close())
+	follower, err = Open(followerOpts)
+	defer destroyDB(follower)
+	assert.Nil(t, err)
+	copyReplicationLog(t, primary, follower, 1000)
+	value, err := follower.Get(utils.GetTestKey(201))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v201"), value)
+
+	pEpoch, pFid, pOffset := primary.ReplicationPosition()
+	fEpoch, fFid, fOffset := follower.ReplicationPosition()
+	assert.Equal(t, pEpoch, fEpoch)
+	assert.Equal(t, pFid, fFid)
+	assert.Equal(t, pOffset, fOffset)
+
+	// 位置不连续或者超过了 primary 写入的位置
+	assert.Equal(t, ErrReplicationPositionMismatch, follower.ApplyReplicationLog(fEpoch, fFid, fOffset+1, []byte("x")))
+	_, _, _, err = primary.ReadReplicationLog(pEpoch, pFid, pOffset+1, 1)
+	assert.Equal(t, ErrReplicationPositionLost, err)
+	_, _, _, err = primary.ReadReplicationLog(pEpoch, pFid+1, 0, 1)
+	assert.Equal(t, ErrReplicationPositionLost, err)
+}
+
+func TestDB_ReplicationLog_Merge(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-replication-merge-primary")
+	opts.DirPath = dir
+	opts.DataFileSize = 4 * 1024
+	primary, err := Open(opts)
+	assert.Nil(t, err)
+
+	followerOpts := opts
+	followerDir, _ := os.MkdirTemp("", "bitcask-go-replication-merge-follower")
+	followerOpts.DirPath = followerDir
+	followerOpts.ReadOnly = true
+	follower, err := Open(followerOpts)
+	defer destroyDB(follower)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, primary.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, primary.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	copyReplicationLog(t, primary, follower, 1000)
+
+	// merge 之后重启，被 merge 的数据文件被重写，epoch 加一
+	epoch, _, _ := primary.ReplicationPosition()
+	assert.Nil(t, primary.Merge())
+	assert.Nil(t, primary.Close())
+	primary, err = Open(opts)
+	defer destroyDB(primary)
+	assert.Nil(t, err)
+	newEpoch, _, _ := primary.ReplicationPosition()
+	assert.Equal(t, epoch+1, newEpoch)
+
+	// 已经复制过数据的 follower 无法继续复制
+	fEpoch, fFid, fOffset := follower.ReplicationPosition()
+	_, _, _, err = primary.ReadReplicationLog(fEpoch, fFid, fOffset, 1024)
+	assert.Equal(t, ErrReplicationPositionLost, err)
+	assert.Equal(t, ErrReplicationPositionLost, follower.ApplyReplicationLog(newEpoch, fFid, fOffset, []byte("x")))
+
+	// 新的 follower 从头开始复制，使用 primary 的 epoch，重启之后仍然保留
+	newFollowerOpts := followerOpts
+	newFollowerDir, _ := os.MkdirTemp("", "bitcask-go-replication-merge-new-follower")
+	newFollowerOpts.DirPath = newFollowerDir
+	newFollower, err := Open(newFollowerOpts)
+	assert.Nil(t, err)
+	copyReplicationLog(t, primary, newFollower, 1000)
+	assert.Equal(t, 100, len(newFollower.ListKeys()))
+	assert.Nil(t, newFollower.Close())
+	newFollower, err = Open(newFollowerOpts)
+	defer destroyDB(newFollower)
+	assert.Nil(t, err)
+	epoch, _, _ = newFollower.ReplicationPosition()
+	assert.Equal(t, newEpoch, epoch)
+}
+
+func TestDB_WaitReplicationLog(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-replication-wait")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put(utils.GetTestKey(0), utils.RandomValue(10)))
+
+	// 没有新的数据时等待到超时
+	epoch, fid, offset := db.ReplicationPosition()
+	start := time.Now()
+	assert.True(t, db.WaitReplicationLog(fid, offset, 50*time.Millisecond))
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	// 写入新的数据之后立即返回
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = db.Put(utils.GetTestKey(1), utils.RandomValue(10))
+	}()
+	start = time.Now()
+	assert.True(t, db.WaitReplicationLog(fid, offset, 5*time.Second))
+	assert.True(t, time.Since(start) < 5*time.Second)
+
+	_, _, chunk, err := db.ReadReplicationLog(epoch, fid, offset, 1024)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, chunk)
+
+	// 数据库关闭之后返回 false
+	_, fid, offset = db.ReplicationPosition()
+	assert.Nil(t, db.Close())
+	assert.False(t, db.WaitReplicationLog(fid, offset, time.Second))
+}
+
+// 只复制已经持久化的数据
+func TestDB_ReadReplicationLog_Synced(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-replication-synced")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(10)))
+	}
+	assert.True(t, db.activeFile.SyncedOff() < db.activeFile.WriteOff)
+
+	// 读取之前先持久化活跃文件中的数据
+	epoch, _, _ := db.ReplicationPosition()
+	_, _, chunk, err := db.ReadReplicationLog(epoch, 0, 0, 1024*1024)
+	assert.Nil(t, err)
+	assert.Equal(t, db.activeFile.WriteOff, int64(len(chunk)))
+	assert.Equal(t, db.activeFile.WriteOff, db.activeFile.SyncedOff())
+}
+
+// primary 启动时截断了损坏的数据之后 epoch 加一，follower 需要重新复制
+func TestDB_ReplicationLog_Recovery(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-replication-recovery")
+	opts.DirPath = dir
+	opts.RecoveryPolicy = RecoveryTruncateTail
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(10)))
+	}
+	epoch, fid, offset := db.ReplicationPosition()
+	assert.Nil(t, db.Close())
+
+	// 正常重启之后 epoch 不变
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	newEpoch, _, _ := db.ReplicationPosition()
+	assert.Equal(t, epoch, newEpoch)
+	assert.Nil(t, db.Close())
+
+	appendToFile(t, data.GetDataFileName(dir, fid), []byte("partial"))
+	db, err = Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), db.RecoveryReport().TruncatedFiles)
+	newEpoch, _, _ = db.ReplicationPosition()
+	assert.Equal(t, epoch+1, newEpoch)
+	_, _, _, err = db.ReadReplicationLog(epoch, fid, offset, 1024)
+	assert.Equal(t, ErrReplicationPositionLost, err)
+}
@@ -0,0 +1,121 @@
+package structure
+
+import kv "KV-go"
+
+// HSet 设置 Hash 中字段的值，返回字段是否是新增的
+func (ds *DataStructure) HSet(key, field, value []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, kv.ErrKeyIsEmpty
+	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	meta, err := ds.getMetadata(key, Hash)
+	if err != nil {
+		return false, err
+	}
+	subKey := encodeSubKey(key, meta.version, field)
+	exist, err := ds.exists(subKey)
+	if err != nil {
+		return false, err
+	}
+
+	wb := ds.newWriteBatch()
+	if !exist {
+		meta.size++
+		if err := ds.putMetadata(wb, key, meta); err != nil {
+			return false, err
+		}
+	}
+	if err := wb.Put(subKey, value); err != nil {
+		return false, err
+	}
+	return !exist, wb.Commit()
+}
+
+// HGet 获取 Hash 中字段的值，key 或者字段不存在时返回 ErrKeyNotFound
+func (ds *DataStructure) HGet(key, field []byte) ([]byte, error) {
+	meta, err := ds.getMetadata(key, Hash)
+	if err != nil {
+		return nil, err
+	}
+	if meta.size == 0 {
+		return nil, kv.ErrKeyNotFound
+	}
+	return ds.db.Get(encodeSubKey(key, meta.version, field))
+}
+
+// HDel 删除 Hash 中的字段，返回实际删除的字段数量
+func (ds *DataStructure) HDel(key []byte, fields ...[]byte) (int, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	meta, err := ds.getMetadata(key, Hash)
+	if err != nil || meta.size == 0 {
+		return 0, err
+	}
+
+	wb := ds.newWriteBatch()
+	deleted := make(map[string]struct{})
+	for _, field := range fields {
+		if _, ok := deleted[string(field)]; ok {
+			continue
+		}
+		subKey := encodeSubKey(key, meta.version, field)
+		exist, err := ds.exists(subKey)
+		if err != nil {
+			return 0, err
+		}
+		if !exist {
+			continue
+		}
+		if err := wb.Delete(subKey); err != nil {
+			return 0, err
+		}
+		deleted[string(field)] = struct{}{}
+	}
+	if len(deleted) == 0 {
+		return 0, nil
+	}
+	meta.size -= uint32(len(deleted))
+	if err := ds.putMetadata(wb, key, meta); err != nil {
+		return 0, err
+	}
+	return len(deleted), wb.Commit()
+}
+
+// HLen 获取 Hash 中字段的数量
+func (ds *DataStructure) HLen(key []byte) (uint32, error) {
+	meta, err := ds.getMetadata(key, Hash)
+	if err != nil {
+		return 0, err
+	}
+	return meta.size, nil
+}
+
+// HGetAll 获取 Hash 中所有的字段和值
+func (ds *DataStructure) HGetAll(key []byte) (map[string][]byte, error) {
+	meta, err := ds.getMetadata(key, Hash)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]byte, meta.size)
+	if meta.size == 0 {
+		return result, nil
+	}
+	prefix := subKeyPrefix(key, meta.version)
+	err = ds.scanSubKeys(prefix, func(subKey, value []byte) bool {
+		result[string(subKey[len(prefix):])] = value
+		return true
+	})
+	return result, err
+}
+
+// 子 key 是否存在
+func (ds *DataStructure) exists(subKey []byte) (bool, error) {
+	_, err := ds.db.Get(subKey)
+	if err == kv.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
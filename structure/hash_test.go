@@ -0,0 +1,60 @@
+package structure
+
+import (
+	kv "KV-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDataStructure_Hash(t *testing.T) {
+	ds, _, cleanup := newTestDataStructure(t)
+	defer cleanup()
+	key := []byte("user:1")
+
+	_, err := ds.HGet(key, []byte("name"))
+	assert.Equal(t, kv.ErrKeyNotFound, err)
+
+	added, err := ds.HSet(key, []byte("name"), []byte("bitcask"))
+	assert.Nil(t, err)
+	assert.True(t, added)
+	added, err = ds.HSet(key, []byte("age"), []byte("10"))
+	assert.Nil(t, err)
+	assert.True(t, added)
+	added, err = ds.HSet(key, []byte("name"), []byte("kv"))
+	assert.Nil(t, err)
+	assert.False(t, added)
+
+	value, err := ds.HGet(key, []byte("name"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("kv"), value)
+	_, err = ds.HGet(key, []byte("missing"))
+	assert.Equal(t, kv.ErrKeyNotFound, err)
+
+	size, err := ds.HLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), size)
+	all, err := ds.HGetAll(key)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]byte{"name": []byte("kv"), "age": []byte("10")}, all)
+
+	_, err = ds.HSet([]byte("user:10"), []byte("name"), []byte("other"))
+	assert.Nil(t, err)
+
+	deleted, err := ds.HDel(key, []byte("name"), []byte("name"), []byte("missing"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted)
+	size, err = ds.HLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), size)
+
+	// 删除所有字段之后 key 不存在
+	deleted, err = ds.HDel(key, []byte("age"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted)
+	_, err = ds.Type(key)
+	assert.Equal(t, kv.ErrKeyNotFound, err)
+
+	all, err = ds.HGetAll([]byte("user:10"))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]byte{"name": []byte("other")}, all)
+}
@@ -0,0 +1,147 @@
+package structure
+
+import kv "KV-go"
+
+// LPush 从 List 的头部插入元素，返回插入之后 List 的长度
+func (ds *DataStructure) LPush(key []byte, elements ...[]byte) (uint32, error) {
+	return ds.push(key, elements, true)
+}
+
+// RPush 从 List 的尾部插入元素，返回插入之后 List 的长度
+func (ds *DataStructure) RPush(key []byte, elements ...[]byte) (uint32, error) {
+	return ds.push(key, elements, false)
+}
+
+// LPop 弹出 List 头部的元素，List 为空时返回 ErrKeyNotFound
+func (ds *DataStructure) LPop(key []byte) ([]byte, error) {
+	return ds.pop(key, true)
+}
+
+// RPop 弹出 List 尾部的元素，List 为空时返回 ErrKeyNotFound
+func (ds *DataStructure) RPop(key []byte) ([]byte, error) {
+	return ds.pop(key, false)
+}
+
+// LLen 获取 List 的长度
+func (ds *DataStructure) LLen(key []byte) (uint32, error) {
+	meta, err := ds.getMetadata(key, List)
+	if err != nil {
+		return 0, err
+	}
+	return meta.size, nil
+}
+
+// LRange 获取 List 中 [start, stop] 范围内的元素，负数表示从尾部开始计算的位置，-1 为最后一个元素
+func (ds *DataStructure) LRange(key []byte, start, stop int) ([][]byte, error) {
+	meta, err := ds.getMetadata(key, List)
+	if err != nil {
+		return nil, err
+	}
+	start, stop, ok := normalizeRange(start, stop, int(meta.size))
+	if !ok {
+		return [][]byte{}, nil
+	}
+
+	elements := make([][]byte, 0, stop-start+1)
+	for i := start; i <= stop; i++ {
+		element, err := ds.db.Get(encodeSubKey(key, meta.version, encodeUint64(meta.head+uint64(i))))
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+func (ds *DataStructure) push(key []byte, elements [][]byte, isLeft bool) (uint32, error) {
+	if len(key) == 0 {
+		return 0, kv.ErrKeyIsEmpty
+	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	meta, err := ds.getMetadata(key, List)
+	if err != nil {
+		return 0, err
+	}
+	if len(elements) == 0 {
+		return meta.size, nil
+	}
+
+	wb := ds.newWriteBatch()
+	for _, element := range elements {
+		var index uint64
+		if isLeft {
+			meta.head--
+			index = meta.head
+		} else {
+			index = meta.tail
+			meta.tail++
+		}
+		if err := wb.Put(encodeSubKey(key, meta.version, encodeUint64(index)), element); err != nil {
+			return 0, err
+		}
+	}
+	meta.size += uint32(len(elements))
+	if err := ds.putMetadata(wb, key, meta); err != nil {
+		return 0, err
+	}
+	return meta.size, wb.Commit()
+}
+
+func (ds *DataStructure) pop(key []byte, isLeft bool) ([]byte, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	meta, err := ds.getMetadata(key, List)
+	if err != nil {
+		return nil, err
+	}
+	if meta.size == 0 {
+		return nil, kv.ErrKeyNotFound
+	}
+
+	var index uint64
+	if isLeft {
+		index = meta.head
+		meta.head++
+	} else {
+		meta.tail--
+		index = meta.tail
+	}
+	subKey := encodeSubKey(key, meta.version, encodeUint64(index))
+	element, err := ds.db.Get(subKey)
+	if err != nil {
+		return nil, err
+	}
+
+	wb := ds.newWriteBatch()
+	if err := wb.Delete(subKey); err != nil {
+		return nil, err
+	}
+	meta.size--
+	if err := ds.putMetadata(wb, key, meta); err != nil {
+		return nil, err
+	}
+	return element, wb.Commit()
+}
+
+// normalizeRange 将 [start, stop] 转换为 [0, size) 中的位置，范围为空时返回 false
+func normalizeRange(start, stop, size int) (int, int, bool) {
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop || start >= size {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
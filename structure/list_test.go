@@ -0,0 +1,56 @@
+package structure
+
+import (
+	kv "KV-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDataStructure_List(t *testing.T) {
+	ds, _, cleanup := newTestDataStructure(t)
+	defer cleanup()
+	key := []byte("queue")
+
+	_, err := ds.RPop(key)
+	assert.Equal(t, kv.ErrKeyNotFound, err)
+
+	size, err := ds.LPush(key, []byte("b"), []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), size)
+	size, err = ds.RPush(key, []byte("c"), []byte("d"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(4), size)
+
+	elements, err := ds.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")}, elements)
+	elements, err = ds.LRange(key, -3, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("b")}, elements)
+	elements, err = ds.LRange(key, 2, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("c"), []byte("d")}, elements)
+	elements, err = ds.LRange(key, 3, 1)
+	assert.Nil(t, err)
+	assert.Empty(t, elements)
+
+	element, err := ds.RPop(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("d"), element)
+	element, err = ds.LPop(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), element)
+	size, err = ds.LLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), size)
+
+	for _, expected := range []string{"c", "b"} {
+		element, err = ds.RPop(key)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(expected), element)
+	}
+	_, err = ds.LPop(key)
+	assert.Equal(t, kv.ErrKeyNotFound, err)
+	_, err = ds.Type(key)
+	assert.Equal(t, kv.ErrKeyNotFound, err)
+}
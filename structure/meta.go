@@ -0,0 +1,138 @@
+package structure
+
+import (
+	"encoding/binary"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 元数据 key 的前缀，子 key 以 key 长度的 varint 开头，不会是 0，两者不会冲突
+	metaKeyPrefix byte = 0
+
+	// List 的初始位置，从中间开始方便向两端扩展
+	initialListMark = math.MaxUint64 / 2
+)
+
+// metadata 数据结构的元数据
+type metadata struct {
+	dataType DataType
+	version  uint64 // 创建时分配的版本号，编码在子 key 中，删除之后重新创建的数据结构看不到旧的子 key
+	size     uint32 // 元素的数量
+	head     uint64 // List 第一个元素的位置
+	tail     uint64 // List 最后一个元素的下一个位置
+}
+
+// 上一次分配的版本号
+var lastVersion uint64
+
+// 分配一个新的版本号，使用当前的纳秒时间戳，并保证严格递增
+func newVersion() uint64 {
+	for {
+		last := atomic.LoadUint64(&lastVersion)
+		version := uint64(time.Now().UnixNano())
+		if version <= last {
+			version = last + 1
+		}
+		if atomic.CompareAndSwapUint64(&lastVersion, last, version) {
+			return version
+		}
+	}
+}
+
+func newMetadata(dataType DataType) *metadata {
+	meta := &metadata{dataType: dataType, version: newVersion()}
+	if dataType == List {
+		meta.head = initialListMark
+		meta.tail = initialListMark
+	}
+	return meta
+}
+
+// encode 编码元数据
+//
+//	+----------+----------------+-------------+-----------------------+
+//	| type 1B  | version varint | size varint | head, tail (List)     |
+//	+----------+----------------+-------------+-----------------------+
+func (meta *metadata) encode() []byte {
+	buf := make([]byte, 1+binary.MaxVarintLen32+3*binary.MaxVarintLen64)
+	buf[0] = meta.dataType
+	index := 1
+	index += binary.PutUvarint(buf[index:], meta.version)
+	index += binary.PutUvarint(buf[index:], uint64(meta.size))
+	if meta.dataType == List {
+		index += binary.PutUvarint(buf[index:], meta.head)
+		index += binary.PutUvarint(buf[index:], meta.tail)
+	}
+	return buf[:index]
+}
+
+func decodeMetadata(buf []byte) *metadata {
+	meta := &metadata{dataType: buf[0]}
+	index := 1
+	version, n := binary.Uvarint(buf[index:])
+	meta.version = version
+	index += n
+	size, n := binary.Uvarint(buf[index:])
+	meta.size = uint32(size)
+	index += n
+	if meta.dataType == List {
+		meta.head, n = binary.Uvarint(buf[index:])
+		index += n
+		meta.tail, _ = binary.Uvarint(buf[index:])
+	}
+	return meta
+}
+
+func encodeMetaKey(key []byte) []byte {
+	buf := make([]byte, 1+len(key))
+	buf[0] = metaKeyPrefix
+	copy(buf[1:], key)
+	return buf
+}
+
+// subKeyPrefix key 当前版本所有子 key 的公共前缀：key 的长度 + key + 版本号
+func subKeyPrefix(key []byte, version uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen32+len(key)+8)
+	n := binary.PutUvarint(buf, uint64(len(key)))
+	copy(buf[n:], key)
+	binary.BigEndian.PutUint64(buf[n+len(key):], version)
+	return buf[:n+len(key)+8]
+}
+
+// encodeSubKey 编码子 key：前缀 + 各个部分依次拼接
+func encodeSubKey(key []byte, version uint64, parts ...[]byte) []byte {
+	buf := subKeyPrefix(key, version)
+	for _, part := range parts {
+		buf = append(buf, part...)
+	}
+	return buf
+}
+
+func encodeUint64(v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	return buf
+}
+
+// encodeScore 将分数编码为 8 个字节，编码后的字节序和分数的大小顺序一致
+func encodeScore(score float64) []byte {
+	bits := math.Float64bits(score)
+	if bits&(1<<63) == 0 {
+		bits |= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return encodeUint64(bits)
+}
+
+func decodeScore(buf []byte) float64 {
+	bits := binary.BigEndian.Uint64(buf)
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
+}
@@ -0,0 +1,46 @@
+package structure
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"sort"
+	"testing"
+)
+
+func TestMetadata_Encode(t *testing.T) {
+	meta := &metadata{dataType: List, version: newVersion(), size: 3, head: initialListMark - 1, tail: initialListMark + 2}
+	assert.Equal(t, meta, decodeMetadata(meta.encode()))
+
+	meta = &metadata{dataType: Hash, version: newVersion(), size: 100}
+	assert.Equal(t, meta, decodeMetadata(meta.encode()))
+}
+
+func TestNewVersion(t *testing.T) {
+	last := newVersion()
+	for i := 0; i < 1000; i++ {
+		version := newVersion()
+		assert.True(t, version > last)
+		last = version
+	}
+}
+
+func TestEncodeScore(t *testing.T) {
+	scores := []float64{math.Inf(-1), -1e10, -2.5, -1, -0.001, 0, 0.001, 1, 2.5, 1e10, math.Inf(1)}
+	encoded := make([][]byte, len(scores))
+	for i, score := range scores {
+		encoded[i] = encodeScore(score)
+		assert.Equal(t, score, decodeScore(encoded[i]))
+	}
+	assert.True(t, sort.SliceIsSorted(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	}))
+}
+
+func TestSubKeyPrefix(t *testing.T) {
+	// 一个 key 的子 key 不会是另一个 key 子 key 的前缀
+	assert.False(t, bytes.HasPrefix(encodeSubKey([]byte("ab"), 1, []byte("c")), subKeyPrefix([]byte("a"), 1)))
+	assert.NotEqual(t, metaKeyPrefix, subKeyPrefix([]byte("a"), 1)[0])
+	// 不同版本的子 key 互不影响
+	assert.False(t, bytes.HasPrefix(encodeSubKey([]byte("a"), 1, []byte("c")), subKeyPrefix([]byte("a"), 2)))
+}
@@ -0,0 +1,117 @@
+package structure
+
+import kv "KV-go"
+
+// SAdd 向 Set 中添加元素，返回实际新增的元素数量
+func (ds *DataStructure) SAdd(key []byte, members ...[]byte) (int, error) {
+	if len(key) == 0 {
+		return 0, kv.ErrKeyIsEmpty
+	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	meta, err := ds.getMetadata(key, Set)
+	if err != nil {
+		return 0, err
+	}
+
+	wb := ds.newWriteBatch()
+	added := make(map[string]struct{})
+	for _, member := range members {
+		if _, ok := added[string(member)]; ok {
+			continue
+		}
+		subKey := encodeSubKey(key, meta.version, member)
+		exist, err := ds.exists(subKey)
+		if err != nil {
+			return 0, err
+		}
+		if exist {
+			continue
+		}
+		if err := wb.Put(subKey, nil); err != nil {
+			return 0, err
+		}
+		added[string(member)] = struct{}{}
+	}
+	if len(added) == 0 {
+		return 0, nil
+	}
+	meta.size += uint32(len(added))
+	if err := ds.putMetadata(wb, key, meta); err != nil {
+		return 0, err
+	}
+	return len(added), wb.Commit()
+}
+
+// SIsMember 判断元素是否在 Set 中
+func (ds *DataStructure) SIsMember(key, member []byte) (bool, error) {
+	meta, err := ds.getMetadata(key, Set)
+	if err != nil || meta.size == 0 {
+		return false, err
+	}
+	return ds.exists(encodeSubKey(key, meta.version, member))
+}
+
+// SRem 从 Set 中删除元素，返回实际删除的元素数量
+func (ds *DataStructure) SRem(key []byte, members ...[]byte) (int, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	meta, err := ds.getMetadata(key, Set)
+	if err != nil || meta.size == 0 {
+		return 0, err
+	}
+
+	wb := ds.newWriteBatch()
+	removed := make(map[string]struct{})
+	for _, member := range members {
+		if _, ok := removed[string(member)]; ok {
+			continue
+		}
+		subKey := encodeSubKey(key, meta.version, member)
+		exist, err := ds.exists(subKey)
+		if err != nil {
+			return 0, err
+		}
+		if !exist {
+			continue
+		}
+		if err := wb.Delete(subKey); err != nil {
+			return 0, err
+		}
+		removed[string(member)] = struct{}{}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+	meta.size -= uint32(len(removed))
+	if err := ds.putMetadata(wb, key, meta); err != nil {
+		return 0, err
+	}
+	return len(removed), wb.Commit()
+}
+
+// SCard 获取 Set 中元素的数量
+func (ds *DataStructure) SCard(key []byte) (uint32, error) {
+	meta, err := ds.getMetadata(key, Set)
+	if err != nil {
+		return 0, err
+	}
+	return meta.size, nil
+}
+
+// SMembers 获取 Set 中所有的元素，按照字节序排列
+func (ds *DataStructure) SMembers(key []byte) ([][]byte, error) {
+	meta, err := ds.getMetadata(key, Set)
+	if err != nil || meta.size == 0 {
+		return nil, err
+	}
+	prefix := subKeyPrefix(key, meta.version)
+	members := make([][]byte, 0, meta.size)
+	err = ds.scanSubKeys(prefix, func(subKey, _ []byte) bool {
+		members = append(members, subKey[len(prefix):])
+		return true
+	})
+	return members, err
+}
@@ -0,0 +1,47 @@
+package structure
+
+import (
+	kv "KV-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDataStructure_Set(t *testing.T) {
+	ds, _, cleanup := newTestDataStructure(t)
+	defer cleanup()
+	key := []byte("tags")
+
+	ok, err := ds.SIsMember(key, []byte("go"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	added, err := ds.SAdd(key, []byte("go"), []byte("kv"), []byte("go"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, added)
+	added, err = ds.SAdd(key, []byte("kv"), []byte("db"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, added)
+
+	ok, err = ds.SIsMember(key, []byte("go"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	size, err := ds.SCard(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), size)
+	members, err := ds.SMembers(key)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("db"), []byte("go"), []byte("kv")}, members)
+
+	removed, err := ds.SRem(key, []byte("go"), []byte("missing"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+	ok, err = ds.SIsMember(key, []byte("go"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	removed, err = ds.SRem(key, []byte("kv"), []byte("db"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, removed)
+	_, err = ds.Type(key)
+	assert.Equal(t, kv.ErrKeyNotFound, err)
+}
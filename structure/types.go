@@ -0,0 +1,171 @@
+// Package structure 在 DB 之上实现 Hash、Set、List 和 ZSet 数据结构
+//
+// 每个数据结构由一条元数据记录和若干条子 key 记录组成，修改某个字段时只需要写入对应的子 key，
+// 同时修改多个子 key 的操作通过 WriteBatch 原子地提交
+// 子 key 中带有元数据的版本号，删除数据结构时先删除元数据，旧版本的子 key 不会再被读到，随后再分批清理
+package structure
+
+import (
+	kv "KV-go"
+	"bytes"
+	"errors"
+	"sync"
+)
+
+var (
+	ErrWrongTypeOperation = errors.New("WRONGTYPE operation against a key holding the wrong kind of value")
+	ErrScoreIsNaN         = errors.New("the score is not a number")
+)
+
+// 删除数据结构时每个批次清理的子 key 数量
+const deleteBatchSize = 1024
+
+type DataType = byte
+
+const (
+	Hash DataType = iota + 1
+	Set
+	List
+	ZSet
+)
+
+// DataStructure 数据结构服务
+// 同一个 DB 只应该创建一个 DataStructure，写操作之间的读改写由它来保证串行化
+type DataStructure struct {
+	db      *kv.DB
+	options kv.WriteBatchOptions
+	mu      sync.Mutex
+}
+
+// New 创建数据结构服务，options 为每次写操作提交时使用的批量写入配置
+func New(db *kv.DB, options kv.WriteBatchOptions) *DataStructure {
+	return &DataStructure{db: db, options: options}
+}
+
+// Type 获取 key 对应的数据结构类型
+func (ds *DataStructure) Type(key []byte) (DataType, error) {
+	meta, err := ds.findMetadata(key)
+	if err != nil {
+		return 0, err
+	}
+	if meta == nil {
+		return 0, kv.ErrKeyNotFound
+	}
+	return meta.dataType, nil
+}
+
+// Del 删除 key 对应的数据结构
+// 先删除元数据，之后旧版本的子 key 不会再被访问到，再分批删除这些子 key 回收空间
+// 清理子 key 的过程中失败或者崩溃时，没有删除的子 key 会一直留在数据文件中
+func (ds *DataStructure) Del(key []byte) error {
+	if len(key) == 0 {
+		return kv.ErrKeyIsEmpty
+	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	meta, err := ds.findMetadata(key)
+	if err != nil || meta == nil {
+		return err
+	}
+	wb := ds.newWriteBatch()
+	if err := wb.Delete(encodeMetaKey(key)); err != nil {
+		return err
+	}
+	if err := wb.Commit(); err != nil {
+		return err
+	}
+	return ds.deleteSubKeys(subKeyPrefix(key, meta.version))
+}
+
+// 分批删除指定前缀的子 key，避免元素很多时一个批次过大
+// 前缀中带有版本号，元数据删除之后不会再有写入，清理时不需要排除新写入的子 key
+func (ds *DataStructure) deleteSubKeys(prefix []byte) error {
+	batchSize := deleteBatchSize
+	if ds.options.MaxBatchNum < uint(batchSize) {
+		batchSize = int(ds.options.MaxBatchNum)
+	}
+	iteratorOptions := kv.DefaultIteratorOptions
+	iteratorOptions.Prefix = prefix
+	for {
+		// 只需要 key，不读取 value
+		var subKeys [][]byte
+		it := ds.db.NewIterator(iteratorOptions)
+		for it.Rewind(); it.Valid() && len(subKeys) < batchSize; it.Next() {
+			subKeys = append(subKeys, it.Key())
+		}
+		it.Close()
+		if len(subKeys) == 0 {
+			return nil
+		}
+
+		wb := ds.newWriteBatch()
+		for _, subKey := range subKeys {
+			if err := wb.Delete(subKey); err != nil {
+				return err
+			}
+		}
+		if err := wb.Commit(); err != nil {
+			return err
+		}
+		if len(subKeys) < batchSize {
+			return nil
+		}
+	}
+}
+
+// 查找 key 的元数据，不存在时返回 nil
+func (ds *DataStructure) findMetadata(key []byte) (*metadata, error) {
+	buf, err := ds.db.Get(encodeMetaKey(key))
+	if err == kv.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeMetadata(buf), nil
+}
+
+// 获取指定类型的元数据，不存在时返回一个新的空元数据
+func (ds *DataStructure) getMetadata(key []byte, dataType DataType) (*metadata, error) {
+	meta, err := ds.findMetadata(key)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return newMetadata(dataType), nil
+	}
+	if meta.dataType != dataType {
+		return nil, ErrWrongTypeOperation
+	}
+	return meta, nil
+}
+
+// 在批次中写入新的元数据，数据结构为空时删除元数据
+func (ds *DataStructure) putMetadata(wb *kv.WriteBatch, key []byte, meta *metadata) error {
+	if meta.size == 0 {
+		return wb.Delete(encodeMetaKey(key))
+	}
+	return wb.Put(encodeMetaKey(key), meta.encode())
+}
+
+func (ds *DataStructure) newWriteBatch() *kv.WriteBatch {
+	return ds.db.NewWriteBatch(ds.options)
+}
+
+// 按照顺序遍历指定前缀的子 key，fn 返回 false 时停止遍历
+func (ds *DataStructure) scanSubKeys(prefix []byte, fn func(subKey, value []byte) bool) error {
+	it := ds.db.NewIterator(kv.DefaultIteratorOptions)
+	defer it.Close()
+
+	for it.Seek(prefix); it.Valid() && bytes.HasPrefix(it.Key(), prefix); it.Next() {
+		value, err := it.Value()
+		if err != nil {
+			return err
+		}
+		if !fn(it.Key(), value) {
+			break
+		}
+	}
+	return nil
+}
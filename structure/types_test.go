@@ -0,0 +1,128 @@
+package structure
+
+import (
+	kv "KV-go"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func newTestDataStructure(t *testing.T) (*DataStructure, *kv.DB, func()) {
+	opts := kv.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-structure")
+	opts.DirPath = dir
+	db, err := kv.Open(opts)
+	assert.Nil(t, err)
+
+	options := kv.DefaultWriteBatchOptions
+	options.SyncWrites = false
+	return New(db, options), db, func() {
+		_ = db.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestDataStructure_TypeAndDel(t *testing.T) {
+	ds, db, cleanup := newTestDataStructure(t)
+	defer cleanup()
+
+	_, err := ds.Type([]byte("h"))
+	assert.Equal(t, kv.ErrKeyNotFound, err)
+
+	_, err = ds.HSet([]byte("h"), []byte("f1"), []byte("v1"))
+	assert.Nil(t, err)
+	_, err = ds.SAdd([]byte("s"), []byte("m1"))
+	assert.Nil(t, err)
+	dataType, err := ds.Type([]byte("h"))
+	assert.Nil(t, err)
+	assert.Equal(t, Hash, dataType)
+
+	// 不同类型之间的操作
+	_, err = ds.SAdd([]byte("h"), []byte("m1"))
+	assert.Equal(t, ErrWrongTypeOperation, err)
+	_, err = ds.HGet([]byte("s"), []byte("f1"))
+	assert.Equal(t, ErrWrongTypeOperation, err)
+	_, err = ds.LPush([]byte("h"), []byte("e"))
+	assert.Equal(t, ErrWrongTypeOperation, err)
+	_, err = ds.ZAdd([]byte("s"), 1, []byte("m"))
+	assert.Equal(t, ErrWrongTypeOperation, err)
+
+	// 删除之后旧的子 key 不会再被读到
+	assert.Nil(t, ds.Del([]byte("h")))
+	_, err = ds.Type([]byte("h"))
+	assert.Equal(t, kv.ErrKeyNotFound, err)
+	assert.Nil(t, ds.Del([]byte("missing")))
+	_, err = db.Get(encodeMetaKey([]byte("h")))
+	assert.Equal(t, kv.ErrKeyNotFound, err)
+	_, err = ds.HSet([]byte("h"), []byte("f2"), []byte("v2"))
+	assert.Nil(t, err)
+	_, err = ds.HGet([]byte("h"), []byte("f1"))
+	assert.Equal(t, kv.ErrKeyNotFound, err)
+	all, err := ds.HGetAll([]byte("h"))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]byte{"f2": []byte("v2")}, all)
+	assert.Nil(t, ds.Del([]byte("h")))
+
+	// 删除之后可以作为其他类型使用
+	_, err = ds.RPush([]byte("h"), []byte("e"))
+	assert.Nil(t, err)
+	dataType, err = ds.Type([]byte("h"))
+	assert.Nil(t, err)
+	assert.Equal(t, List, dataType)
+}
+
+func TestDataStructure_Del_SubKeys(t *testing.T) {
+	ds, db, cleanup := newTestDataStructure(t)
+	defer cleanup()
+	// 子 key 的数量超过一个批次能删除的数量
+	ds.options.MaxBatchNum = 10
+
+	for i := 0; i < 25; i++ {
+		_, err := ds.HSet([]byte("h"), []byte(fmt.Sprintf("f%d", i)), []byte("v"))
+		assert.Nil(t, err)
+	}
+	_, err := ds.ZAdd([]byte("z"), 1, []byte("m"))
+	assert.Nil(t, err)
+	assert.Equal(t, 29, len(db.ListKeys()))
+
+	// 删除之后旧版本的子 key 也被清理，其他 key 不受影响
+	assert.Nil(t, ds.Del([]byte("h")))
+	assert.Equal(t, 3, len(db.ListKeys()))
+	score, err := ds.ZScore([]byte("z"), []byte("m"))
+	assert.Nil(t, err)
+	assert.Equal(t, float64(1), score)
+}
+
+func TestDataStructure_Reopen(t *testing.T) {
+	opts := kv.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-structure-reopen")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	db, err := kv.Open(opts)
+	assert.Nil(t, err)
+	ds := New(db, kv.DefaultWriteBatchOptions)
+
+	_, err = ds.HSet([]byte("h"), []byte("f1"), []byte("v1"))
+	assert.Nil(t, err)
+	_, err = ds.RPush([]byte("l"), []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	_, err = ds.ZAdd([]byte("z"), 1.5, []byte("m"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+
+	db, err = kv.Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	ds = New(db, kv.DefaultWriteBatchOptions)
+
+	value, err := ds.HGet([]byte("h"), []byte("f1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), value)
+	elements, err := ds.LRange([]byte("l"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b")}, elements)
+	score, err := ds.ZScore([]byte("z"), []byte("m"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, score)
+}
@@ -0,0 +1,160 @@
+package structure
+
+import (
+	kv "KV-go"
+	"math"
+)
+
+const (
+	zsetMemberTag byte = 'm' // 成员 -> 分数
+	zsetScoreTag  byte = 's' // 分数 + 成员，按照分数排序
+)
+
+// ZMember ZSet 中的成员和分数
+type ZMember struct {
+	Member []byte
+	Score  float64
+}
+
+// ZAdd 向 ZSet 中添加成员或者更新成员的分数，返回成员是否是新增的，分数不能是 NaN
+func (ds *DataStructure) ZAdd(key []byte, score float64, member []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, kv.ErrKeyIsEmpty
+	}
+	// NaN 没有大小顺序，编码之后会排在所有的分数之外
+	if math.IsNaN(score) {
+		return false, ErrScoreIsNaN
+	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	meta, err := ds.getMetadata(key, ZSet)
+	if err != nil {
+		return false, err
+	}
+	memberKey := encodeSubKey(key, meta.version, []byte{zsetMemberTag}, member)
+	oldScore, err := ds.db.Get(memberKey)
+	if err != nil && err != kv.ErrKeyNotFound {
+		return false, err
+	}
+	exist := err == nil
+	newScore := encodeScore(score)
+
+	wb := ds.newWriteBatch()
+	if exist {
+		if string(oldScore) == string(newScore) {
+			return false, nil
+		}
+		// 删除旧分数对应的排序记录
+		if err := wb.Delete(encodeSubKey(key, meta.version, []byte{zsetScoreTag}, oldScore, member)); err != nil {
+			return false, err
+		}
+	} else {
+		meta.size++
+		if err := ds.putMetadata(wb, key, meta); err != nil {
+			return false, err
+		}
+	}
+	if err := wb.Put(memberKey, newScore); err != nil {
+		return false, err
+	}
+	if err := wb.Put(encodeSubKey(key, meta.version, []byte{zsetScoreTag}, newScore, member), nil); err != nil {
+		return false, err
+	}
+	return !exist, wb.Commit()
+}
+
+// ZScore 获取 ZSet 中成员的分数，key 或者成员不存在时返回 ErrKeyNotFound
+func (ds *DataStructure) ZScore(key, member []byte) (float64, error) {
+	meta, err := ds.getMetadata(key, ZSet)
+	if err != nil {
+		return 0, err
+	}
+	if meta.size == 0 {
+		return 0, kv.ErrKeyNotFound
+	}
+	score, err := ds.db.Get(encodeSubKey(key, meta.version, []byte{zsetMemberTag}, member))
+	if err != nil {
+		return 0, err
+	}
+	return decodeScore(score), nil
+}
+
+// ZRem 从 ZSet 中删除成员，返回实际删除的成员数量
+func (ds *DataStructure) ZRem(key []byte, members ...[]byte) (int, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	meta, err := ds.getMetadata(key, ZSet)
+	if err != nil || meta.size == 0 {
+		return 0, err
+	}
+
+	wb := ds.newWriteBatch()
+	removed := make(map[string]struct{})
+	for _, member := range members {
+		if _, ok := removed[string(member)]; ok {
+			continue
+		}
+		memberKey := encodeSubKey(key, meta.version, []byte{zsetMemberTag}, member)
+		score, err := ds.db.Get(memberKey)
+		if err == kv.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err := wb.Delete(memberKey); err != nil {
+			return 0, err
+		}
+		if err := wb.Delete(encodeSubKey(key, meta.version, []byte{zsetScoreTag}, score, member)); err != nil {
+			return 0, err
+		}
+		removed[string(member)] = struct{}{}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+	meta.size -= uint32(len(removed))
+	if err := ds.putMetadata(wb, key, meta); err != nil {
+		return 0, err
+	}
+	return len(removed), wb.Commit()
+}
+
+// ZCard 获取 ZSet 中成员的数量
+func (ds *DataStructure) ZCard(key []byte) (uint32, error) {
+	meta, err := ds.getMetadata(key, ZSet)
+	if err != nil {
+		return 0, err
+	}
+	return meta.size, nil
+}
+
+// ZRange 按照分数从小到大获取排名在 [start, stop] 范围内的成员，分数相同时按照成员的字节序排列
+// 负数表示从尾部开始计算的排名，-1 为分数最大的成员
+func (ds *DataStructure) ZRange(key []byte, start, stop int) ([]ZMember, error) {
+	meta, err := ds.getMetadata(key, ZSet)
+	if err != nil {
+		return nil, err
+	}
+	start, stop, ok := normalizeRange(start, stop, int(meta.size))
+	if !ok {
+		return []ZMember{}, nil
+	}
+
+	prefix := encodeSubKey(key, meta.version, []byte{zsetScoreTag})
+	members := make([]ZMember, 0, stop-start+1)
+	rank := 0
+	err = ds.scanSubKeys(prefix, func(subKey, _ []byte) bool {
+		if rank >= start {
+			members = append(members, ZMember{
+				Member: subKey[len(prefix)+8:],
+				Score:  decodeScore(subKey[len(prefix) : len(prefix)+8]),
+			})
+		}
+		rank++
+		return rank <= stop
+	})
+	return members, err
+}
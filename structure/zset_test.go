@@ -0,0 +1,65 @@
+package structure
+
+import (
+	kv "KV-go"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestDataStructure_ZSet(t *testing.T) {
+	ds, _, cleanup := newTestDataStructure(t)
+	defer cleanup()
+	key := []byte("rank")
+
+	_, err := ds.ZScore(key, []byte("a"))
+	assert.Equal(t, kv.ErrKeyNotFound, err)
+
+	for _, m := range []ZMember{{[]byte("a"), 3}, {[]byte("b"), -1.5}, {[]byte("c"), 10}, {[]byte("d"), 3}} {
+		added, err := ds.ZAdd(key, m.Score, m.Member)
+		assert.Nil(t, err)
+		assert.True(t, added)
+	}
+	// NaN 不能作为分数
+	_, err = ds.ZAdd(key, math.NaN(), []byte("e"))
+	assert.Equal(t, ErrScoreIsNaN, err)
+
+	// 更新分数
+	added, err := ds.ZAdd(key, 0, []byte("c"))
+	assert.Nil(t, err)
+	assert.False(t, added)
+
+	score, err := ds.ZScore(key, []byte("c"))
+	assert.Nil(t, err)
+	assert.Equal(t, float64(0), score)
+	size, err := ds.ZCard(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(4), size)
+
+	members, err := ds.ZRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{
+		{[]byte("b"), -1.5}, {[]byte("c"), 0}, {[]byte("a"), 3}, {[]byte("d"), 3},
+	}, members)
+	members, err = ds.ZRange(key, 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{[]byte("c"), 0}, {[]byte("a"), 3}}, members)
+	members, err = ds.ZRange(key, -1, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{[]byte("d"), 3}}, members)
+
+	removed, err := ds.ZRem(key, []byte("a"), []byte("missing"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+	_, err = ds.ZScore(key, []byte("a"))
+	assert.Equal(t, kv.ErrKeyNotFound, err)
+	members, err = ds.ZRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(members))
+
+	removed, err = ds.ZRem(key, []byte("b"), []byte("c"), []byte("d"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, removed)
+	_, err = ds.Type(key)
+	assert.Equal(t, kv.ErrKeyNotFound, err)
+}
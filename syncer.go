@@ -0,0 +1,66 @@
+package kv_go
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 后台定期持久化活跃文件，每隔 SyncInterval 或者写入的数据量达到 BytesPerSync 时执行一次
+// 没有开启 SyncWrites 时，宕机最多丢失这两个阈值范围内的数据
+func (db *DB) syncPeriodically() {
+	defer db.bgWg.Done()
+
+	var tickCh <-chan time.Time
+	if db.option.SyncInterval > 0 {
+		ticker := time.NewTicker(db.option.SyncInterval)
+		defer ticker.Stop()
+		tickCh = ticker.C
+	}
+	for {
+		select {
+		case <-tickCh:
+		case <-db.syncCh:
+		case <-db.closeCh:
+			return
+		}
+		_ = db.syncActiveFile()
+	}
+}
+
+// 写入数据之后累计还没有持久化的数据量，达到 BytesPerSync 时通知后台任务持久化
+func (db *DB) addUnsyncedBytes(size int64) {
+	if db.syncCh == nil {
+		return
+	}
+	unsynced := atomic.AddInt64(&db.unsyncedBytes, size)
+	if db.option.BytesPerSync > 0 && unsynced >= db.option.BytesPerSync {
+		select {
+		case db.syncCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// 持久化活跃文件，持久化期间不阻塞写入
+func (db *DB) syncActiveFile() error {
+	if atomic.SwapInt64(&db.unsyncedBytes, 0) == 0 {
+		return nil
+	}
+	return db.syncActiveFileData()
+}
+
+// 持久化活跃文件中已经写入的数据，已经全部持久化时直接返回
+func (db *DB) syncActiveFileData() error {
+	db.mu.RLock()
+	activeFile := db.activeFile
+	var writeOff int64
+	if activeFile != nil {
+		writeOff = activeFile.WriteOff
+	}
+	db.mu.RUnlock()
+	if activeFile == nil || activeFile.SyncedOff() >= writeOff {
+		return nil
+	}
+	// 活跃文件在这期间被切换时，旧的文件在切换时已经持久化过，并且直到关闭数据库时才会被关闭
+	return activeFile.SyncUntil(writeOff)
+}
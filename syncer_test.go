@@ -0,0 +1,80 @@
+package kv_go
+
+import (
+	"KV-go/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDB_BytesPerSync(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-bytes-per-sync")
+	opts.DirPath = dir
+	opts.BytesPerSync = 4 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	// 没有达到阈值时不会持久化
+	assert.Nil(t, db.Put(utils.GetTestKey(0), utils.RandomValue(128)))
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, atomic.LoadInt64(&db.unsyncedBytes) > 0)
+
+	for i := 1; i < 100; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&db.unsyncedBytes) < opts.BytesPerSync
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestDB_SyncInterval(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-sync-interval")
+	opts.DirPath = dir
+	opts.SyncInterval = 20 * time.Millisecond
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.Put(utils.GetTestKey(0), utils.RandomValue(128)))
+	assert.True(t, atomic.LoadInt64(&db.unsyncedBytes) > 0)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&db.unsyncedBytes) == 0
+	}, time.Second, 5*time.Millisecond)
+
+	// 关闭之后后台任务退出，重启之后数据完整
+	assert.Nil(t, db.Put(utils.GetTestKey(1), utils.RandomValue(128)))
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(db.ListKeys()))
+}
+
+func TestDB_SyncOptions_Invalid(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-sync-options")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+
+	opts.BytesPerSync = -1
+	_, err := Open(opts)
+	assert.NotNil(t, err)
+
+	opts.BytesPerSync = 0
+	opts.SyncInterval = -time.Second
+	_, err = Open(opts)
+	assert.NotNil(t, err)
+
+	// 开启 SyncWrites 时不需要后台持久化
+	opts.SyncInterval = time.Second
+	opts.SyncWrites = true
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.syncCh)
+	assert.Nil(t, db.Close())
+}
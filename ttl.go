@@ -0,0 +1,78 @@
+package kv_go
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// NoExpiration 表示 key 没有设置过期时间
+const NoExpiration time.Duration = -1
+
+// PutWithTTL 写入带有过期时间的 Key/Value 数据，过期之后 key 被视为不存在
+func (db *DB) PutWithTTL(key []byte, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	return db.put(key, value, time.Now().Add(ttl).UnixNano())
+}
+
+// TTL 获取 key 剩余的存活时间，没有设置过期时间时返回 NoExpiration
+func (db *DB) TTL(key []byte) (time.Duration, error) {
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	pos := db.index.Get(key)
+	if pos == nil || pos.IsExpired() {
+		return 0, ErrKeyNotFound
+	}
+	if pos.Expire == 0 {
+		return NoExpiration, nil
+	}
+	return time.Duration(pos.Expire - time.Now().UnixNano()), nil
+}
+
+// 后台定期从索引中清理过期的 key
+func (db *DB) removeExpiredKeysPeriodically() {
+	defer db.bgWg.Done()
+
+	ticker := time.NewTicker(db.option.ExpireCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			db.removeExpiredKeys()
+		case <-db.closeCh:
+			return
+		}
+	}
+}
+
+// 从索引中删除已经过期的 key，过期的数据在 merge 时会被清理，重启时也不会被加载
+func (db *DB) removeExpiredKeys() {
+	var expiredKeys [][]byte
+	iterator := db.index.Iterator(false)
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		if iterator.Value().IsExpired() {
+			expiredKeys = append(expiredKeys, iterator.Key())
+		}
+	}
+	iterator.Close()
+	if len(expiredKeys) == 0 {
+		return
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, key := range expiredKeys {
+		// 加锁之后再检查一次，key 可能已经被重新写入
+		if pos := db.index.Get(key); pos == nil || !pos.IsExpired() {
+			continue
+		}
+		if oldPos, ok, _ := db.index.Delete(key); ok {
+			atomic.AddInt64(&db.reclaimSize, int64(oldPos.Size))
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package kv_go
+
+import (
+	"KV-go/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDB_PutWithTTL(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-ttl")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	err = db.PutWithTTL(utils.GetTestKey(1), utils.RandomValue(24), 0)
+	assert.Equal(t, ErrInvalidTTL, err)
+
+	err = db.PutWithTTL(utils.GetTestKey(1), utils.RandomValue(24), 100*time.Millisecond)
+	assert.Nil(t, err)
+	err = db.PutWithTTL(utils.GetTestKey(2), utils.RandomValue(24), time.Hour)
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(3), utils.RandomValue(24))
+	assert.Nil(t, err)
+
+	val, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.NotNil(t, val)
+	ttl, err := db.TTL(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 59*time.Minute && ttl <= time.Hour)
+	ttl, err = db.TTL(utils.GetTestKey(3))
+	assert.Nil(t, err)
+	assert.Equal(t, NoExpiration, ttl)
+
+	// 过期之后不可见
+	time.Sleep(150 * time.Millisecond)
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.TTL(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, 2, len(db.ListKeys()))
+	iter := db.NewIterator(DefaultIteratorOptions)
+	var count int
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		assert.NotEqual(t, utils.GetTestKey(1), iter.Key())
+		count++
+	}
+	iter.Close()
+	assert.Equal(t, 2, count)
+
+	// 重新写入之后不再过期
+	err = db.Put(utils.GetTestKey(1), utils.RandomValue(24))
+	assert.Nil(t, err)
+	val, err = db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.NotNil(t, val)
+}
+
+// 重启和 merge 之后过期的数据都不会被加载
+func TestDB_PutWithTTL_Restart(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-ttl-restart")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 50; i++ {
+		err := db.PutWithTTL(utils.GetTestKey(i), utils.RandomValue(24), 100*time.Millisecond)
+		assert.Nil(t, err)
+	}
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	for i := 100; i < 120; i++ {
+		err := wb.PutWithTTL(utils.GetTestKey(i), utils.RandomValue(24), 100*time.Millisecond)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, wb.Commit())
+	assert.Equal(t, 120, len(db.ListKeys()))
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, 50, len(db.ListKeys()))
+
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 50, len(db2.ListKeys()))
+	assert.Equal(t, 50, db2.index.Size())
+
+	err = db2.Merge()
+	assert.Nil(t, err)
+	err = db2.Close()
+	assert.Nil(t, err)
+	db3, err := Open(opts)
+	defer destroyDB(db3)
+	assert.Nil(t, err)
+	assert.Equal(t, 50, len(db3.ListKeys()))
+	for i := 0; i < 50; i++ {
+		_, err := db3.Get(utils.GetTestKey(i))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	for i := 50; i < 100; i++ {
+		val, err := db3.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.NotNil(t, val)
+	}
+}
+
+// 后台任务从索引中清理过期的 key
+func TestDB_RemoveExpiredKeys(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-ttl-sweep")
+	opts.DirPath = dir
+	opts.ExpireCheckInterval = 50 * time.Millisecond
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		err := db.PutWithTTL(utils.GetTestKey(i), utils.RandomValue(24), 50*time.Millisecond)
+		assert.Nil(t, err)
+	}
+	err = db.Put(utils.GetTestKey(100), utils.RandomValue(24))
+	assert.Nil(t, err)
+	assert.Equal(t, 101, db.index.Size())
+
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, 1, db.index.Size())
+	stat, err := db.Stat()
+	assert.Nil(t, err)
+	assert.Greater(t, stat.ReclaimableSize, int64(0))
+}
@@ -0,0 +1,409 @@
+package kv_go
+
+import (
+	"KV-go/data"
+	"bytes"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Txn 快照隔离的读写事务
+// 事务读取的是开始时的数据快照，以及事务中自己写入的数据；提交时如果读过或者写过的 key
+// 在事务开始之后被其他的写入修改过，则提交失败并返回 ErrTxnConflict，需要重试整个事务
+// Txn 不能在多个协程中并发使用，使用完之后需要调用 Commit 或者 Discard 释放快照
+type Txn struct {
+	db            *DB
+	readSeqNo     uint64                     // 快照的序列号
+	pendingWrites map[string]*data.LogRecord // 暂存事务中写入的数据
+	reads         map[string]struct{}        // 事务中读过的 key，用于冲突检测
+	finished      bool
+}
+
+// Begin 开始一个事务
+func (db *DB) Begin() *Txn {
+	// 和写入互斥，保证快照的序列号和索引的状态是一致的
+	db.mu.RLock()
+	readSeqNo := atomic.LoadUint64(&db.seqNo)
+	db.oracle.begin(readSeqNo)
+	db.mu.RUnlock()
+
+	return &Txn{
+		db:            db,
+		readSeqNo:     readSeqNo,
+		pendingWrites: make(map[string]*data.LogRecord),
+		reads:         make(map[string]struct{}),
+	}
+}
+
+// Get 读取事务快照中的数据
+func (txn *Txn) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	if txn.finished {
+		return nil, ErrTxnFinished
+	}
+	return txn.get(key)
+}
+
+// Put 在事务中写入数据，提交之后才对其他读取可见
+func (txn *Txn) Put(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if txn.finished {
+		return ErrTxnFinished
+	}
+	txn.pendingWrites[string(key)] = &data.LogRecord{
+		Key:   key,
+		Value: value,
+	}
+	return nil
+}
+
+// Delete 在事务中删除数据
+func (txn *Txn) Delete(key []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if txn.finished {
+		return ErrTxnFinished
+	}
+	txn.pendingWrites[string(key)] = &data.LogRecord{
+		Key:  key,
+		Type: data.LogRecordDeleted,
+	}
+	return nil
+}
+
+// Iterate 按照 options 遍历事务快照中的数据，fn 返回 false 时终止遍历
+// 遍历过的 key 同样会参与提交时的冲突检测
+func (txn *Txn) Iterate(options IteratorOptions, fn func(key []byte, value []byte) bool) error {
+	if txn.finished {
+		return ErrTxnFinished
+	}
+	limit := options.Limit
+	options.Limit = 0
+	iterator := txn.db.NewIterator(options)
+	defer iterator.Close()
+
+	// 快照之后被删除的 key 以及事务中新写入的 key 不在索引中，需要和索引迭代器合并遍历
+	// 需要在创建迭代器之后获取，避免遗漏两者之间被删除的 key
+	lowerBound, upperBound := iteratorBounds(options)
+	txn.db.mu.RLock()
+	changedKeys := txn.db.oracle.changedKeys(txn.readSeqNo)
+	txn.db.mu.RUnlock()
+	for key := range txn.pendingWrites {
+		changedKeys[key] = struct{}{}
+	}
+	extraKeys := make([][]byte, 0, len(changedKeys))
+	for key := range changedKeys {
+		k := []byte(key)
+		if (lowerBound == nil || bytes.Compare(k, lowerBound) >= 0) &&
+			(upperBound == nil || bytes.Compare(k, upperBound) < 0) {
+			extraKeys = append(extraKeys, k)
+		}
+	}
+	sort.Slice(extraKeys, func(i, j int) bool {
+		return (bytes.Compare(extraKeys[i], extraKeys[j]) < 0) != options.Reverse
+	})
+
+	var count, i int
+	iterator.Rewind()
+	for {
+		var key []byte
+		switch {
+		case iterator.Valid() && i < len(extraKeys):
+			cmp := bytes.Compare(iterator.Key(), extraKeys[i])
+			if options.Reverse {
+				cmp = -cmp
+			}
+			if cmp <= 0 {
+				key = iterator.Key()
+				iterator.Next()
+			}
+			if cmp >= 0 {
+				key = extraKeys[i]
+				i++
+			}
+		case iterator.Valid():
+			key = iterator.Key()
+			iterator.Next()
+		case i < len(extraKeys):
+			key = extraKeys[i]
+			i++
+		default:
+			return nil
+		}
+
+		value, err := txn.get(key)
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !fn(key, value) {
+			return nil
+		}
+		count++
+		if limit > 0 && count >= limit {
+			return nil
+		}
+	}
+}
+
+// Commit 提交事务，和事务开始之后提交的写入有冲突时返回 ErrTxnConflict，事务中的写入都不会生效
+func (txn *Txn) Commit() error {
+	if txn.finished {
+		return ErrTxnFinished
+	}
+	defer txn.finish()
+
+	// 只读事务不需要写入数据
+	if len(txn.pendingWrites) == 0 {
+		return nil
+	}
+	if txn.db.option.ReadOnly {
+		return ErrReadOnly
+	}
+
+	db := txn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// 检测读过和写过的 key 是否在快照之后被修改过
+	for key := range txn.reads {
+		if db.oracle.lastSeqNo(key) > txn.readSeqNo {
+			return ErrTxnConflict
+		}
+	}
+	for key := range txn.pendingWrites {
+		if db.oracle.lastSeqNo(key) > txn.readSeqNo {
+			return ErrTxnConflict
+		}
+	}
+
+	// 和 WriteBatch 使用相同的格式写入数据，以一条事务完成的记录结束
+	seqNo := atomic.AddUint64(&db.seqNo, 1)
+	positions := make(map[string]*data.LogRecordPos)
+	for key, record := range txn.pendingWrites {
+		// 删除不存在的 key 不需要写入
+		if record.Type == data.LogRecordDeleted && db.index.Get(record.Key) == nil {
+			continue
+		}
+		pos, err := db.writeLogRecord(&data.LogRecord{
+			Key:   logRecordKeyWithSeq(record.Key, seqNo),
+			Value: record.Value,
+			Type:  record.Type,
+		})
+		if err != nil {
+			return err
+		}
+		positions[key] = pos
+	}
+	if len(positions) == 0 {
+		return nil
+	}
+	finishedPos, err := db.writeLogRecord(&data.LogRecord{
+		Key:  logRecordKeyWithSeq(txnFinKey, seqNo),
+		Type: data.LogRecordTxnFinished,
+	})
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&db.reclaimSize, int64(finishedPos.Size))
+
+	if db.option.SyncWrites {
+		if err := db.activeFile.Sync(); err != nil {
+			return err
+		}
+	}
+
+	// 更新索引，事务中的写入在一次原子操作中更新
+	records := make([]*data.LogRecord, 0, len(positions))
+	keys := make([][]byte, 0, len(positions))
+	indexPositions := make([]*data.LogRecordPos, 0, len(positions))
+	for key, pos := range positions {
+		record := txn.pendingWrites[key]
+		records = append(records, record)
+		keys = append(keys, record.Key)
+		if record.Type == data.LogRecordNormal {
+			indexPositions = append(indexPositions, pos)
+		} else {
+			indexPositions = append(indexPositions, nil)
+		}
+	}
+	oldPositions, err := db.updateIndexBatch(keys, indexPositions)
+	if err != nil {
+		return err
+	}
+	for i, record := range records {
+		if record.Type == data.LogRecordDeleted {
+			atomic.AddInt64(&db.reclaimSize, int64(positions[string(record.Key)].Size))
+		}
+		if oldPos := oldPositions[i]; oldPos != nil {
+			atomic.AddInt64(&db.reclaimSize, int64(oldPos.Size))
+		}
+		db.recordWrite(record.Key, seqNo, oldPositions[i])
+	}
+	return nil
+}
+
+// Discard 放弃事务中所有的写入，并释放事务的快照
+func (txn *Txn) Discard() {
+	if !txn.finished {
+		txn.finish()
+	}
+}
+
+func (txn *Txn) finish() {
+	txn.finished = true
+	txn.pendingWrites = nil
+	txn.reads = nil
+	txn.db.oracle.finish(txn.readSeqNo)
+}
+
+// get 优先读取事务中写入的数据，否则读取快照中的数据
+func (txn *Txn) get(key []byte) ([]byte, error) {
+	if record, ok := txn.pendingWrites[string(key)]; ok {
+		if record.Type == data.LogRecordDeleted {
+			return nil, ErrKeyNotFound
+		}
+		return record.Value, nil
+	}
+	txn.reads[string(key)] = struct{}{}
+
+	db := txn.db
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	pos := db.oracle.visiblePos(key, txn.readSeqNo, db.index.Get(key))
+	if pos == nil || pos.IsExpired() {
+		return nil, ErrKeyNotFound
+	}
+	return db.getValueByPosition(pos)
+}
+
+// recordWrite 记录一次对索引的修改，需要持有 db.mu 的写锁
+// seqNo 为 nonTransactionSeqNo 时，为这次写入分配一个新的序列号
+func (db *DB) recordWrite(key []byte, seqNo uint64, oldPos *data.LogRecordPos) {
+	if !db.oracle.hasActiveTxns() {
+		return
+	}
+	if seqNo == nonTransactionSeqNo {
+		seqNo = atomic.AddUint64(&db.seqNo, 1)
+	}
+	db.oracle.recordWrite(key, seqNo, oldPos)
+}
+
+// keyVersion key 的一次修改
+type keyVersion struct {
+	seqNo  uint64             // 修改的序列号
+	oldPos *data.LogRecordPos // 修改之前的位置，为 nil 表示修改之前 key 不存在
+}
+
+// oracle 记录有活跃事务期间每个 key 的修改，用于事务的快照读以及提交时的冲突检测
+// 没有活跃事务时不记录任何数据
+type oracle struct {
+	mu         sync.Mutex
+	readSeqNos map[uint64]int          // 活跃事务的快照序列号 -> 事务数量
+	versions   map[string][]keyVersion // key 的修改记录，按照序列号从小到大排列
+}
+
+func newOracle() *oracle {
+	return &oracle{
+		readSeqNos: make(map[uint64]int),
+		versions:   make(map[string][]keyVersion),
+	}
+}
+
+func (o *oracle) begin(readSeqNo uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.readSeqNos[readSeqNo]++
+}
+
+// finish 事务结束，清理所有活跃事务都不再需要的修改记录
+func (o *oracle) finish(readSeqNo uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.readSeqNos[readSeqNo]--; o.readSeqNos[readSeqNo] == 0 {
+		delete(o.readSeqNos, readSeqNo)
+	}
+	if len(o.readSeqNos) == 0 {
+		o.versions = make(map[string][]keyVersion)
+		return
+	}
+
+	// 序列号不大于最小快照的修改对所有活跃事务都可见，不再需要记录
+	var minReadSeqNo uint64
+	first := true
+	for seqNo := range o.readSeqNos {
+		if first || seqNo < minReadSeqNo {
+			minReadSeqNo = seqNo
+			first = false
+		}
+	}
+	for key, versions := range o.versions {
+		i := sort.Search(len(versions), func(i int) bool {
+			return versions[i].seqNo > minReadSeqNo
+		})
+		if i == len(versions) {
+			delete(o.versions, key)
+		} else if i > 0 {
+			o.versions[key] = versions[i:]
+		}
+	}
+}
+
+func (o *oracle) hasActiveTxns() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.readSeqNos) > 0
+}
+
+func (o *oracle) recordWrite(key []byte, seqNo uint64, oldPos *data.LogRecordPos) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.versions[string(key)] = append(o.versions[string(key)], keyVersion{seqNo: seqNo, oldPos: oldPos})
+}
+
+// lastSeqNo key 最近一次修改的序列号，没有记录时返回 0
+func (o *oracle) lastSeqNo(key string) uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	versions := o.versions[key]
+	if len(versions) == 0 {
+		return 0
+	}
+	return versions[len(versions)-1].seqNo
+}
+
+// visiblePos 快照中 key 的位置，pos 为 key 当前在索引中的位置
+// 快照之后的第一次修改之前的位置就是快照中的位置
+func (o *oracle) visiblePos(key []byte, readSeqNo uint64, pos *data.LogRecordPos) *data.LogRecordPos {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, version := range o.versions[string(key)] {
+		if version.seqNo > readSeqNo {
+			return version.oldPos
+		}
+	}
+	return pos
+}
+
+// changedKeys 快照之后被修改过的 key
+func (o *oracle) changedKeys(readSeqNo uint64) map[string]struct{} {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	keys := make(map[string]struct{})
+	for key, versions := range o.versions {
+		if versions[len(versions)-1].seqNo > readSeqNo {
+			keys[key] = struct{}{}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,207 @@
+package kv_go
+
+import (
+	"KV-go/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestDB_Txn_ReadYourWrites(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-txn-1")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.Put(utils.GetTestKey(1), []byte("v1")))
+	assert.Nil(t, db.Put(utils.GetTestKey(2), []byte("v2")))
+
+	txn := db.Begin()
+	assert.Nil(t, txn.Put(utils.GetTestKey(1), []byte("v1-txn")))
+	assert.Nil(t, txn.Put(utils.GetTestKey(3), []byte("v3-txn")))
+	assert.Nil(t, txn.Delete(utils.GetTestKey(2)))
+
+	value, err := txn.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1-txn"), value)
+	_, err = txn.Get(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// 提交之前其他读取看不到事务中的写入
+	value, err = db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), value)
+	_, err = db.Get(utils.GetTestKey(3))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.Nil(t, txn.Commit())
+	assert.Equal(t, ErrTxnFinished, txn.Commit())
+	_, err = txn.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrTxnFinished, err)
+
+	value, err = db.Get(utils.GetTestKey(3))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v3-txn"), value)
+	_, err = db.Get(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// 放弃的事务不会写入数据
+	txn = db.Begin()
+	assert.Nil(t, txn.Put(utils.GetTestKey(4), []byte("v4")))
+	txn.Discard()
+	_, err = db.Get(utils.GetTestKey(4))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, ErrTxnFinished, txn.Put(utils.GetTestKey(4), []byte("v4")))
+
+	// 重启之后已经提交的事务仍然有效
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	value, err = db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1-txn"), value)
+	_, err = db.Get(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_Txn_Snapshot(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-txn-2")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), []byte("old")))
+	}
+
+	txn := db.Begin()
+	defer txn.Discard()
+
+	// 事务开始之后的写入对事务不可见
+	assert.Nil(t, db.Put(utils.GetTestKey(0), []byte("new")))
+	assert.Nil(t, db.Delete(utils.GetTestKey(1)))
+	assert.Nil(t, db.Put(utils.GetTestKey(5), []byte("new")))
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put(utils.GetTestKey(2), []byte("new")))
+	assert.Nil(t, wb.Delete(utils.GetTestKey(3)))
+	assert.Nil(t, wb.Commit())
+	other := db.Begin()
+	assert.Nil(t, other.Put(utils.GetTestKey(4), []byte("new")))
+	assert.Nil(t, other.Commit())
+
+	for i := 0; i < 5; i++ {
+		value, err := txn.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("old"), value)
+	}
+	_, err = txn.Get(utils.GetTestKey(5))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// 遍历快照和事务中的写入
+	assert.Nil(t, txn.Put(utils.GetTestKey(6), []byte("txn")))
+	assert.Nil(t, txn.Delete(utils.GetTestKey(4)))
+	var keys []string
+	err = txn.Iterate(DefaultIteratorOptions, func(key []byte, value []byte) bool {
+		keys = append(keys, string(key)+"="+string(value))
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		string(utils.GetTestKey(0)) + "=old",
+		string(utils.GetTestKey(1)) + "=old",
+		string(utils.GetTestKey(2)) + "=old",
+		string(utils.GetTestKey(3)) + "=old",
+		string(utils.GetTestKey(6)) + "=txn",
+	}, keys)
+
+	keys = nil
+	err = txn.Iterate(IteratorOptions{Reverse: true, LowerBound: utils.GetTestKey(1), Limit: 3},
+		func(key []byte, value []byte) bool {
+			keys = append(keys, string(key))
+			return true
+		})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		string(utils.GetTestKey(6)), string(utils.GetTestKey(3)), string(utils.GetTestKey(2)),
+	}, keys)
+
+	// 读过的 key 被修改过，提交失败
+	assert.Equal(t, ErrTxnConflict, txn.Commit())
+	_, err = db.Get(utils.GetTestKey(6))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// 所有事务结束之后不再记录修改
+	assert.False(t, db.oracle.hasActiveTxns())
+	assert.Equal(t, 0, len(db.oracle.versions))
+	assert.Nil(t, db.Put(utils.GetTestKey(0), []byte("newer")))
+	assert.Equal(t, 0, len(db.oracle.versions))
+}
+
+func TestDB_Txn_Conflict(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-txn-3")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	// 写写冲突
+	txn1 := db.Begin()
+	txn2 := db.Begin()
+	assert.Nil(t, txn1.Put([]byte("k"), []byte("1")))
+	assert.Nil(t, txn2.Put([]byte("k"), []byte("2")))
+	assert.Nil(t, txn1.Commit())
+	assert.Equal(t, ErrTxnConflict, txn2.Commit())
+
+	// 只读事务不会冲突，没有交集的事务可以同时提交
+	txn1 = db.Begin()
+	txn2 = db.Begin()
+	txn3 := db.Begin()
+	_, err = txn3.Get([]byte("k"))
+	assert.Nil(t, err)
+	assert.Nil(t, txn1.Put([]byte("a"), []byte("1")))
+	assert.Nil(t, txn2.Put([]byte("b"), []byte("1")))
+	assert.Nil(t, db.Put([]byte("k"), []byte("3")))
+	assert.Nil(t, txn1.Commit())
+	assert.Nil(t, txn2.Commit())
+	assert.Nil(t, txn3.Commit())
+
+	// 并发的读改写计数器不会丢失更新
+	const workers, increments = 8, 25
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; i++ {
+				for {
+					txn := db.Begin()
+					var n int
+					value, err := txn.Get([]byte("counter"))
+					if err == nil {
+						n, _ = strconv.Atoi(string(value))
+					}
+					_ = txn.Put([]byte("counter"), []byte(strconv.Itoa(n+1)))
+					err = txn.Commit()
+					if err == nil {
+						break
+					}
+					assert.Equal(t, ErrTxnConflict, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := db.Get([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, strconv.Itoa(workers*increments), string(value))
+	assert.Equal(t, 0, len(db.oracle.versions))
+}
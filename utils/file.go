@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DirSize 获取一个目录的大小
+func DirSize(dirPath string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dirPath, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// CopyFile 拷贝文件
+func CopyFile(src, dest string) error {
+	return copyFile(src, dest, -1)
+}
+
+// CopyFileN 拷贝文件开头的 n 个字节，文件不足 n 个字节时返回 io.EOF
+func CopyFileN(src, dest string, n int64) error {
+	return copyFile(src, dest, n)
+}
+
+// n 小于 0 时拷贝整个文件
+func copyFile(src, dest string, n int64) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	destFile, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	if n < 0 {
+		_, err = io.Copy(destFile, srcFile)
+	} else {
+		_, err = io.CopyN(destFile, srcFile, n)
+	}
+	if err != nil {
+		return err
+	}
+	return destFile.Sync()
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirSize(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-dir-size")
+	defer os.RemoveAll(dir)
+
+	size, err := DirSize(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), size)
+
+	err = os.WriteFile(filepath.Join(dir, "a.data"), []byte("bitcask"), 0644)
+	assert.Nil(t, err)
+	err = os.MkdirAll(filepath.Join(dir, "sub"), os.ModePerm)
+	assert.Nil(t, err)
+	err = os.WriteFile(filepath.Join(dir, "sub", "b.data"), []byte("kv"), 0644)
+	assert.Nil(t, err)
+
+	size, err = DirSize(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9), size)
+}
+
+func TestAvailableDiskSize(t *testing.T) {
+	size, err := AvailableDiskSize(os.TempDir())
+	assert.Nil(t, err)
+	assert.Greater(t, size, uint64(0))
+}
+
+func TestCopyFile(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-copy-file")
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "a.data")
+	dest := filepath.Join(dir, "b.data")
+	err := os.WriteFile(src, []byte("bitcask kv"), 0644)
+	assert.Nil(t, err)
+
+	err = CopyFile(src, dest)
+	assert.Nil(t, err)
+	content, err := os.ReadFile(dest)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bitcask kv"), content)
+}
+
+func TestCopyFileN(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-copy-file-n")
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "a.data")
+	dest := filepath.Join(dir, "b.data")
+	err := os.WriteFile(src, []byte("bitcask kv"), 0644)
+	assert.Nil(t, err)
+
+	err = CopyFileN(src, dest, 7)
+	assert.Nil(t, err)
+	content, err := os.ReadFile(dest)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bitcask"), content)
+
+	// 文件的长度不够
+	err = CopyFileN(src, dest, 100)
+	assert.Equal(t, io.EOF, err)
+}